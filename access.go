@@ -0,0 +1,188 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// Access is the result of an access check
+type Access uint8
+
+const (
+	AccessGranted         Access = iota // The action is permitted
+	AccessUnauthenticated               // Denied with 401 Unauthorized, the caller is not known
+	AccessForbidden                     // Denied with 403 Forbidden, the caller is known but not permitted
+)
+
+// accessError is a denied access check, its value is the response status
+type accessError int
+
+func (e accessError) Error() string {
+	return utils.StatusMessage(int(e))
+}
+
+func (e accessError) StatusCode() int {
+	return int(e)
+}
+
+// Reasoner can be implemented by the errors returned by ValidatorE to give a machine readable reason for a denial.
+// It is found with errors.As so wrapped errors are supported.
+type Reasoner interface {
+	Reason() string
+}
+
+// Denial is an error for ValidatorE that denies access with a status, reason code and message for the client
+type Denial struct {
+	Status  int    // The response status, 401 Unauthorized if 0 or not a 4xx status
+	Code    string // A machine readable reason, e.g. "token_expired", sent as "reason"
+	Message string // A message for the user, sent as "error".  If empty the status message is sent
+}
+
+func (d Denial) Error() string {
+	if d.Message == "" {
+		return utils.StatusMessage(d.StatusCode())
+	}
+	return d.Message
+}
+
+func (d Denial) StatusCode() int {
+	if d.Status == 0 {
+		return fiber.StatusUnauthorized
+	}
+	return d.Status
+}
+
+func (d Denial) Reason() string {
+	return d.Code
+}
+
+// deniedError is an access check denied by an error from ValidatorE, sent to the client by sendDenied
+type deniedError struct {
+	status int
+	err    error
+}
+
+func (e deniedError) Error() string {
+	return e.err.Error()
+}
+
+func (e deniedError) StatusCode() int {
+	return e.status
+}
+
+func (e deniedError) Unwrap() error {
+	return e.err
+}
+
+// accessFromValidator adapts a bool Validator to an AccessValidator that denies with 401
+func accessFromValidator[T any](validator func(c *fiber.Ctx, action Action, item ...T) bool) func(c *fiber.Ctx, action Action, item ...T) Access {
+	return func(c *fiber.Ctx, action Action, item ...T) Access {
+		if validator(c, action, item...) {
+			return AccessGranted
+		}
+		return AccessUnauthenticated
+	}
+}
+
+// perAction combines the per action validators with the validator for the other actions, which may be nil to allow them
+func perAction[T any](validators map[Action]func(c *fiber.Ctx, item ...T) bool, validator func(c *fiber.Ctx, action Action, item ...T) bool) func(c *fiber.Ctx, action Action, item ...T) bool {
+	return func(c *fiber.Ctx, action Action, item ...T) bool {
+		if v, ok := validators[action]; ok {
+			return v(c, item...)
+		}
+		return validator == nil || validator(c, action, item...)
+	}
+}
+
+// authorize runs the access check for action, returning an error carrying the response status if access is denied.
+// item is empty for aggregate actions or if the item is not found.
+func (api Api[T, D]) authorize(c *fiber.Ctx, action Action, item ...T) error {
+	return api.authorizeIncoming(c, action, nil, item...)
+}
+
+// authorizeIncoming is authorize with the incoming Jdo for create and mutate actions
+func (api Api[T, D]) authorizeIncoming(c *fiber.Ctx, action Action, incoming *D, item ...T) error {
+	if api.ValidatorD != nil {
+		var existing *T
+		if len(item) > 0 {
+			existing = &item[0]
+		}
+		if !api.ValidatorD(c, action, existing, incoming) {
+			return accessError(fiber.StatusUnauthorized)
+		}
+		return nil
+	}
+	if api.ValidatorE != nil {
+		err := api.ValidatorE(c, action, item...)
+		if err == nil {
+			return nil
+		}
+		status := errorStatus(err)
+		if status < 400 || status > 499 {
+			status = fiber.StatusUnauthorized
+		}
+		return deniedError{status: status, err: err}
+	}
+	if api.ValidatorStatus != nil {
+		allowed, status := api.ValidatorStatus(c, action, item...)
+		if allowed {
+			return nil
+		}
+		if status < 400 || status > 499 {
+			status = fiber.StatusUnauthorized
+		}
+		return accessError(status)
+	}
+	if api.AccessValidator == nil {
+		return nil
+	}
+	switch api.AccessValidator(c, action, item...) {
+	case AccessGranted:
+		return nil
+	case AccessForbidden:
+		return accessError(fiber.StatusForbidden)
+	}
+	return accessError(fiber.StatusUnauthorized)
+}
+
+// sendDenied responds to a failed access check.
+// A denial by ValidatorE is sent as JSON with the error and any reason, others with the status message.
+func sendDenied(c *fiber.Ctx, err error) error {
+	if handler := errorHandler(c); handler != nil {
+		return handler(c, errorStatus(err), err)
+	}
+	var denied deniedError
+	if errors.As(err, &denied) {
+		body := fiber.Map{"error": denied.Error()}
+		var reasoner Reasoner
+		if errors.As(denied.err, &reasoner) && reasoner.Reason() != "" {
+			body["reason"] = reasoner.Reason()
+		}
+		return c.Status(denied.status).JSON(body)
+	}
+	return c.SendStatus(errorStatus(err))
+}
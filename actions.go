@@ -0,0 +1,94 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// CustomAction is an operation on an item, or the collection, that isn't plain CRUD, e.g. POST /:id/promote.
+// The item is found and the access check is made with ActionCustom before the Handler is called.
+// The Jdo returned by the Handler is the response, errors are handled as for Api.Mutate.
+type CustomAction[T any, D any] struct {
+	SubPath    string
+	Method     string // The HTTP method, defaults to POST
+	Collection bool   // Serve at /<SubPath> without an item, the Handler is called with an empty T
+	Handler    func(c *fiber.Ctx, item T) (D, error)
+}
+
+// method is the HTTP method of the action
+func (action CustomAction[T, D]) method() string {
+	if action.Method == "" {
+		return fiber.MethodPost
+	}
+	return action.Method
+}
+
+// itemAction runs a CustomAction on the request item :id
+// 404 if the entity is not in the cache
+func itemAction[T any, D any](api Api[T, D], action CustomAction[T, D]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+
+		id := api.itemKey(c)
+		item, ok, err := api.ops.find(c.UserContext(), id)
+		if err != nil {
+			return api.sendFindError(c, err)
+		}
+		if !ok {
+			// don't leak existence information if unauthorized
+			if err := api.authorize(c, ActionCustom); err != nil {
+				return sendDenied(c, err)
+			}
+			return sendStatus(c, fiber.StatusNotFound)
+		}
+
+		if err := api.authorize(c, ActionCustom, item); err != nil {
+			return sendDenied(c, err)
+		}
+
+		dto, err := action.Handler(c, item)
+		if err != nil {
+			api.logger().Errorf("Error running %s on item %s: %v\n", action.SubPath, id, err)
+			return sendCallbackError(c, err)
+		}
+		return render(c, api.one(dto))
+	}
+}
+
+// collectionAction runs a collection CustomAction
+func collectionAction[T any, D any](api Api[T, D], action CustomAction[T, D]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+
+		if err := api.authorize(c, ActionCustom); err != nil {
+			return sendDenied(c, err)
+		}
+
+		var empty T
+		dto, err := action.Handler(c, empty)
+		if err != nil {
+			api.logger().Errorf("Error running %s: %v\n", action.SubPath, err)
+			return sendCallbackError(c, err)
+		}
+		return render(c, api.one(dto))
+	}
+}
@@ -23,14 +23,43 @@
 package easyrest
 
 import (
-	"log"
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 )
 
 type SubEntity[T any, D any] struct {
 	SubPath string
 	Get     func(item T) []any
+	GetCtx  func(ctx context.Context, item T) []any // Get with the request context, used in preference to Get
+	Dto     func(child any) any                     // Transform each child before it is sent, if nil the children are sent as returned by Get
+	Key     func(child any) string                  // The key of a child, if set a single child can be fetched at /:id/<SubPath>/:childId
+
+	// GetPage returns a page of children, limit 0 means no limit.  Used in preference to Get for the list so
+	// the children don't all need to be loaded.  If nil the list from Get is sliced in memory.
+	// GetPage, GetOne, Add and Remove are called with the request context.
+	GetPage         func(ctx context.Context, item T, limit, offset int) ([]any, error)
+	GetOne          func(ctx context.Context, item T, childKey string) (any, bool, error) // The child with the key, used in preference to Get for /:id/<SubPath>/:childId
+	Sort            func(a, b any) bool                                                   // Orders the children from Get before they are paged, a before b.  If nil they are listed as Get returns them
+	DefaultPageSize int                                                                   // Page size used when no limit is given, 0 returns every child.  Api.MaxPageSize also applies
+
+	// Add creates a child of the item from the request body, served as POST /:id/<SubPath>.  decode parses the body into
+	// a pointer to the child as Create's body is, with its size, content type and StrictBody checks, and its errors are returned as they are.
+	// Remove removes the child with the given key, served as DELETE /:id/<SubPath>/:childId.
+	// Both are checked with ActionMutate on the item and errors are handled as for Api.Create and Api.Delete.
+	Add    func(ctx context.Context, parent T, decode func(child any) error) (any, error)
+	Remove func(ctx context.Context, parent T, childKey string) error
+
+	// SubEntities of each child, served at /:id/<SubPath>/:childId/<nested SubPath>.  Key must be set to select the child.
+	// The nested Get is called with the child as returned by Get, and nested Add and Remove are not served.
+	SubEntities []SubEntity[any, any]
 }
 
 // Api is the easy rest/crud API for Fiber.
@@ -40,18 +69,261 @@ type SubEntity[T any, D any] struct {
 // The second, D, is a data transport type (DTO) used for the JSON in the API.
 // The two types can be the same, but separating them gives additional flexibility to have different json transformations
 // for internal and external API uses.
+// Errors returned by Create, Mutate, Patch and Delete can wrap ErrNotFound, ErrConflict, ErrValidation
+// or ErrForbidden (or implement StatusCoder) to choose the response status, otherwise a 500 is returned.
 // See examples.
 type Api[T any, D any] struct {
-	Path        string                                            // The path of the api under the parent
-	Find        func(key string) (T, bool)                        // Find one method
-	FindAll     func() []T                                        // Find all method
-	Search      func(D) []T                                       // Search using D as a filter
-	Mutate      func(T, D) (T, error)                             // Mutation function for "PUT".  If nil, no mutation is exposed
-	Create      func(D) (T, error)                                // Create function for "PUT".  If nil, creation is not exposed
-	Delete      func(T) (T, error)                                // // Mutation function for "DELETE", if nil, no mutation is exposed
-	SubEntities []SubEntity[T, D]                                 // SubEntities to expose as read only lists
-	Dto         func(T) D                                         // Fill a DTO for T
-	Validator   func(c *fiber.Ctx, action Action, item ...T) bool // Access check, T will be missing for aggregate functions or if the item is not found
+	Path        string                                                              // The path of the api under the parent
+	Find        func(key string) (T, bool)                                          // Find one method
+	FindCtx     func(ctx context.Context, key string) (T, bool)                     // Find one method with the request context, used in preference to Find
+	FindE       func(key string) (T, bool, error)                                   // Find one method that can report a failure, used in preference to Find.  An error gives a 500, or 503 if the backend is unavailable
+	FindAll     func() []T                                                          // Find all method
+	FindAllCtx  func(ctx context.Context) []T                                       // Find all method with the request context, used in preference to FindAll
+	FindAllE    func() ([]T, error)                                                 // Find all method that can report a failure, used in preference to FindAll.  An error gives a 500
+	FindPage    func(limit, offset int) []T                                         // Find a page of items, limit 0 means no limit.  If nil FindAll is sliced in memory
+	FindSince   func(t time.Time) []T                                               // Find the items updated after t, for GET /?updated_after=2024-01-01T00:00:00Z (or since=), composing with paging, sort and query filters.  If nil, updated_after is a 400
+	Search      func(D) []T                                                         // Search using D as a filter
+	SearchMap   func(fields map[string]any) []T                                     // Search with the fields given in a filter, by field name, used in preference to Search when one has its zero value so it is matched rather than ignored
+	SearchCtx   func(ctx context.Context, filter D) []T                             // Search with the request context, used in preference to Search
+	SearchE     func(D) ([]T, error)                                                // Search that can report a failure, used in preference to Search.  An error gives a 500
+	Mutate      func(T, D) (T, error)                                               // Mutation function for "PUT".  If nil, no mutation is exposed
+	MutateCtx   func(ctx context.Context, item T, edit D) (T, error)                // Mutation function with the request context, used in preference to Mutate
+	Patch       func(T, map[string]any) (T, error)                                  // Partial mutation for "PATCH" applying only the supplied DTO fields, a null field is set to its zero value.  application/merge-patch+json bodies are merged as RFC 7386 and application/json-patch+json bodies applied as RFC 6902.  If nil, no patch is exposed
+	PatchCtx    func(ctx context.Context, item T, fields map[string]any) (T, error) // Partial mutation with the request context, used in preference to Patch
+	Create      func(D) (T, error)                                                  // Create function for "PUT".  If nil, creation is not exposed
+	CreateCtx   func(ctx context.Context, edit D) (T, error)                        // Create function with the request context, used in preference to Create
+	Delete      func(T) (T, error)                                                  // // Mutation function for "DELETE", if nil, no mutation is exposed
+	DeleteCtx   func(ctx context.Context, item T) (T, error)                        // Delete function with the request context, used in preference to Delete
+	SubEntities []SubEntity[T, D]                                                   // SubEntities to expose as lists, writable if Add or Remove is set
+	Dto         func(T) D                                                           // Fill a DTO for T
+	Validator   func(c *fiber.Ctx, action Action, item ...T) bool                   // Access check, T will be missing for aggregate functions or if the item is not found
+
+	// Validators are access checks for single actions, used in preference to Validator for the actions they have an entry for.
+	// Validator, if set, checks the other actions.  The precedence of the access checks, the first set is used, is
+	// ValidatorD, ValidatorE, ValidatorStatus, AccessValidator, then Validators for the action, then Validator.
+	Validators map[Action]func(c *fiber.Ctx, item ...T) bool
+
+	AccessValidator func(c *fiber.Ctx, action Action, item ...T) Access // Access check able to deny with 401 or 403, used in preference to Validator when set
+
+	// ValidatorE is an access check that denies with an error, used in preference to ValidatorStatus, AccessValidator and Validator when set.
+	// The denial is sent as JSON with the error as "error", and the Reason as "reason" if the error implements Reasoner, see Denial.
+	// The status is that of the error as for Create, with errors that would not be a 4xx denied with 401.
+	ValidatorE func(c *fiber.Ctx, action Action, item ...T) error
+
+	// ValidatorStatus is an access check that denies with the status it returns, e.g. 404 to hide that an item exists or 429 when
+	// a quota is used up.  A status that isn't 4xx is a 401.  It is used in preference to AccessValidator and Validator when set.
+	// A denial of ActionGetOne for a missing item has the same status, so a 404 for items the caller can't see hides their existence.
+	ValidatorStatus func(c *fiber.Ctx, action Action, item ...T) (allowed bool, status int)
+
+	// ValidatorD is an access check that can also inspect the incoming Jdo, used in preference to ValidatorE, ValidatorStatus, AccessValidator and Validator when set.
+	// existing is nil for aggregate functions or if the item is not found.
+	// incoming is only set for create, mutate and patch and the check is made after the body is parsed,
+	// so a body that can't be parsed is rejected with 400 before the check.  For patch, incoming is the Jdo with the patch applied.
+	ValidatorD func(c *fiber.Ctx, action Action, existing *T, incoming *D) bool
+
+	// A paged GET / has an RFC 5988 Link header to the first, prev, next and last pages, keeping the other query parameters.
+	// There is no last link if the total is unknown, see TotalHeader.
+	DefaultPageSize int // Page size used by GET / when no limit is given, 0 returns everything
+	MaxPageSize     int // Upper bound on the limit a client may request, 0 for no maximum
+
+	Sort         func(items []T, fields []SortField) []T         // Sort items for ?sort=, if nil the DTOs are sorted by field name
+	SortDefault  func(items []T)                                 // Sort the FindAll and Search results in place when there is no ?sort=, so lists and pages have a stable order
+	FindSorted   func(fields []SortField, limit, offset int) []T // Find a sorted page in the store, used in preference to FindAll when ?sort= is given
+	SearchSorted func(filter D, fields []SortField) []T          // Search returning sorted results, used in preference to Search when ?sort= is given
+
+	// SearchAdvanced searches with the conditions of query parameters like ?Field2.gte=10, as well as the fields set in filter,
+	// for GET / with QueryFilter and GET /count.  Without it a query with a condition is a 400.  The results are sorted
+	// and paged as those of Search.  SearchAdvancedCtx is used in preference to it.
+	SearchAdvanced    func(filter D, conditions []Condition) ([]T, error)
+	SearchAdvancedCtx func(ctx context.Context, filter D, conditions []Condition) ([]T, error)
+
+	// MaxResults caps the items of a list or search, 0 for no cap.  The list is truncated to its first MaxResults items,
+	// before paging, and the response has X-Results-Truncated: true, and truncated in the envelope meta, if items were left out.
+	// Capped lists are not streamed.
+	MaxResults int
+
+	// TotalHeader is the header of list and search responses with the total number of items matching, before paging and MaxResults.
+	// Defaults to X-Total-Count.  The total is counted with Count if it is set, otherwise it is the length of the list found,
+	// so a list found a page at a time with FindPage or FindSorted has no total without Count.
+	// Content-Range sends the page and total as "items 0-9/100".
+	TotalHeader string
+
+	Key   func(T) string                 // The key of an item as used in its path, used for the Location of created items
+	Count func(filter *D) (int64, error) // Count the items matching filter, or all items if filter is nil.  If nil FindAll/Search results are counted
+
+	// KeyParts is the number of path segments of a composite key, the item routes are /:id/:id2 for 2.  0 or 1 is a single segment key.
+	// The key passed to Find, and SetKey, is the decoded parts joined with JoinKey, and Key must return the key joined the same way.
+	// SubEntity and custom action paths follow the whole key, so a part named as a SubPath resolves to the SubEntity.
+	KeyParts int
+
+	QueryFilter    bool           // Allow GET / to be filtered with query parameters, e.g. ?Key=id1, which are bound into D and passed to Search
+	DeleteResponse DeleteResponse // The response to a successful delete, defaults to the text "deleted"
+	CreatedStatus  bool           // Respond to create with 201 Created and a Location header (if Key is set), rather than 200.  This will become the default in the next minor release
+
+	// OnChange is called after a successful create, mutate, patch or delete, in its own goroutine.
+	// before is nil for a create and after is nil for a delete.  A panic in OnChange is recovered and logged.
+	OnChange func(action Action, before *T, after *T)
+
+	// Version returns the version of an item used as its ETag.  If nil the ETag is a hash of the item's Jdo.
+	// GET sends the ETag of the body it sends, so a redacted or partial body has its own: a hash of it, or the Version qualified by one.
+	// PUT, PATCH and DELETE with an If-Match header that doesn't match the current ETag, or that GET would send, fail with 412.
+	Version func(T) string
+
+	// Redact changes the Jdo of an item for the request before it is sent, e.g. clearing the fields the caller's role may not see.
+	// It is called with the action of the route for GET of an item or list, search and the item sent after a create, update,
+	// patch or delete, and with ActionGetAll for the change events sent to each subscriber.  Lists are redacted after they are sorted.
+	// SubEntity children and CustomAction results are not redacted, and GET / is not streamed from IterateAll when it is set.
+	Redact func(c *fiber.Ctx, action Action, dto D) D
+
+	OmitZeroFields bool // Leave the fields of a Jdo that have their zero value, e.g. those cleared by Redact, out of responses
+
+	Envelope Envelope // Wrap responses in an envelope with metadata, defaults to bare responses
+
+	IncludeLinks bool // Add _links with the URL of the item and its SubEntities to GET responses.  List items are only linked if Key is set
+
+	// A client accepting application/hal+json gets HAL resources from GET and search, whether or not IncludeLinks is set.
+	// Items have _links to self, their collection and SubEntities, with the SubEntities as _embedded.
+	// Lists embed the items as _embedded[Path] with a count.
+
+	StrictBody bool // Reject JSON bodies with fields that are not on the Jdo with 400, rather than ignoring them
+
+	// ValidateDto checks an incoming Jdo on create, mutate and patch (with the patch applied).
+	// It runs after the body is parsed, the access check passes and TransformIn, so a client without access never sees validation errors.
+	// Returning FieldErrors, or any other error, rejects the request with 422 and a JSON array of the field errors.
+	// ValidateTags can be used to validate with `validate` struct tags.
+	ValidateDto func(D) error
+
+	// TransformIn rewrites an incoming Jdo, e.g. trimming whitespace or normalising phone numbers, before it is validated.
+	// It runs on the body of a create, PUT or /validate after the access check and before ValidateDto, and on filters from
+	// POST /filter or query parameters.  PATCH bodies are not transformed.  An error rejects the request with 422, as from ValidateDto.
+	TransformIn func(c *fiber.Ctx, dto D) (D, error)
+
+	// TransformOut rewrites the Jdo of an item before it is sent, e.g. adding display fields.  It runs wherever Redact
+	// does, before it.
+	TransformOut func(c *fiber.Ctx, dto D) D
+
+	// ValidateRoutes exposes POST /validate and POST /:id/validate, which check a Jdo as a create or a PUT to the item would
+	// without saving it, for validation as the user types.  The response is 200 with the Jdo as parsed, with the key from
+	// the path if SetKey is set, or 422 with the field errors from ValidateDto.  Create and Mutate are never called.
+	// The access check is ActionValidate with the incoming Jdo, and the item for /:id/validate, so it can be allowed
+	// for clients that can't write.
+	ValidateRoutes bool
+
+	// Clone exposes POST /:id/clone, creating a copy of the item from its Jdo with Create.  The fields of an optional body
+	// replace those of the copy as for PATCH, it must set a new key unless Create generates one.  Create must be set.
+	// The access check is ActionCreate with the Jdo of the copy and the source item.
+	Clone bool
+
+	// SearchableFields are the fields of the Jdo that filters may set, by their Go names.  A filter body, or query filter,
+	// setting any other field is rejected with 400 naming the field before Search is called.  If empty every field is searchable.
+	SearchableFields []string
+
+	// SortableFields are the fields of the Jdo that ?sort= may order by, by their Go names.  Sorting by any other field is
+	// rejected with 400 listing the sortable fields.  If empty every sortable field of the Jdo is allowed.
+	SortableFields []string
+
+	CustomActions []CustomAction[T, D] // Non CRUD operations on an item, or on the collection, checked with ActionCustom
+	Lookups       []Lookup[T]          // Find items by secondary unique fields at GET /by/<Field>/:value, sent as GET /:id
+
+	// UpsertOnPut creates the item with Create when PUT finds no item at the key, responding 201 rather than 404.
+	// SetKey must also be set, it sets the key of the incoming Jdo so the key in the path wins over any in the body.
+	// The access check is made with ActionCreate.
+	UpsertOnPut bool
+	SetKey      func(dto *D, key string) error
+
+	// IterateAll calls yield with each item until it returns false.  If set GET / streams the list as it is iterated,
+	// rather than buffering it, unless the request is paged, sorted, filtered or selects fields.
+	// Streamed responses have no ETag.  If FindAll is nil it is filled from IterateAll.
+	IterateAll func(yield func(T) bool)
+
+	// BodyTypes are the content types accepted for POST, PUT and PATCH bodies, others get 415.
+	// Defaults to JSON, XML and MessagePack.  Form types can be added, they are parsed by fiber's BodyParser.
+	BodyTypes []string
+	// LenientContentType treats a body without a content type as JSON, otherwise it gets 415
+	LenientContentType bool
+	// MaxBodyBytes is the largest body accepted for create, mutate, patch, search and adding children, larger bodies get 413 before they are parsed.
+	// 0 for no limit other than the fiber BodyLimit of the app.
+	MaxBodyBytes int
+
+	// Subscriptions exposes GET /ws, a websocket sending {"action": "create", "data": {...}} for each create, mutate, patch and delete.
+	// The data is the Jdo of the item, as it was before a delete.  The client can send a filter as its first message,
+	// a JSON object of Jdo fields that must all match for an event to be sent.  The access check is made with ActionGetAll on connection.
+	// TransformOut, Redact and OmitZeroFields are applied to the data with a copy of the connection request, as for GET /.
+	Subscriptions bool
+
+	// AllowBulkDelete exposes POST /deleteWhere, deleting every item matching the filter in the body and responding {"deleted": N}.
+	// Delete and Search must be set.  A filter without any fields set is a 400, so the whole collection can't be deleted by mistake,
+	// as is one matching more than MaxResults items.  The access check is ActionDelete with all the matched items, and only they are deleted.
+	AllowBulkDelete bool
+
+	// AllowBulkUpdate exposes POST /updateWhere with a body of {"filter": {...}, "set": {...}}, setting the fields in set on
+	// every item matching filter as a PATCH would, and responding {"matched": N, "updated": M}.  Mutate and Search must be set.
+	// An empty filter or set is a 400.  The access check is ActionMutate with all the matched items.
+	// The items are patched one at a time, so an error part way through leaves the earlier items updated, gormrest patches
+	// them all in one transaction.
+	AllowBulkUpdate bool
+
+	// SerializeMutations runs the PUT, PATCH and DELETE requests for the same key one at a time, so the Find and Mutate of
+	// concurrent requests don't interleave and lose changes.  Requests for different keys still run in parallel.
+	// The lock is only within this process, use a transaction or If-Match where several processes share the store.
+	SerializeMutations bool
+
+	// MethodOverride handles a POST to an item with an X-HTTP-Method-Override header of PUT, PATCH or DELETE as that method,
+	// for clients behind proxies that only pass GET and POST.  The request is checked with the Action of the method it is sent as.
+	// Other POSTs to an item are a 405.
+	MethodOverride bool
+
+	// ErrorHandler sends the error responses of the api, in place of the JSON error or bare status, e.g. to add a correlation id.
+	// err is the error returned by an Api function, including internal errors that are not described to the client,
+	// or a *fiber.Error for a status without one, e.g. a 404 for an item that is not found.  The handler can send any status.
+	// Access denials, validation failures and panics are passed to it too.  Responses to conditional requests, e.g. 412, are not.
+	ErrorHandler func(c *fiber.Ctx, status int, err error) error
+
+	// Serialize, if set, encodes every successful response of the api in place of JSON or the codec the request accepts,
+	// returning the body and its content type.  v is the single Jdo, or the slice of them, after fields, links and the
+	// envelope are applied, so it can post-process the output.  Error responses and NDJSON lines are not passed to it.
+	Serialize func(c *fiber.Ctx, v any) ([]byte, string, error)
+
+	// JSONEncoder and JSONDecoder replace the app's JSONEncoder and JSONDecoder, encoding/json unless configured, for this api,
+	// e.g. with jsoniter or sonic.  They encode the JSON responses and change events, and decode JSON and PATCH bodies.
+	// StrictBody bodies are still checked with encoding/json, and fields=, links and envelopes re-encode the Jdo with it.
+	JSONEncoder utils.JSONMarshal
+	JSONDecoder utils.JSONUnmarshal
+
+	// RateLimiter, if set, is asked to allow each request, with the action of its route, before the handler runs and so
+	// before the access check.  A denied request gets a 429, with a Retry-After header if retryAfter is positive.
+	// See the ratelimit package for a token bucket per client.
+	RateLimiter func(c *fiber.Ctx, action Action) (allowed bool, retryAfter time.Duration)
+
+	// Middleware is run, in order, for every request to the api before its handler, and so before the access check.
+	// A middleware can respond without calling c.Next() to stop the request, e.g. with 429 when rate limited.
+	Middleware []fiber.Handler
+
+	Logger Logger // Logs errors and warnings for the api, defaults to the Logger set with SetLogger
+
+	// LogRequest is called once for each request handled by the api, after the response is ready, for structured request logging.
+	// The Action is that of the route, e.g. ActionCreate for POST / even when the request is denied.
+	// Middleware and OPTIONS requests are not included.  SlogRequests logs each request to a *slog.Logger.
+	LogRequest func(r RequestRecord)
+
+	// OnPanic is called when a handler panics, after the panic is recovered and logged with its stack, and before the 500 response is sent.
+	// Only panics while handling a request are recovered, RegisterAPI still panics on an invalid Api.
+	OnPanic func(c *fiber.Ctx, recovered any)
+
+	Metrics Metrics // Observes the status and latency of each request handled by the api, with the same Action and exclusions as LogRequest
+
+	// FieldNaming renames the Jdo fields without a json tag name, e.g. to camelCase, without changing the struct tags.
+	// JSON responses and bodies, query filter parameters, sort and fields use the renamed fields.
+	// XML and MessagePack, and the events sent to subscribers, keep the Go field names.
+	FieldNaming FieldNaming
+
+	ops    ops[T, D]    // The data functions resolved at registration
+	prefix string       // The full path of the api route group
+	subs   *subscribers // The clients following changes, if Subscriptions is set
+	names  *fieldNames  // The renamed Jdo fields, nil for FieldNamingOriginal
+
+	reserved []string  // The keys shadowed by the collection routes, see Registration.Reserved
+	locks    *keyLocks // The locks of the keys being changed, if SerializeMutations is set
 }
 
 type Action uint8
@@ -62,119 +334,823 @@ const (
 	ActionMutate
 	ActionCreate
 	ActionDelete
+	ActionSearch   // Filtered queries, via POST /filter or query parameters
+	ActionCustom   // A CustomAction
+	ActionValidate // Checking a Jdo without saving it, via POST /validate or /:id/validate
 )
 
-func RegisterAPI[T any, D any](api fiber.Router, genericApi Api[T, D]) {
-	log.Printf("Registering REST api %s\n", genericApi.Path)
+var actionNames = [...]string{"getAll", "getOne", "mutate", "create", "delete", "search", "custom", "validate"}
+
+// String is the name of the action as sent to subscribers, e.g. "create"
+func (a Action) String() string {
+	if int(a) < len(actionNames) {
+		return actionNames[a]
+	}
+	return "unknown"
+}
+
+// DeleteResponse selects the response sent after a successful delete
+type DeleteResponse uint8
+
+const (
+	DeleteResponseText      DeleteResponse = iota // The plain text "deleted"
+	DeleteResponseNoContent                       // 204 No Content with no body
+	DeleteResponseDto                             // The DTO of the deleted item as JSON
+)
+
+// Envelope selects which responses are wrapped in an envelope object
+type Envelope uint8
+
+const (
+	EnvelopeNone        Envelope = iota // Responses are bare arrays and objects
+	EnvelopeCollections                 // Lists are sent as {"data": [...], "meta": {"count": N, "limit": L, "offset": O}}, with "truncated": true if cut short by MaxResults
+	EnvelopeAll                         // Lists as EnvelopeCollections and single items as {"data": {...}}
+)
+
+// RegisterAPI exposes genericApi underneath the api router at its Path.
+// It returns ErrInvalidApi if genericApi is missing a required function, or ErrDuplicatePath if an api is already registered
+// at the same path through api, in which case nothing is registered.  See MustRegisterAPI to panic instead.
+func RegisterAPI[T any, D any](api fiber.Router, genericApi Api[T, D]) (*Registration, error) {
+	genericApi.logger().Infof("Registering REST api %s\n", genericApi.Path)
+
+	// A bool Validator, and the per action Validators, are treated as an AccessValidator that denies with 401
+	if genericApi.AccessValidator == nil && genericApi.Validators != nil {
+		genericApi.AccessValidator = accessFromValidator(perAction(genericApi.Validators, genericApi.Validator))
+	} else if genericApi.AccessValidator == nil && genericApi.Validator != nil {
+		genericApi.AccessValidator = accessFromValidator(genericApi.Validator)
+	}
+
+	// Resolve the data functions, preferring the context aware variants
+	genericApi.ops = genericApi.resolveOps()
+
+	// The json names of the Jdo fields
+	genericApi.names = newFieldNames[D](genericApi.FieldNaming)
+
+	// The registry of subscribers, shared by every handler so changes reach them all
+	if genericApi.Subscriptions {
+		genericApi.subs = newSubscribers()
+	}
+
+	if err := genericApi.check(); err != nil {
+		return nil, err
+	}
+	genericApi.reserved = genericApi.reservedKeys()
+	if genericApi.SerializeMutations {
+		genericApi.locks = newKeyLocks()
+	}
+
+	// The optional operations that are enabled
+	caps := genericApi.capabilities()
 
 	// The api path
-	generic := api.Group("/" + genericApi.Path)
+	group := api.Group("/" + genericApi.Path)
+	if g, ok := group.(*fiber.Group); ok {
+		genericApi.prefix = g.Prefix
+	}
+	if err := claimPath(api, genericApi.prefix); err != nil {
+		return nil, err
+	}
+	// The routes are recorded for the Registration
+	generic := &routeRecorder{Router: group, prefix: genericApi.prefix}
 
-	// The two variants of GetAll
-	generic.Get("/", getAll[T, D](genericApi))
+	// The api middleware, before any route
+	for _, handler := range genericApi.Middleware {
+		generic.Use(scoped(genericApi.prefix, handler))
+	}
 
-	// The POST create  (if provided)
-	if genericApi.Mutate != nil {
-		generic.Post("/", createOne[T, D](genericApi))
+	// The two variants of GetAll
+	// The collection routes are registered with and without a trailing slash
+	generic.slashed(generic.Get, "/", genericApi.instrumented(ActionGetAll, getAll[T, D](genericApi)))
 
+	// The POST create  (if provided), disabled methods are answered with 405 and the allowed methods
+	if caps.create {
+		generic.slashed(generic.Post, "/", genericApi.instrumented(ActionCreate, createOne[T, D](genericApi)))
+	} else {
+		generic.slashed(generic.Post, "/", genericApi.instrumented(ActionCreate, methodNotAllowed(caps.collectionMethods())))
 	}
 
+	// The methods allowed on the collection
+	generic.slashed(generic.Options, "/", options(caps.collectionMethods()))
+
 	// The POST search  (if provided)
-	if genericApi.Search != nil {
-		generic.Post("/filter", search[T, D](genericApi))
+	if caps.search {
+		generic.slashed(generic.Post, "/filter", genericApi.instrumented(ActionSearch, search[T, D](genericApi)))
 
 	}
 
+	// The bulk delete and update (if allowed)
+	if caps.deleteWhere {
+		generic.slashed(generic.Post, "/deleteWhere", genericApi.instrumented(ActionDelete, deleteWhere[T, D](genericApi)))
+	}
+	if caps.updateWhere {
+		generic.slashed(generic.Post, "/updateWhere", genericApi.instrumented(ActionMutate, updateWhere[T, D](genericApi)))
+	}
+
+	// The count of items, optionally filtered by query parameters or a filter body.
+	// This is before the item Getter so "count" is not treated as a key
+	generic.slashed(generic.Get, "/count", genericApi.instrumented(ActionGetAll, count[T, D](genericApi)))
+	generic.slashed(generic.Post, "/count", genericApi.instrumented(ActionSearch, count[T, D](genericApi)))
+
+	// The change subscriptions, also before the item Getter
+	if genericApi.Subscriptions {
+		generic.Get("/ws", genericApi.instrumented(ActionGetAll, subscribe[T, D](genericApi)))
+	}
+
+	// The collection custom actions, before the item Getter so their paths are not treated as keys
+	for _, action := range genericApi.CustomActions {
+		if action.Collection {
+			generic.Add(action.method(), "/"+action.SubPath, genericApi.instrumented(ActionCustom, collectionAction[T, D](genericApi, action)))
+		}
+	}
+
+	// Validating a new Jdo, before the item routes
+	if genericApi.ValidateRoutes {
+		generic.slashed(generic.Post, "/validate", genericApi.instrumented(ActionValidate, validateNew[T, D](genericApi)))
+	}
+
+	// The lookups by secondary fields, also before the item routes
+	for _, lookup := range genericApi.Lookups {
+		generic.Get(lookup.lookupRoute(), genericApi.instrumented(ActionGetOne, sendOne[T, D](genericApi, lookup.find)))
+	}
+
+	// The item route, with a parameter for each part of the key
+	item := genericApi.itemRoute()
+
+	// Validating a change to an item
+	if genericApi.ValidateRoutes {
+		generic.Post(item+"/validate", genericApi.instrumented(ActionValidate, validateItem[T, D](genericApi)))
+	}
+
+	// Copying an item
+	if caps.clone {
+		generic.Post(item+"/clone", genericApi.instrumented(ActionCreate, cloneOne[T, D](genericApi)))
+	}
+
+	// The item custom actions
+	for _, action := range genericApi.CustomActions {
+		if !action.Collection {
+			generic.Add(action.method(), item+"/"+action.SubPath, genericApi.instrumented(ActionCustom, itemAction[T, D](genericApi, action)))
+		}
+	}
+
 	// The SubEntity getters
 	// This is before the item Getter to ensure any name collision resolves to the SubEntity
 	for _, subEntity := range genericApi.SubEntities {
-		generic.Get("/:id/"+subEntity.SubPath, getSubEntity[T, D](genericApi, subEntity.Get))
+		generic.Get(item+"/"+subEntity.SubPath, genericApi.instrumented(ActionGetOne, getSubEntity[T, D](genericApi, subEntity)))
+		if subEntity.Key != nil {
+			generic.Get(item+"/"+subEntity.SubPath+"/:childId", genericApi.instrumented(ActionGetOne, getSubEntityItem[T, D](genericApi, subEntity)))
+			registerNested[T, D](generic, genericApi, subEntity, nil, item+"/"+subEntity.SubPath+"/:childId", subEntity.SubEntities)
+		}
+		if subEntity.Add != nil {
+			generic.Post(item+"/"+subEntity.SubPath, genericApi.instrumented(ActionMutate, addSubEntity[T, D](genericApi, subEntity)))
+		}
+		if subEntity.Remove != nil {
+			generic.Delete(item+"/"+subEntity.SubPath+"/:childId", genericApi.instrumented(ActionMutate, removeSubEntity[T, D](genericApi, subEntity)))
+		}
 	}
 
+	// HEAD sends the headers of GET, including the ETag and Content-Length, without the body.
+	// It is registered before the Getter which would otherwise answer HEAD without the instrumentation of HEAD
+	generic.Head(item, genericApi.instrumented(ActionGetOne, getOne[T, D](genericApi)))
+
 	// The Single item Getter
-	generic.Get("/:id", getOne[T, D](genericApi))
+	generic.Get(item, genericApi.instrumented(ActionGetOne, getOne[T, D](genericApi)))
+
+	// The methods allowed on an item
+	generic.Options(item, options(caps.itemMethods()))
 
 	// The PUT mutation (if provided)
-	if genericApi.Mutate != nil {
-		generic.Put("/:id", mutateOne[T, D](genericApi))
+	put := genericApi.instrumented(ActionMutate, methodNotAllowed(caps.itemMethods()))
+	if caps.mutate {
+		put = genericApi.instrumented(ActionMutate, genericApi.serialized(mutateOne[T, D](genericApi)))
+	}
+	generic.Put(item, put)
 
+	// The PATCH partial mutation (if provided)
+	patch := genericApi.instrumented(ActionMutate, methodNotAllowed(caps.itemMethods()))
+	if caps.patch {
+		patch = genericApi.instrumented(ActionMutate, genericApi.serialized(patchOne[T, D](genericApi)))
 	}
+	generic.Patch(item, patch)
 
-	// The GET mutation (if provided)
-	if genericApi.Delete != nil {
-		generic.Delete("/:id", deleteOne[T, D](genericApi))
+	// The DELETE (if provided)
+	del := genericApi.instrumented(ActionDelete, methodNotAllowed(caps.itemMethods()))
+	if caps.delete {
+		del = genericApi.instrumented(ActionDelete, genericApi.serialized(deleteOne[T, D](genericApi)))
+	}
+	generic.Delete(item, del)
+
+	// POST as another method for clients that can only send GET and POST
+	if genericApi.MethodOverride {
+		generic.Post(item, genericApi.handlingErrors(methodOverride(map[string]fiber.Handler{
+			fiber.MethodPut:    put,
+			fiber.MethodPatch:  patch,
+			fiber.MethodDelete: del,
+		}, caps.itemMethods())))
+	}
+
+	// Listed by RegisterIndex
+	genericApi.index(api, caps)
+
+	return &Registration{Path: genericApi.prefix, Actions: genericApi.actions(caps), Routes: generic.routes, Reserved: genericApi.reserved}, nil
+}
 
+// MustRegisterAPI is RegisterAPI, panicking if the api can't be registered
+func MustRegisterAPI[T any, D any](api fiber.Router, genericApi Api[T, D]) *Registration {
+	reg, err := RegisterAPI(api, genericApi)
+	if err != nil {
+		panic(err)
 	}
+	return reg
 }
 
 // getAll returns all entities as their Jdo type
+// 304 if If-None-Match matches the ETag of the response
 func getAll[T any, D any](api Api[T, D]) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Perms check
-		if api.Validator != nil && !api.Validator(c, ActionGetAll) {
-			return c.SendStatus(fiber.StatusUnauthorized)
+		if err := api.authorize(c, ActionGetAll); err != nil {
+			return sendDenied(c, err)
+		}
+
+		limit, offset, err := parsePaging(c, api)
+		if err != nil {
+			api.logger().Warnf("Error parsing paging parameters %v\n", err)
+			return sendStatus(c, fiber.StatusBadRequest)
+		}
+		sortFields, err := api.parseSort(c.Query("sort"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+		fields, err := parseFields[D](c.Query("fields"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+		expand, err := api.parseExpand(c.Query("expand"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+		var filter D
+		var conditions []Condition
+		var given map[string]any
+		searchesMap := false
+		filtered := false
+		if api.QueryFilter {
+			filter, conditions, filtered, err = bindQueryFilter[D](c)
+			if err != nil {
+				return sendError(c, fiber.StatusBadRequest, err)
+			}
+			if err := api.checkFilterable(filtered, conditions); err != nil {
+				return sendError(c, fiber.StatusBadRequest, err)
+			}
+			if err := api.checkSearchable(filter, conditions...); err != nil {
+				return sendError(c, fiber.StatusBadRequest, err)
+			}
+			// Filtering is also a search
+			if filtered {
+				if err := api.authorize(c, ActionSearch); err != nil {
+					return sendDenied(c, err)
+				}
+				if filter, err = api.transformIn(c, filter); err != nil {
+					return sendValidationError(c, err)
+				}
+				given = queryFilterFields(c, filter)
+				if searchesMap, err = api.searchesMap(given); err != nil {
+					return sendError(c, fiber.StatusBadRequest, err)
+				}
+			}
+		}
+
+		since, err := api.parseSince(c)
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+		if since != nil && len(conditions) > 0 {
+			return sendError(c, fiber.StatusBadRequest, errors.New("filter operators cannot be used with since"))
+		}
+		after, position, err := api.parseCursor(c, sortFields)
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+		if after != nil && (since != nil || len(conditions) > 0 || searchesMap) {
+			return sendError(c, fiber.StatusBadRequest, errors.New("a cursor cannot be used with filter operators or since"))
+		}
+
+		// Stream everything if there's nothing to apply to the whole list
+		ndjson := wantsNDJSON(c)
+		if api.streams(c, ndjson, limit, offset, sortFields, filtered || since != nil, fields) && expand == nil {
+			return streamAll(c, api, ndjson)
 		}
 
-		// Find all
+		// Find all (or a page), filtered and sorted if requested
 		// Transform to DTO
 		// Send as JSON
+		ctx := c.UserContext()
+		var items []T
 		var all []D
-		for _, v := range api.FindAll() {
-			all = append(all, api.Dto(v))
+		var truncated bool
+		loaded := -1     // The length of the whole list, if it was found rather than a page
+		ordered := false // The page was found in the order of the store, so the next can be found after its last item
+		var counted *D
+		if filtered {
+			counted = &filter
 		}
-		return c.JSON(all)
+		start := offset // The position of the page in the list, after the items before a cursor
+		if after != nil {
+			start = position
+		}
+		found, inCap := api.capPage(limit, start)
+		switch {
+		case after != nil && !inCap:
+			// The page is past MaxResults
+			all, truncated = []D{}, true
+		case after != nil:
+			if items, err = api.ops.findAfter(ctx, counted, sortFields, after, found); err == nil {
+				ordered = true
+				items, truncated = capFound(api, items, start)
+				all = toDtos(api, items)
+			}
+		case len(conditions) > 0 && len(sortFields) > 0 && api.ops.searchAdvancedSorted != nil:
+			if items, err = api.ops.searchAdvancedSorted(ctx, filter, conditions, sortFields); err == nil {
+				loaded = len(items)
+				items, all, truncated = pageSorted(api, items, limit, offset)
+			}
+		case len(conditions) > 0:
+			if items, err = api.ops.searchAdvanced(ctx, filter, conditions); err == nil {
+				loaded = len(items)
+				items, all, truncated = sortAndPage(api, items, sortFields, limit, offset)
+			}
+		case searchesMap && since == nil && len(sortFields) > 0 && api.ops.searchMapSorted != nil:
+			if items, err = api.ops.searchMapSorted(ctx, given, sortFields); err == nil {
+				loaded = len(items)
+				items, all, truncated = pageSorted(api, items, limit, offset)
+			}
+		case searchesMap && since == nil:
+			if items, err = api.ops.searchMap(ctx, given); err == nil {
+				loaded = len(items)
+				items, all, truncated = sortAndPage(api, items, sortFields, limit, offset)
+			}
+		case since != nil:
+			if items, err = api.ops.findSince(ctx, *since, counted); err == nil {
+				loaded = len(items)
+				items, all, truncated = sortAndPage(api, items, sortFields, limit, offset)
+			}
+		case filtered && api.ops.searchPage != nil && !inCap:
+			// The page is past MaxResults
+			all, truncated = []D{}, true
+		case filtered && api.ops.searchPage != nil:
+			if items, err = api.ops.searchPage(ctx, filter, sortFields, found, offset); err == nil {
+				ordered = true
+				items, truncated = capFound(api, items, offset)
+				all = toDtos(api, items)
+			}
+		case filtered && len(sortFields) > 0 && api.ops.searchSorted != nil:
+			if items, err = api.ops.searchSorted(ctx, filter, sortFields); err == nil {
+				loaded = len(items)
+				items, all, truncated = pageSorted(api, items, limit, offset)
+			}
+		case filtered:
+			if items, err = api.ops.search(ctx, filter); err == nil {
+				loaded = len(items)
+				items, all, truncated = sortAndPage(api, items, sortFields, limit, offset)
+			}
+		case (len(sortFields) > 0 && api.ops.findSorted != nil || len(sortFields) == 0 && api.ops.findPage != nil) && !inCap:
+			// The page is past MaxResults
+			all, truncated = []D{}, true
+		case len(sortFields) > 0 && api.ops.findSorted != nil:
+			if items, err = api.ops.findSorted(ctx, sortFields, found, offset); err == nil {
+				ordered = true
+				items, truncated = capFound(api, items, offset)
+				all = toDtos(api, items)
+			}
+		case len(sortFields) == 0 && api.ops.findPage != nil:
+			if items, err = api.ops.findPage(ctx, found, offset); err == nil {
+				ordered = true
+				items, truncated = capFound(api, items, offset)
+				all = toDtos(api, items)
+			}
+		default:
+			if items, err = api.ops.findAll(ctx); err == nil {
+				loaded = len(items)
+				items, all, truncated = sortAndPage(api, items, sortFields, limit, offset)
+			}
+		}
+		if errors.Is(err, errInvalidCursor) {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+		if err != nil {
+			return api.sendQueryError(c, err)
+		}
+		if truncated {
+			c.Set(HeaderResultsTruncated, "true")
+		}
+		var next string
+		if ordered && !truncated {
+			if next, err = api.nextCursor(items, sortFields, limit, start); err != nil {
+				return api.sendQueryError(c, err)
+			}
+		}
+		if next != "" {
+			c.Set(HeaderNextCursor, next)
+		}
+		// The Count can't count the items updated since a time, and a page after a cursor has no offset to link from
+		if after == nil {
+			total, err := api.setTotal(c, counted, since == nil && len(conditions) == 0 && !searchesMap, loaded, offset, len(all))
+			if err != nil {
+				return api.sendQueryError(c, err)
+			}
+			api.setPageLinks(c, limit, offset, len(all), total)
+		}
+		out, err := api.outgoingList(c, ActionGetAll, all)
+		if err != nil {
+			return sendCallbackError(c, err)
+		}
+		if fields != nil {
+			if out, err = withFields(out, fields); err != nil {
+				return sendCallbackError(c, err)
+			}
+		}
+		if expand != nil {
+			if out, err = api.expandList(c.UserContext(), out, items, expand); err != nil {
+				return sendCallbackError(c, err)
+			}
+		}
+		hal := !ndjson && wantsHAL(c)
+		if api.IncludeLinks && !hal {
+			if out, err = api.linkList(c, out, items); err != nil {
+				return sendCallbackError(c, err)
+			}
+		}
+		if ndjson {
+			return sendNDJSON(c, out, api.logger())
+		}
+		if hal {
+			if out, err = api.halList(c, out, items, len(all)); err != nil {
+				return sendCallbackError(c, err)
+			}
+			return sendTagged(c, out)
+		}
+		return sendTagged(c, api.list(out, len(all), limit, offset, truncated, next))
+	}
+}
+
+// parsePaging reads the limit and offset query parameters applying the Api default and maximum page sizes.
+// A limit of 0 means no limit.
+func parsePaging[T any, D any](c *fiber.Ctx, api Api[T, D]) (limit int, offset int, err error) {
+	return parseLimits(c, api.DefaultPageSize, api.MaxPageSize)
+}
+
+// parseLimits reads the limit and offset query parameters applying a default and maximum page size
+func parseLimits(c *fiber.Ctx, defaultPageSize int, maxPageSize int) (limit int, offset int, err error) {
+	limit = defaultPageSize
+	if s := c.Query("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 0 {
+			return 0, 0, errors.New("invalid limit " + s)
+		}
+	}
+	if s := c.Query("offset"); s != "" {
+		offset, err = strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid offset " + s)
+		}
+	}
+	if maxPageSize > 0 && (limit == 0 || limit > maxPageSize) {
+		limit = maxPageSize
+	}
+	return limit, offset, nil
+}
+
+// sortAndPage orders items by the sort fields (if any) and returns the requested page of items with their DTOs.
+// Without an Api Sort function the DTOs are sorted reflectively before paging.  Without sort fields SortDefault orders the items.
+// The sorted items are truncated to MaxResults before paging, truncated reports if they were.
+func sortAndPage[T any, D any](api Api[T, D], items []T, fields []SortField, limit int, offset int) ([]T, []D, bool) {
+	if len(fields) == 0 && api.SortDefault != nil {
+		items = append([]T(nil), items...) // sorted without changing the caller's slice
+		api.SortDefault(items)
+	}
+	if len(fields) > 0 && api.Sort != nil {
+		items = api.Sort(items, fields)
+	}
+	var truncated bool
+	if len(fields) == 0 || api.Sort != nil {
+		items, truncated = capList(api, items)
+		items = pageSlice(items, limit, offset)
+		return items, toDtos(api, items), truncated
+	}
+	items = append([]T(nil), items...) // sorted alongside the DTOs without changing the caller's slice
+	all := toDtos(api, items)
+	sortDtos(items, all, fields)
+	items, truncated = capList(api, items)
+	all = all[:len(items)]
+	return pageSlice(items, limit, offset), pageSlice(all, limit, offset), truncated
+}
+
+// pageSorted returns the requested page of items already ordered by the store with their DTOs.
+// The items are truncated to MaxResults before paging, truncated reports if they were.
+func pageSorted[T any, D any](api Api[T, D], items []T, limit int, offset int) ([]T, []D, bool) {
+	items, truncated := capList(api, items)
+	items = pageSlice(items, limit, offset)
+	return items, toDtos(api, items), truncated
+}
+
+// toDtos transforms a slice of T to a slice of D.
+// The result is never nil so an empty list is sent as [] rather than null.
+func toDtos[T any, D any](api Api[T, D], items []T) []D {
+	all := make([]D, 0, len(items))
+	for _, v := range items {
+		all = append(all, api.Dto(v))
+	}
+	return all
+}
+
+// sendError sends status with a JSON error body describing err, or with the ErrorHandler of the Api
+func sendError(c *fiber.Ctx, status int, err error) error {
+	if handler := errorHandler(c); handler != nil {
+		return handler(c, status, err)
+	}
+	return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+}
+
+// pageSlice returns the limit/offset window of items.
+func pageSlice[T any](items []T, limit int, offset int) []T {
+	if offset >= len(items) {
+		return items[:0]
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
 	}
+	return items
 }
 
 // getAll returns all entities as their Jdo type
 func search[T any, D any](api Api[T, D]) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Perms check
-		if api.Validator != nil && !api.Validator(c, ActionGetAll) {
-			return c.SendStatus(fiber.StatusUnauthorized)
+		if err := api.authorize(c, ActionSearch); err != nil {
+			return sendDenied(c, err)
 		}
 
 		var filter D
-		if err := c.BodyParser(&filter); err != nil {
-			log.Printf("Error parsing body %v\n", err)
-			return c.SendStatus(fiber.StatusBadRequest)
+		if err := api.parseBody(c, &filter); err != nil {
+			return api.sendBodyError(c, err)
+		}
+		if err := api.checkSearchable(filter); err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+		filter, err := api.transformIn(c, filter)
+		if err != nil {
+			return sendValidationError(c, err)
+		}
+		given := bodyFilterFields(c, filter)
+		searchesMap, err := api.searchesMap(given)
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+		sortFields, err := api.parseSort(c.Query("sort"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+		expand, err := api.parseExpand(c.Query("expand"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
 		}
 
-		// Search with filter
+		// Search with filter, sorted if requested
 		// Transform to DTO
 		// Send as JSON
+		ctx := c.UserContext()
+		var items []T
 		var all []D
-		for _, v := range api.Search(filter) {
-			all = append(all, api.Dto(v))
+		var truncated bool
+		if searchesMap && len(sortFields) > 0 && api.ops.searchMapSorted != nil {
+			if items, err = api.ops.searchMapSorted(ctx, given, sortFields); err == nil {
+				loaded := len(items)
+				items, all, truncated = pageSorted(api, items, 0, 0)
+				_, err = api.setTotal(c, nil, false, loaded, 0, len(all))
+			}
+		} else if searchesMap {
+			if items, err = api.ops.searchMap(ctx, given); err == nil {
+				loaded := len(items)
+				items, all, truncated = sortAndPage(api, items, sortFields, 0, 0)
+				_, err = api.setTotal(c, nil, false, loaded, 0, len(all))
+			}
+		} else if len(sortFields) > 0 && api.ops.searchSorted != nil {
+			if items, err = api.ops.searchSorted(ctx, filter, sortFields); err == nil {
+				loaded := len(items)
+				items, all, truncated = pageSorted(api, items, 0, 0)
+				_, err = api.setTotal(c, &filter, true, loaded, 0, len(all))
+			}
+		} else {
+			if items, err = api.ops.search(ctx, filter); err == nil {
+				loaded := len(items)
+				items, all, truncated = sortAndPage(api, items, sortFields, 0, 0)
+				_, err = api.setTotal(c, &filter, true, loaded, 0, len(all))
+			}
+		}
+		if err != nil {
+			return api.sendQueryError(c, err)
+		}
+		if truncated {
+			c.Set(HeaderResultsTruncated, "true")
+		}
+		out, err := api.outgoingList(c, ActionSearch, all)
+		if err != nil {
+			return sendCallbackError(c, err)
+		}
+		if expand != nil {
+			if out, err = api.expandList(c.UserContext(), out, items, expand); err != nil {
+				return sendCallbackError(c, err)
+			}
+		}
+		if wantsHAL(c) {
+			if out, err = api.halList(c, out, items, len(all)); err != nil {
+				return sendCallbackError(c, err)
+			}
+			return render(c, out)
+		}
+		if api.IncludeLinks {
+			if out, err = api.linkList(c, out, items); err != nil {
+				return sendCallbackError(c, err)
+			}
+		}
+		return render(c, api.list(out, len(all), 0, 0, truncated, ""))
+	}
+}
+
+// count returns {"count": N} for all entities, or those matching a filter.
+// The filter is read from the query parameters, or the body for a POST.
+func count[T any, D any](api Api[T, D]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Perms check
+		if err := api.authorize(c, ActionGetAll); err != nil {
+			return sendDenied(c, err)
+		}
+
+		var filter D
+		var conditions []Condition
+		filtered := false
+		var err error
+		if c.Method() == fiber.MethodPost {
+			if err = api.parseBody(c, &filter); err != nil {
+				return api.sendBodyError(c, err)
+			}
+			filtered = true
+		} else {
+			filter, conditions, filtered, err = bindQueryFilter[D](c)
+			if err != nil {
+				return sendError(c, fiber.StatusBadRequest, err)
+			}
+		}
+		if filtered {
+			if err := api.authorize(c, ActionSearch); err != nil {
+				return sendDenied(c, err)
+			}
+		}
+		if err := api.checkSearchable(filter, conditions...); err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+		var given map[string]any
+		if filtered {
+			if filter, err = api.transformIn(c, filter); err != nil {
+				return sendValidationError(c, err)
+			}
+			given = queryFilterFields(c, filter)
+			if c.Method() == fiber.MethodPost {
+				given = bodyFilterFields(c, filter)
+			}
+		}
+		searchesMap, err := api.searchesMap(given)
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+
+		ctx := c.UserContext()
+		var n int64
+		var items []T
+		switch {
+		case len(conditions) > 0 && api.ops.searchAdvanced == nil:
+			return sendError(c, fiber.StatusBadRequest, errConditionsUnsupported)
+		case len(conditions) > 0 && api.ops.countAdvanced != nil:
+			n, err = api.ops.countAdvanced(ctx, filter, conditions)
+		case len(conditions) > 0:
+			items, err = api.ops.searchAdvanced(ctx, filter, conditions)
+			n = int64(len(items))
+		case searchesMap && api.ops.countMap != nil:
+			n, err = api.ops.countMap(ctx, given)
+		case searchesMap:
+			items, err = api.ops.searchMap(ctx, given)
+			n = int64(len(items))
+		case api.ops.countAdvanced != nil:
+			n, err = api.ops.countAdvanced(ctx, filter, nil)
+		case api.ops.count != nil && filtered:
+			n, err = api.ops.count(ctx, &filter)
+		case api.ops.count != nil:
+			n, err = api.ops.count(ctx, nil)
+		case filtered && api.ops.search == nil:
+			return sendError(c, fiber.StatusBadRequest, errors.New("filtering is not supported"))
+		case filtered:
+			items, err = api.ops.search(ctx, filter)
+			n = int64(len(items))
+		default:
+			items, err = api.ops.findAll(ctx)
+			n = int64(len(items))
+		}
+		if err != nil {
+			return api.sendQueryError(c, err)
 		}
-		return c.JSON(all)
+		return render(c, countResponse{Count: n})
 	}
 }
 
-// getOne returns a single Jdo for a single item on the path.
+// getOne returns a single Jdo for a single item on the path, or for HEAD just its headers.
+// ?expand=children,... embeds the children of those SubEntities under their SubPath, ?expand=* embeds them all.
+// Lists and searches accept ?expand= too.
 // 404 if entity is not in the cache
+// 400 if ?fields= names a field that is not on the Jdo, or ?expand= a SubEntity that is not on the Api
+// 304 if If-None-Match matches the current ETag
 func getOne[T any, D any](api Api[T, D]) fiber.Handler {
+	return sendOne(api, func(c *fiber.Ctx) (T, bool, error) {
+		return api.ops.find(c.UserContext(), api.itemKey(c))
+	})
+}
+
+// sendOne returns the Jdo of the item found by find for the request, as getOne
+func sendOne[T any, D any](api Api[T, D], find func(c *fiber.Ctx) (T, bool, error)) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 
 		// Find the item
-		id := c.Params("id")
-		item, ok := api.Find(id)
+		item, ok, err := find(c)
+		if err != nil {
+			return api.sendFindError(c, err)
+		}
 		if !ok {
 			// don't leak existence information if unauthorized
-			if api.Validator != nil && !api.Validator(c, ActionGetOne) {
-				return c.SendStatus(fiber.StatusUnauthorized)
+			if err := api.authorize(c, ActionGetOne); err != nil {
+				return sendDenied(c, err)
 			}
-			return c.SendStatus(fiber.StatusNotFound)
+			return sendStatus(c, fiber.StatusNotFound)
 		}
 
 		// Perms check
-		if api.Validator != nil && !api.Validator(c, ActionGetOne, item) {
-			return c.SendStatus(fiber.StatusUnauthorized)
+		if err := api.authorize(c, ActionGetOne, item); err != nil {
+			return sendDenied(c, err)
 		}
 
-		// Return DTO JSON
-		return c.JSON(api.Dto(item))
+		// Return DTO JSON, restricted to the requested fields, with any requested SubEntities embedded
+		fields, err := parseFields[D](c.Query("fields"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+		expand, err := api.parseExpand(c.Query("expand"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+		out, whole, err := api.representOne(c, item, fields, expand)
+		if err != nil {
+			return sendCallbackError(c, err)
+		}
+		b, mime, etag, err := api.taggedOne(c, item, out, whole)
+		if err != nil {
+			return sendEncodeError(c, err)
+		}
+		c.Set(fiber.HeaderETag, etag)
+		if notModified(c, etag) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+		c.Set(fiber.HeaderContentType, mime)
+		return c.Send(b)
+	}
+}
+
+// representOne returns the response of a GET of item for the request, its outgoing Jdo restricted to fields and with
+// the SubEntities of expand.  whole is false if the response isn't the item's whole Jdo, as it is for every client.
+func (api Api[T, D]) representOne(c *fiber.Ctx, item T, fields [][]string, expand []SubEntity[T, D]) (out any, whole bool, err error) {
+	if out, err = api.outgoing(c, ActionGetOne, api.Dto(item)); err != nil {
+		return nil, false, err
+	}
+	whole = fields == nil && expand == nil && api.Redact == nil && api.TransformOut == nil
+	if fields != nil {
+		if out, err = withFields(out, fields); err != nil {
+			return nil, false, err
+		}
 	}
+	if expand != nil {
+		if out, err = api.expandOne(c.UserContext(), out, item, expand); err != nil {
+			return nil, false, err
+		}
+	}
+	if wantsHAL(c) {
+		out, err = api.halOne(c, out, item)
+		return out, false, err
+	}
+	if api.IncludeLinks {
+		if out, err = api.linkOne(c, out, item); err != nil {
+			return nil, false, err
+		}
+	}
+	return api.one(out), whole, nil
 }
 
 func createOne[T any, D any](api Api[T, D]) fiber.Handler {
@@ -183,116 +1159,418 @@ func createOne[T any, D any](api Api[T, D]) fiber.Handler {
 		// We don't need to check if creation is enabled because the POST function won't be registered
 
 		var amended D
-		if err := c.BodyParser(&amended); err != nil {
-			log.Printf("Error parsing body %v\n", err)
-			return c.SendStatus(fiber.StatusBadRequest)
+		if err := api.parseBody(c, &amended); err != nil {
+			return api.sendBodyError(c, err)
 		}
 
-		if api.Validator != nil && !api.Validator(c, ActionCreate) {
-			return c.SendStatus(fiber.StatusUnauthorized)
+		if err := api.authorizeIncoming(c, ActionCreate, &amended); err != nil {
+			return sendDenied(c, err)
+		}
+		if err := api.transformAndValidate(c, &amended); err != nil {
+			return sendValidationError(c, err)
 		}
 
 		// Create
-		item, err := api.Create(amended)
+		item, err := api.ops.create(c.UserContext(), amended)
 		if err != nil {
-			log.Printf("Error creating item: %v, %v\n", item, err)
-			return c.SendStatus(fiber.StatusInternalServerError)
+			api.logger().Errorf("Error creating item in %s: %v, %v\n", api.Path, amended, err)
+			return sendCallbackError(c, err)
 		}
-		return c.JSON(api.Dto(item))
+		api.notifyChange(ActionCreate, nil, &item)
+		if api.CreatedStatus {
+			if api.Key != nil {
+				c.Location(strings.TrimSuffix(c.Path(), "/") + "/" + api.keyPath(api.Key(item)))
+			}
+			c.Status(fiber.StatusCreated)
+		}
+		return api.sendItem(c, ActionCreate, item)
 	}
 }
 
 // mutateOne returns a single Jdo for a single item on the path after mutation from the supplied Jdo JSON in the body
-// 404 if entity is not in the cache
+// 404 if entity is not in the cache, unless UpsertOnPut is set when it is created with 201
 // 400 if the body cannot be parsed or the mime type is not json
+// 412 if If-Match is set and doesn't match the current ETag
 func mutateOne[T any, D any](api Api[T, D]) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 
 		// Parse the body
 		var amended D
-		if err := c.BodyParser(&amended); err != nil {
-			log.Printf("Error parsing body %v\n", err)
-			return c.SendStatus(fiber.StatusBadRequest)
+		if err := api.parseBody(c, &amended); err != nil {
+			return api.sendBodyError(c, err)
 		}
 
 		// Find the item
-		id := c.Params("id")
-		item, ok := api.Find(id)
-		var err error
+		id := api.itemKey(c)
+		item, ok, err := api.ops.find(c.UserContext(), id)
+		if err != nil {
+			return api.sendFindError(c, err)
+		}
+		if !ok && api.upsert() {
+			return upsertOne(c, api, id, amended)
+		}
 		if !ok {
 			// Perms check for creation
-			if api.Validator != nil && !api.Validator(c, ActionMutate) {
-				return c.SendStatus(fiber.StatusUnauthorized)
+			if err := api.authorizeIncoming(c, ActionMutate, &amended); err != nil {
+				return sendDenied(c, err)
 			}
 			// If not found
-			return c.SendStatus(fiber.StatusNotFound)
+			return sendStatus(c, fiber.StatusNotFound)
 		} else {
 			// Perms check
-			if api.Validator != nil && !api.Validator(c, ActionMutate, item) {
-				return c.SendStatus(fiber.StatusUnauthorized)
+			if err := api.authorizeIncoming(c, ActionMutate, &amended, item); err != nil {
+				return sendDenied(c, err)
 			}
-			item, err = api.Mutate(item, amended)
+			if err := api.transformAndValidate(c, &amended); err != nil {
+				return sendValidationError(c, err)
+			}
+			if !api.ifMatch(c, item) {
+				return sendStatus(c, fiber.StatusPreconditionFailed)
+			}
+			before := item
+			item, err = api.ops.mutate(c.UserContext(), item, amended)
 			if err != nil {
-				log.Printf("Error mutating item: %v, %v\n", item, err)
-				return c.SendStatus(fiber.StatusInternalServerError)
+				api.logger().Errorf("Error mutating item: %v, %v\n", item, err)
+				return sendCallbackError(c, err)
 			}
+			api.notifyChange(ActionMutate, &before, &item)
 		}
 
-		return c.JSON(api.Dto(item))
+		return api.sendItem(c, ActionMutate, item)
+	}
+}
+
+// upsert is true if PUT creates missing items
+func (api Api[T, D]) upsert() bool {
+	return api.UpsertOnPut && api.SetKey != nil && api.ops.create != nil
+}
+
+// upsertOne creates the item for a PUT to the missing key id, with the key from the path
+// 201 with the created Jdo
+// 400 if the key cannot be set on the Jdo
+func upsertOne[T any, D any](c *fiber.Ctx, api Api[T, D], id string, amended D) error {
+	if err := api.reservedKey(id); err != nil {
+		return sendCallbackError(c, err)
+	}
+	if err := api.SetKey(&amended, id); err != nil {
+		return sendError(c, fiber.StatusBadRequest, err)
+	}
+	if err := api.authorizeIncoming(c, ActionCreate, &amended); err != nil {
+		return sendDenied(c, err)
+	}
+	if err := api.transformAndValidate(c, &amended); err != nil {
+		return sendValidationError(c, err)
+	}
+	item, err := api.ops.create(c.UserContext(), amended)
+	if err != nil {
+		api.logger().Errorf("Error creating item in %s: %v, %v\n", api.Path, id, err)
+		return sendCallbackError(c, err)
+	}
+	api.notifyChange(ActionCreate, nil, &item)
+	return api.sendItem(c.Status(fiber.StatusCreated), ActionCreate, item)
+}
+
+// patchOne returns a single Jdo for a single item on the path after applying the fields in the JSON body.
+// Only the fields present in the body are changed.
+// 404 if entity is not in the cache
+// 400 if the body cannot be parsed or names fields that are not on the Jdo
+// 412 if If-Match is set and doesn't match the current ETag
+func patchOne[T any, D any](api Api[T, D]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+
+		// Parse the body
+		body, err := api.parsePatch(c)
+		if err != nil {
+			return api.sendBodyError(c, err)
+		}
+		if err := validatePatch[D](body.fields); err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+
+		// Find the item
+		id := api.itemKey(c)
+		item, ok, err := api.ops.find(c.UserContext(), id)
+		if err != nil {
+			return api.sendFindError(c, err)
+		}
+		if !ok {
+			// don't leak existence information if unauthorized
+			if err := api.authorize(c, ActionMutate); err != nil {
+				return sendDenied(c, err)
+			}
+			return sendStatus(c, fiber.StatusNotFound)
+		}
+
+		// Merge and JSON patches are applied to the current Jdo
+		fields, err := patchFields(api.Dto(item), body)
+		var opErr patchOpError
+		if errors.As(err, &opErr) {
+			return sendPatchOpError(c, opErr)
+		}
+		if err != nil {
+			return sendCallbackError(c, err)
+		}
+
+		// Perms check, with the patched Jdo as the incoming item
+		patched := patchDto(api.Dto(item), fields)
+		if err := api.authorizeIncoming(c, ActionMutate, &patched, item); err != nil {
+			return sendDenied(c, err)
+		}
+		if err := api.validate(patched); err != nil {
+			return sendValidationError(c, err)
+		}
+		if !api.ifMatch(c, item) {
+			return sendStatus(c, fiber.StatusPreconditionFailed)
+		}
+		before := item
+		item, err = api.ops.patch(c.UserContext(), item, fields)
+		if err != nil {
+			api.logger().Errorf("Error patching item: %v, %v\n", item, err)
+			return sendCallbackError(c, err)
+		}
+		api.notifyChange(ActionMutate, &before, &item)
+
+		return api.sendItem(c, ActionMutate, item)
 	}
 }
 
 // deleteOne returns a single Jdo for a single item on the path after mutation/deletion
 // 404 if entity is not in the cache
+// 412 if If-Match is set and doesn't match the current ETag
 func deleteOne[T any, D any](api Api[T, D]) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 
-		id := c.Params("id")
-		item, ok := api.Find(id)
+		id := api.itemKey(c)
+		item, ok, err := api.ops.find(c.UserContext(), id)
+		if err != nil {
+			return api.sendFindError(c, err)
+		}
 		if !ok {
 			// don't leak existence information if unauthorized
-			if api.Validator != nil && !api.Validator(c, ActionDelete) {
-				return c.SendStatus(fiber.StatusUnauthorized)
+			if err := api.authorize(c, ActionDelete); err != nil {
+				return sendDenied(c, err)
 			}
-			return c.SendStatus(fiber.StatusNotFound)
+			return sendStatus(c, fiber.StatusNotFound)
 		}
 
-		if api.Validator != nil && !api.Validator(c, ActionDelete, item) {
-			return c.SendStatus(fiber.StatusUnauthorized)
+		if err := api.authorize(c, ActionDelete, item); err != nil {
+			return sendDenied(c, err)
 		}
 
-		var err error
-		item, err = api.Delete(item)
+		if !api.ifMatch(c, item) {
+			return sendStatus(c, fiber.StatusPreconditionFailed)
+		}
+		before := item
+		item, err = api.ops.delete(c.UserContext(), item)
 		if err != nil {
-			log.Printf("Error deleting item: %v\n", err)
-			return c.SendStatus(fiber.StatusInternalServerError)
+			api.logger().Errorf("Error deleting item: %v\n", err)
+			return sendCallbackError(c, err)
 		}
+		api.notifyChange(ActionDelete, &before, nil)
 
-		return c.SendString("deleted")
+		switch api.DeleteResponse {
+		case DeleteResponseNoContent:
+			return c.SendStatus(fiber.StatusNoContent)
+		case DeleteResponseDto:
+			return api.sendItem(c, ActionDelete, item)
+		default:
+			return c.SendString("deleted")
+		}
 	}
 }
 
 // getSubEntity fulfils a request for a SubEntity of the request item :id, supplied by the getter function
+// The list is paged with the limit and offset query parameters.
 // 404 if entity is not in the cache
-func getSubEntity[T any, D any](api Api[T, D], getter func(entity T) []any) fiber.Handler {
+// 400 if the paging parameters are invalid
+func getSubEntity[T any, D any](api Api[T, D], sub SubEntity[T, D]) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 
-		id := c.Params("id")
-		item, ok := api.Find(id)
+		limit, offset, err := parseLimits(c, sub.DefaultPageSize, api.MaxPageSize)
+		if err != nil {
+			api.logger().Warnf("Error parsing paging parameters %v\n", err)
+			return sendStatus(c, fiber.StatusBadRequest)
+		}
+
+		// A paged getter loads its own children, so only the keys of the item are needed
+		find := api.ops.find
+		if sub.GetPage != nil {
+			find = api.ops.findKey
+		}
+		id := api.itemKey(c)
+		item, ok, err := find(c.UserContext(), id)
+		if err != nil {
+			return api.sendFindError(c, err)
+		}
 		if !ok {
 			// don't leak existence information if unauthorized
-			if api.Validator != nil && !api.Validator(c, ActionGetOne) {
-				return c.SendStatus(fiber.StatusUnauthorized)
+			if err := api.authorize(c, ActionGetOne); err != nil {
+				return sendDenied(c, err)
 			}
-			return c.SendStatus(fiber.StatusNotFound)
+			return sendStatus(c, fiber.StatusNotFound)
 		}
 
-		if api.Validator != nil && !api.Validator(c, ActionGetOne, item) {
-			return c.SendStatus(fiber.StatusUnauthorized)
+		if err := api.authorize(c, ActionGetOne, item); err != nil {
+			return sendDenied(c, err)
 		}
 
-		subAll := getter(item)
-		return c.JSON(subAll)
+		subAll, err := pageChildren(c.UserContext(), sub, item, limit, offset)
+		if err != nil {
+			return api.sendQueryError(c, err)
+		}
+		return render(c, api.list(subAll, len(subAll), limit, offset, false, ""))
 	}
 
 }
+
+// children returns every child of item from GetCtx, or Get
+func (sub SubEntity[T, D]) children(ctx context.Context, item T) []any {
+	if sub.GetCtx != nil {
+		return sub.GetCtx(ctx, item)
+	}
+	return sub.Get(item)
+}
+
+// pageChildren returns a page of the children of parent from sub, transformed by its Dto
+func pageChildren[P any, Q any](ctx context.Context, sub SubEntity[P, Q], parent P, limit, offset int) ([]any, error) {
+	var children []any
+	if sub.GetPage != nil {
+		var err error
+		if children, err = sub.GetPage(ctx, parent, limit, offset); err != nil {
+			return nil, err
+		}
+	} else {
+		all := sub.children(ctx, parent)
+		if sub.Sort != nil {
+			all = append([]any(nil), all...) // Get may return the children held by parent
+			sort.SliceStable(all, func(i, j int) bool { return sub.Sort(all[i], all[j]) })
+		}
+		children = pageSlice(all, limit, offset)
+	}
+	if children == nil {
+		children = []any{} // an empty list is [] rather than null
+	}
+	if sub.Dto != nil {
+		dtos := make([]any, 0, len(children))
+		for _, child := range children {
+			dtos = append(dtos, sub.Dto(child))
+		}
+		children = dtos
+	}
+	return children, nil
+}
+
+// getSubEntityItem fulfils a request for a single child :childId of a SubEntity of the request item :id
+// 404 if the entity is not in the cache or it has no matching child
+func getSubEntityItem[T any, D any](api Api[T, D], sub SubEntity[T, D]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+
+		// A child getter loads its own child, so only the keys of the item are needed
+		find := api.ops.find
+		if sub.GetOne != nil {
+			find = api.ops.findKey
+		}
+		item, done, err := findParent(c, api, find)
+		if done {
+			return err
+		}
+		var child any
+		var ok bool
+		if sub.GetOne != nil {
+			if child, ok, err = sub.GetOne(c.UserContext(), item, pathKey(c, "childId")); err != nil {
+				return api.sendQueryError(c, err)
+			}
+		} else {
+			child, ok = findChild(sub.children(c.UserContext(), item), sub.Key, pathKey(c, "childId"))
+		}
+		if !ok {
+			return sendStatus(c, fiber.StatusNotFound)
+		}
+		if sub.Dto != nil {
+			child = sub.Dto(child)
+		}
+		return render(c, api.one(child))
+	}
+}
+
+// addSubEntity adds a child built from the request body to a SubEntity of the request item :id
+// 404 if the entity is not in the cache
+func addSubEntity[T any, D any](api Api[T, D], sub SubEntity[T, D]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+
+		id := api.itemKey(c)
+		item, ok, err := api.ops.findShallow(c.UserContext(), id)
+		if err != nil {
+			return api.sendFindError(c, err)
+		}
+		if !ok {
+			// don't leak existence information if unauthorized
+			if err := api.authorize(c, ActionMutate); err != nil {
+				return sendDenied(c, err)
+			}
+			return sendStatus(c, fiber.StatusNotFound)
+		}
+
+		if err := api.authorize(c, ActionMutate, item); err != nil {
+			return sendDenied(c, err)
+		}
+
+		var bodyErr error
+		child, err := sub.Add(c.UserContext(), item, func(child any) error {
+			bodyErr = api.parseBody(c, child)
+			return bodyErr
+		})
+		if bodyErr != nil {
+			return api.sendBodyError(c, bodyErr)
+		}
+		if err != nil {
+			api.logger().Errorf("Error adding %s to item %s: %v\n", sub.SubPath, id, err)
+			return sendCallbackError(c, err)
+		}
+		// The key is of the child as added, before its Dto
+		if api.CreatedStatus {
+			if sub.Key != nil {
+				c.Location(strings.TrimSuffix(c.Path(), "/") + "/" + url.PathEscape(sub.Key(child)))
+			}
+			c.Status(fiber.StatusCreated)
+		}
+		if sub.Dto != nil {
+			child = sub.Dto(child)
+		}
+		return render(c, api.one(child))
+	}
+}
+
+// removeSubEntity removes the child :childId from a SubEntity of the request item :id
+// 404 if the entity is not in the cache, or the remover returns ErrNotFound
+func removeSubEntity[T any, D any](api Api[T, D], sub SubEntity[T, D]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+
+		id := api.itemKey(c)
+		item, ok, err := api.ops.findShallow(c.UserContext(), id)
+		if err != nil {
+			return api.sendFindError(c, err)
+		}
+		if !ok {
+			// don't leak existence information if unauthorized
+			if err := api.authorize(c, ActionMutate); err != nil {
+				return sendDenied(c, err)
+			}
+			return sendStatus(c, fiber.StatusNotFound)
+		}
+
+		if err := api.authorize(c, ActionMutate, item); err != nil {
+			return sendDenied(c, err)
+		}
+
+		if err := sub.Remove(c.UserContext(), item, pathKey(c, "childId")); err != nil {
+			api.logger().Errorf("Error removing %s from item %s: %v\n", sub.SubPath, id, err)
+			return sendCallbackError(c, err)
+		}
+
+		if api.DeleteResponse == DeleteResponseNoContent {
+			return c.SendStatus(fiber.StatusNoContent)
+		}
+		return c.SendString("deleted")
+	}
+}
@@ -23,14 +23,35 @@
 package easyrest
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/fasthttp/websocket"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	jsoniter "github.com/json-iterator/go"
 	"github.com/pilotso11/go-easyrest/util"
 	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 type ChildItem struct {
@@ -79,12 +100,51 @@ type TestData struct {
 
 func setup() (*fiber.App, *TestData) {
 	app := fiber.New()
-	data := TestData{
+	data := &TestData{
 		entries: make(map[string]TestItem),
 	}
 
 	// This is a full controller
-	fullApi := Api[TestItem, TestItemDto]{
+	fullApi := newTestApi(data)
+
+	_, _ = fullApi.Create(TestItemDto{"id1", "original data"})
+	_, _ = fullApi.Create(TestItemDto{"id2", "original data2"})
+
+	editOnlyApi := Api[TestItem, TestItemDto]{
+		Path:        "test2",
+		Find:        fullApi.Find,
+		FindAll:     fullApi.FindAll,
+		Mutate:      fullApi.Mutate,
+		Create:      nil,
+		Delete:      nil,
+		SubEntities: nil,
+		Validator:   fullApi.Validator,
+		Dto:         ItemToDto,
+	}
+
+	readOnlyApi := Api[TestItem, TestItemDto]{
+		Path:        "test3",
+		Find:        fullApi.Find,
+		FindAll:     fullApi.FindAll,
+		Mutate:      nil,
+		Create:      nil,
+		Delete:      nil,
+		SubEntities: nil,
+		Validator:   nil,
+		Dto:         ItemToDto,
+	}
+
+	RegisterAPI(app, fullApi)
+	RegisterAPI(app, readOnlyApi)
+	RegisterAPI(app, editOnlyApi)
+
+	return app, data
+
+}
+
+// newTestApi creates the full controller backed by data
+func newTestApi(data *TestData) Api[TestItem, TestItemDto] {
+	return Api[TestItem, TestItemDto]{
 		Path: "test",
 		Find: func(key string) (TestItem, bool) {
 			data.lock.Lock()
@@ -124,6 +184,18 @@ func setup() (*fiber.App, *TestData) {
 			return item, nil
 
 		},
+		Patch: func(item TestItem, fields map[string]any) (TestItem, error) {
+			data.lock.Lock()
+			defer data.lock.Unlock()
+			if data.fail {
+				return TestItem{}, errors.New("patch error")
+			}
+			if v, ok := fields["Data"]; ok {
+				item.Data, _ = v.(string)
+			}
+			data.entries[item.Id] = item
+			return item, nil
+		},
 		Create: func(dto TestItemDto) (TestItem, error) {
 			data.lock.Lock()
 			defer data.lock.Unlock()
@@ -148,7 +220,7 @@ func setup() (*fiber.App, *TestData) {
 			return item, nil
 		},
 		SubEntities: []SubEntity[TestItem, TestItemDto]{
-			{"children", func(item TestItem) []any {
+			{SubPath: "children", Get: func(item TestItem) []any {
 				var ret []any
 				for _, c := range item.Children {
 					ret = append(ret, c)
@@ -159,42 +231,9 @@ func setup() (*fiber.App, *TestData) {
 		Validator: func(ctx *fiber.Ctx, action Action, item ...TestItem) bool {
 			return data.permit
 		},
-		Dto: ItemToDto,
-	}
-
-	_, _ = fullApi.Create(TestItemDto{"id1", "original data"})
-	_, _ = fullApi.Create(TestItemDto{"id2", "original data2"})
-
-	editOnlyApi := Api[TestItem, TestItemDto]{
-		Path:        "test2",
-		Find:        fullApi.Find,
-		FindAll:     fullApi.FindAll,
-		Mutate:      fullApi.Mutate,
-		Create:      nil,
-		Delete:      nil,
-		SubEntities: nil,
-		Validator:   fullApi.Validator,
-		Dto:         ItemToDto,
-	}
-
-	readOnlyApi := Api[TestItem, TestItemDto]{
-		Path:        "test3",
-		Find:        fullApi.Find,
-		FindAll:     fullApi.FindAll,
-		Mutate:      nil,
-		Create:      nil,
-		Delete:      nil,
-		SubEntities: nil,
-		Validator:   nil,
 		Dto:         ItemToDto,
+		QueryFilter: true,
 	}
-
-	RegisterAPI(app, fullApi)
-	RegisterAPI(app, readOnlyApi)
-	RegisterAPI(app, editOnlyApi)
-
-	return app, &data
-
 }
 
 func cleanup(app *fiber.App) {
@@ -563,6 +602,29 @@ func TestRemoveOne(t *testing.T) {
 		code, resp, err = util.GetStringRequestResponse(app, "DELETE", "/test/id2", "")
 		assert.Equal(t, 500, code)
 
+		// 204 No Content mode
+		data.fail = false
+		api := newTestApi(data)
+		api.Path = "test204"
+		api.DeleteResponse = DeleteResponseNoContent
+		RegisterAPI(app, api)
+		code, resp, err = util.GetStringRequestResponse(app, "DELETE", "/test204/id2", "")
+		assert.Nil(t, err)
+		assert.Equal(t, 204, code)
+		assert.Empty(t, resp)
+		_, ok = data.entries["id2"]
+		assert.False(t, ok)
+
+		// Dto mode
+		data.entries["id3"] = TestItem{Id: "id3", Data: "data3"}
+		api.Path = "testdto"
+		api.DeleteResponse = DeleteResponseDto
+		RegisterAPI(app, api)
+		code, dto, err := util.GetJsonRequestResponse(app, "DELETE", "/testdto/id3", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "id3", dto["Id"])
+		assert.Equal(t, "data3", dto["Data"])
 	})
 
 }
@@ -642,3 +704,4740 @@ func TestFilterBadBody(t *testing.T) {
 
 	})
 }
+
+func setupPaging(findPage bool) (*fiber.App, *int) {
+	app := fiber.New()
+	var items []TestItem
+	for i := 0; i < 10; i++ {
+		items = append(items, TestItem{Id: fmt.Sprintf("id%02d", i), Data: "data"})
+	}
+	pageCalls := 0
+	api := Api[TestItem, TestItemDto]{
+		Path: "testp",
+		Find: func(key string) (TestItem, bool) {
+			return TestItem{}, false
+		},
+		FindAll: func() []TestItem {
+			return items
+		},
+		Dto:             ItemToDto,
+		DefaultPageSize: 4,
+		MaxPageSize:     5,
+	}
+	if findPage {
+		api.FindPage = func(limit, offset int) []TestItem {
+			pageCalls++
+			return pageSlice(items, limit, offset)
+		}
+	}
+	RegisterAPI(app, api)
+	return app, &pageCalls
+}
+
+func TestGetAllPaging(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, _ := setupPaging(false)
+		defer cleanup(app)
+
+		// Default page size
+		code, resp, err := util.GetJsonSliceRequestResponse(app, "GET", "/testp/", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.Len(t, resp, 4)
+		assert.Equal(t, "id00", resp[0]["Id"])
+
+		code, resp, err = util.GetJsonSliceRequestResponse(app, "GET", "/testp/?limit=2&offset=3", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.Len(t, resp, 2)
+		assert.Equal(t, "id03", resp[0]["Id"])
+		assert.Equal(t, "id04", resp[1]["Id"])
+
+		// Max page size is enforced
+		code, resp, _ = util.GetJsonSliceRequestResponse(app, "GET", "/testp/?limit=100", nil)
+		assert.Equal(t, 200, code)
+		assert.Len(t, resp, 5)
+
+		// Partial last page and past the end
+		code, resp, _ = util.GetJsonSliceRequestResponse(app, "GET", "/testp/?limit=4&offset=8", nil)
+		assert.Equal(t, 200, code)
+		assert.Len(t, resp, 2)
+		code, resp, _ = util.GetJsonSliceRequestResponse(app, "GET", "/testp/?offset=20", nil)
+		assert.Equal(t, 200, code)
+		assert.Len(t, resp, 0)
+	})
+}
+
+func TestGetAllPagingFindPage(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, calls := setupPaging(true)
+		defer cleanup(app)
+
+		code, resp, err := util.GetJsonSliceRequestResponse(app, "GET", "/testp/?limit=3&offset=6", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.Len(t, resp, 3)
+		assert.Equal(t, "id06", resp[0]["Id"])
+		assert.Equal(t, 1, *calls)
+	})
+}
+
+func TestGetAllPagingBadParams(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, _ := setupPaging(false)
+		defer cleanup(app)
+
+		code, _, _ := util.GetJsonSliceRequestResponse(app, "GET", "/testp/?limit=-1", nil)
+		assert.Equal(t, 400, code)
+		code, _, _ = util.GetJsonSliceRequestResponse(app, "GET", "/testp/?offset=-5", nil)
+		assert.Equal(t, 400, code)
+		code, _, _ = util.GetJsonSliceRequestResponse(app, "GET", "/testp/?limit=ten", nil)
+		assert.Equal(t, 400, code)
+	})
+}
+
+func TestGetAllSort(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		data.entries["id3"] = TestItem{Id: "id3", Data: "original data"}
+		data.entries["id0"] = TestItem{Id: "id0", Data: "more data"}
+
+		code, resp, err := util.GetJsonSliceRequestResponse(app, "GET", "/test/?sort=-Id", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		if assert.Len(t, resp, 4) {
+			assert.Equal(t, "id3", resp[0]["Id"])
+			assert.Equal(t, "id0", resp[3]["Id"])
+		}
+
+		// Multi-field, first ascending then descending
+		code, resp, err = util.GetJsonSliceRequestResponse(app, "GET", "/test/?sort=Data,-Id", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		if assert.Len(t, resp, 4) {
+			assert.Equal(t, "id0", resp[0]["Id"])
+			assert.Equal(t, "id3", resp[1]["Id"])
+			assert.Equal(t, "id1", resp[2]["Id"])
+			assert.Equal(t, "id2", resp[3]["Id"])
+		}
+
+		// Sorting happens before paging
+		code, resp, _ = util.GetJsonSliceRequestResponse(app, "GET", "/test/?sort=Id&limit=2&offset=1", nil)
+		assert.Equal(t, 200, code)
+		if assert.Len(t, resp, 2) {
+			assert.Equal(t, "id1", resp[0]["Id"])
+			assert.Equal(t, "id2", resp[1]["Id"])
+		}
+	})
+}
+
+func TestGetAllSortUnknownField(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+
+		code, resp, _ := util.GetJsonRequestResponse(app, "GET", "/test/?sort=Id,-Missing", nil)
+		assert.Equal(t, 400, code)
+		assert.Contains(t, resp["error"], "Missing")
+
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/test/filter?sort=Children", TestItemDto{})
+		assert.Equal(t, 400, code)
+	})
+}
+
+func TestFilterSort(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+
+		code, resp, err := util.GetJsonSliceRequestResponse(app, "POST", "/test/filter?sort=-Id", TestItemDto{Data: "data"})
+		assert.Equal(t, 200, code)
+		assert.Nil(t, err)
+		if assert.Len(t, resp, 2) {
+			assert.Equal(t, "id2", resp[0]["Id"])
+			assert.Equal(t, "id1", resp[1]["Id"])
+		}
+	})
+}
+
+func TestGetAllCustomSort(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		var calledWith []SortField
+		RegisterAPI(app, Api[TestItem, TestItemDto]{
+			Path: "tests",
+			Find: func(key string) (TestItem, bool) { return TestItem{}, false },
+			FindAll: func() []TestItem {
+				return []TestItem{{Id: "a"}, {Id: "b"}}
+			},
+			Sort: func(items []TestItem, fields []SortField) []TestItem {
+				calledWith = fields
+				return []TestItem{items[1], items[0]}
+			},
+			Dto: ItemToDto,
+		})
+
+		code, resp, _ := util.GetJsonSliceRequestResponse(app, "GET", "/tests/?sort=Data", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, []SortField{{Field: "Data"}}, calledWith)
+		if assert.Len(t, resp, 2) {
+			assert.Equal(t, "b", resp[0]["Id"])
+		}
+	})
+}
+
+func TestGetAllSortDefault(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		data.entries["id3"] = TestItem{Id: "id3", Data: "data3"}
+		api := newTestApi(data)
+		api.Path = "testsd"
+		api.SortDefault = func(items []TestItem) {
+			sort.Slice(items, func(i, j int) bool { return items[i].Id > items[j].Id })
+		}
+		RegisterAPI(app, api)
+
+		ids := func(url string) []any {
+			code, resp, _ := util.GetJsonSliceRequestResponse(app, "GET", url, nil)
+			assert.Equal(t, 200, code)
+			var ids []any
+			for _, item := range resp {
+				ids = append(ids, item["Id"])
+			}
+			return ids
+		}
+		// The map of entries is found in a random order
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, []any{"id3", "id2", "id1"}, ids("/testsd/"))
+			assert.Equal(t, []any{"id2"}, ids("/testsd/?limit=1&offset=1"))
+		}
+		assert.Equal(t, []any{"id1", "id2", "id3"}, ids("/testsd/?sort=Id"))
+	})
+}
+
+func TestMaxResults(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		data.entries["id3"] = TestItem{Id: "id3", Data: "data3"}
+		api := newTestApi(data)
+		api.Path = "testmax"
+		api.MaxResults = 2
+		api.SortDefault = func(items []TestItem) {
+			sort.Slice(items, func(i, j int) bool { return items[i].Id < items[j].Id })
+		}
+		RegisterAPI(app, api)
+		paged := newTestApi(data)
+		paged.Path = "testmaxpaged"
+		paged.MaxResults = 2
+		var found []int
+		paged.FindPage = func(limit, offset int) []TestItem {
+			found = append(found, limit)
+			return pageSlice([]TestItem{data.entries["id1"], data.entries["id2"], data.entries["id3"]}, limit, offset)
+		}
+		RegisterAPI(app, paged)
+
+		get := func(method, url string) (string, []any) {
+			req := httptest.NewRequest(method, url, strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			assert.Equal(t, 200, resp.StatusCode)
+			var ret []map[string]any
+			_ = json.NewDecoder(resp.Body).Decode(&ret)
+			var ids []any
+			for _, item := range ret {
+				ids = append(ids, item["Id"])
+			}
+			return resp.Header.Get(HeaderResultsTruncated), ids
+		}
+
+		truncated, ids := get("GET", "/testmax/")
+		assert.Equal(t, "true", truncated)
+		assert.Equal(t, []any{"id1", "id2"}, ids)
+		truncated, ids = get("POST", "/testmax/filter")
+		assert.Equal(t, "true", truncated)
+		assert.Equal(t, []any{"id1", "id2"}, ids)
+		truncated, ids = get("GET", "/testmax/?sort=-Id")
+		assert.Equal(t, "true", truncated)
+		assert.Equal(t, []any{"id3", "id2"}, ids)
+
+		// Pages are within the truncated list
+		truncated, ids = get("GET", "/testmax/?limit=1&offset=1")
+		assert.Equal(t, "true", truncated)
+		assert.Equal(t, []any{"id2"}, ids)
+		truncated, ids = get("GET", "/testmax/?limit=1&offset=2")
+		assert.Equal(t, "true", truncated)
+		assert.Nil(t, ids)
+		truncated, ids = get("GET", "/testmax/?Id=id1")
+		assert.Equal(t, "", truncated)
+		assert.Equal(t, []any{"id1"}, ids)
+
+		// A store page is found with at most MaxResults+1 items
+		truncated, ids = get("GET", "/testmaxpaged/")
+		assert.Equal(t, "true", truncated)
+		assert.Equal(t, []any{"id1", "id2"}, ids)
+		truncated, ids = get("GET", "/testmaxpaged/?limit=1&offset=1")
+		assert.Equal(t, "", truncated)
+		assert.Equal(t, []any{"id2"}, ids)
+		truncated, ids = get("GET", "/testmaxpaged/?limit=5&offset=1")
+		assert.Equal(t, "true", truncated)
+		assert.Equal(t, []any{"id2"}, ids)
+		truncated, _ = get("GET", "/testmaxpaged/?offset=5")
+		assert.Equal(t, "true", truncated)
+		assert.Equal(t, []int{3, 1, 2}, found)
+	})
+}
+
+func TestTotalCount(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		data.entries["id3"] = TestItem{Id: "id3", Data: "data3"}
+		ranged := newTestApi(data)
+		ranged.Path = "testrange"
+		ranged.TotalHeader = fiber.HeaderContentRange
+		var filters []*TestItemDto
+		ranged.Count = func(filter *TestItemDto) (int64, error) {
+			filters = append(filters, filter)
+			return 42, nil
+		}
+		RegisterAPI(app, ranged)
+
+		get := func(method, url, header string) string {
+			req := httptest.NewRequest(method, url, strings.NewReader(`{"Data":"data3"}`))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			assert.Equal(t, 200, resp.StatusCode)
+			return resp.Header.Get(header)
+		}
+
+		// The length of the whole list without Count
+		assert.Equal(t, "3", get("GET", "/test/", HeaderTotalCount))
+		assert.Equal(t, "3", get("GET", "/test/?limit=1&offset=1", HeaderTotalCount))
+		assert.Equal(t, "1", get("GET", "/test/?Id=id2&limit=1", HeaderTotalCount))
+		assert.Equal(t, "1", get("POST", "/test/filter", HeaderTotalCount))
+
+		// Counted with Count, with the filter
+		assert.Equal(t, "items 0-2/42", get("GET", "/testrange/", fiber.HeaderContentRange))
+		assert.Equal(t, "items 1-2/42", get("GET", "/testrange/?limit=2&offset=1", fiber.HeaderContentRange))
+		assert.Equal(t, "items */42", get("GET", "/testrange/?offset=5", fiber.HeaderContentRange))
+		assert.Equal(t, "items 0-0/42", get("GET", "/testrange/?Id=id2", fiber.HeaderContentRange))
+		assert.Equal(t, "items 0-0/42", get("POST", "/testrange/filter", fiber.HeaderContentRange))
+		assert.Equal(t, "", get("GET", "/testrange/", HeaderTotalCount))
+		if assert.Len(t, filters, 6) {
+			assert.Nil(t, filters[0])
+			assert.Equal(t, &TestItemDto{Id: "id2"}, filters[3])
+			assert.Equal(t, &TestItemDto{Data: "data3"}, filters[4])
+		}
+	})
+}
+
+func TestPageLinks(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		for i := 3; i <= 5; i++ {
+			id := fmt.Sprintf("id%d", i)
+			data.entries[id] = TestItem{Id: id, Data: "new"}
+		}
+
+		link := func(url string) string {
+			resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+			assert.Nil(t, err)
+			assert.Equal(t, 200, resp.StatusCode)
+			return resp.Header.Get(fiber.HeaderLink)
+		}
+
+		assert.Equal(t, `</test/?offset=0&limit=2>; rel="first", </test/?offset=2&limit=2>; rel="next", </test/?offset=4&limit=2>; rel="last"`,
+			link("/test/?limit=2"))
+		assert.Equal(t, `</test/?sort=-Id&offset=0&limit=2>; rel="first", </test/?sort=-Id&offset=0&limit=2>; rel="prev", </test/?sort=-Id&offset=4&limit=2>; rel="next", </test/?sort=-Id&offset=4&limit=2>; rel="last"`,
+			link("/test/?offset=2&sort=-Id&limit=2"))
+		assert.Equal(t, `</test/?offset=0&limit=2>; rel="first", </test/?offset=2&limit=2>; rel="prev", </test/?offset=4&limit=2>; rel="last"`,
+			link("/test/?offset=4&limit=2"))
+		assert.Equal(t, `</test/?offset=0&limit=2>; rel="first", </test/?offset=0&limit=2>; rel="prev", </test/?offset=3&limit=2>; rel="next", </test/?offset=4&limit=2>; rel="last"`,
+			link("/test/?offset=1&limit=2"))
+
+		// Filters are kept, and the last page is of the filtered list
+		assert.Equal(t, `</test/?Data=new&offset=0&limit=2>; rel="first", </test/?Data=new&offset=2&limit=2>; rel="next", </test/?Data=new&offset=2&limit=2>; rel="last"`,
+			link("/test/?Data=new&limit=2"))
+
+		// Not paged
+		assert.Equal(t, "", link("/test/"))
+	})
+}
+
+func TestFindSince(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		data.entries["id3"] = TestItem{Id: "id3", Data: "new data"}
+		api := newTestApi(data)
+		api.Path = "testsince"
+		api.Key = func(item TestItem) string { return item.Id }
+		var asked time.Time
+		api.FindSince = func(t time.Time) []TestItem {
+			asked = t
+			return []TestItem{data.entries["id3"], data.entries["id2"]}
+		}
+		RegisterAPI(app, api)
+
+		ids := func(url string) []any {
+			code, resp, _ := util.GetJsonSliceRequestResponse(app, "GET", url, nil)
+			assert.Equal(t, 200, code)
+			var ids []any
+			for _, item := range resp {
+				ids = append(ids, item["Id"])
+			}
+			return ids
+		}
+		assert.Equal(t, []any{"id3", "id2"}, ids("/testsince/?updated_after=2024-01-01T00:00:00Z"))
+		assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), asked)
+		assert.Equal(t, []any{"id2", "id3"}, ids("/testsince/?since=2024-01-01T00:00:00%2B01:00&sort=Id"))
+		assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.FixedZone("", 3600)).Unix(), asked.Unix())
+		assert.Equal(t, []any{"id2"}, ids("/testsince/?since=2024-01-01T00:00:00Z&Data=data2"))
+		assert.Equal(t, []any{"id2"}, ids("/testsince/?since=2024-01-01T00:00:00Z&limit=1&offset=1"))
+
+		code, resp, _ := util.GetJsonRequestResponse(app, "GET", "/testsince/?since=2024-01-01", nil)
+		assert.Equal(t, 400, code)
+		assert.Equal(t, "invalid since '2024-01-01', expected an RFC 3339 time", resp["error"])
+		code, resp, _ = util.GetJsonRequestResponse(app, "GET", "/test/?updated_after=2024-01-01T00:00:00Z", nil)
+		assert.Equal(t, 400, code)
+		assert.Equal(t, "updated_after is not supported", resp["error"])
+	})
+}
+
+func TestGetAllQueryFilter(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+
+		code, resp, err := util.GetJsonSliceRequestResponse(app, "GET", "/test/?Data=data2", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		if assert.Len(t, resp, 1) {
+			assert.Equal(t, "id2", resp[0]["Id"])
+		}
+
+		code, resp, err = util.GetJsonSliceRequestResponse(app, "GET", "/test/?Id=id1&Data=data", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		if assert.Len(t, resp, 1) {
+			assert.Equal(t, "id1", resp[0]["Id"])
+		}
+
+		// Combines with sort and paging
+		code, resp, _ = util.GetJsonSliceRequestResponse(app, "GET", "/test/?Data=data&sort=-Id&limit=1", nil)
+		assert.Equal(t, 200, code)
+		if assert.Len(t, resp, 1) {
+			assert.Equal(t, "id2", resp[0]["Id"])
+		}
+
+		// Unknown fields are rejected
+		code, errResp, _ := util.GetJsonRequestResponse(app, "GET", "/test/?Name=x", nil)
+		assert.Equal(t, 400, code)
+		assert.Contains(t, errResp["error"], "Name")
+	})
+}
+
+func TestGetAllQueryFilterDisabled(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+
+		// Without the flag query parameters are ignored
+		code, resp, err := util.GetJsonSliceRequestResponse(app, "GET", "/test2/?Id=id1&Name=x", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.Len(t, resp, 2)
+	})
+}
+
+func TestPatchOne(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+
+		data.permit = false
+		code, _, _ := util.GetJsonRequestResponse(app, "PATCH", "/test/id1", map[string]any{"Data": "patched"})
+		assert.Equal(t, 401, code)
+
+		data.permit = true
+		code, resp, err := util.GetJsonRequestResponse(app, "PATCH", "/test/id1", map[string]any{"Data": "patched"})
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "patched", resp["Data"])
+		assert.Equal(t, "id1", resp["Id"])
+		assert.Equal(t, "patched", data.entries["id1"].Data)
+
+		// Omitting a field leaves it untouched
+		code, resp, _ = util.GetJsonRequestResponse(app, "PATCH", "/test/id1", map[string]any{"Id": "id1"})
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "patched", data.entries["id1"].Data)
+
+		code, _, _ = util.GetJsonRequestResponse(app, "PATCH", "/test/idmissing", map[string]any{"Data": "patched"})
+		assert.Equal(t, 404, code)
+
+		data.fail = true
+		code, _, _ = util.GetJsonRequestResponse(app, "PATCH", "/test/id1", map[string]any{"Data": "patched"})
+		assert.Equal(t, 500, code)
+	})
+}
+
+func TestPatchOneBadBody(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+
+		code, resp, _ := util.GetJsonRequestResponse(app, "PATCH", "/test/id1", map[string]any{"Nope": "x"})
+		assert.Equal(t, 400, code)
+		assert.Contains(t, resp["error"], "Nope")
+
+		code, _, _ = util.GetJsonRequestResponse(app, "PATCH", "/test/id1", map[string]any{"Data": 12})
+		assert.Equal(t, 400, code)
+
+		code, _, _ = util.GetJsonRequestResponse(app, "PATCH", "/test/id1", "just a string")
+		assert.Equal(t, 400, code)
+
+		// Not registered without a Patch function
+		code, _, _ = util.GetJsonRequestResponse(app, "PATCH", "/test3/id1", map[string]any{"Data": "x"})
+		assert.Equal(t, 405, code)
+	})
+}
+
+func TestMergeFields(t *testing.T) {
+	type inner struct {
+		A string
+		B int
+	}
+	type outer struct {
+		Name  string
+		Inner inner
+	}
+	dto := outer{Name: "n", Inner: inner{A: "a", B: 2}}
+	fields := map[string]any{"Name": nil, "Inner": map[string]any{"B": nil, "A": "z"}}
+	merged, err := mergeFields(dto, fields)
+	assert.Nil(t, err)
+	assert.Nil(t, validatePatch[outer](merged))
+	assert.Equal(t, outer{Inner: inner{A: "z"}}, patchDto(dto, merged))
+
+	// Keys absent from a nested object keep their value
+	merged, _ = mergeFields(dto, map[string]any{"Inner": map[string]any{"A": "z"}})
+	assert.Equal(t, outer{Name: "n", Inner: inner{A: "z", B: 2}}, patchDto(dto, merged))
+}
+
+func TestJSONPatch(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		send := func(body string) (int, map[string]any) {
+			req := httptest.NewRequest("PATCH", "/test/id1", strings.NewReader(body))
+			req.Header.Set("Content-Type", MIMEApplicationJSONPatch)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			var ret map[string]any
+			_ = json.NewDecoder(resp.Body).Decode(&ret)
+			return resp.StatusCode, ret
+		}
+
+		code, resp := send(`[{"op":"test","path":"/Data","value":"original data"},{"op":"replace","path":"/Data","value":"patched"}]`)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "patched", resp["Data"])
+		assert.Equal(t, "patched", data.entries["id1"].Data)
+
+		// Failures are 422 with the index of the operation
+		for body, op := range map[string]int{
+			`[{"op":"test","path":"/Data","value":"patched"},{"op":"test","path":"/Data","value":"x"}]`: 1,
+			`[{"op":"move","from":"/Id","path":"/Data"}]`:                                               0,
+			`[{"op":"replace","path":"/Nope","value":"x"}]`:                                             0,
+			`[{"op":"replace","path":"/Data/x","value":"x"}]`:                                           0,
+			`[{"op":"replace","path":"/Data","value":12}]`:                                              0,
+			`[{"op":"replace","path":"","value":{}}]`:                                                   0,
+		} {
+			code, resp = send(body)
+			assert.Equal(t, 422, code, body)
+			assert.EqualValues(t, op, resp["op"], body)
+		}
+		assert.Equal(t, "patched", data.entries["id1"].Data)
+
+		// Removing a field sets it to its zero value
+		code, resp = send(`[{"op":"remove","path":"/Data"}]`)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "", data.entries["id1"].Data)
+
+		code, _ = send(`{"op":"remove"}`)
+		assert.Equal(t, 400, code)
+	})
+
+	type withList struct {
+		Name string `json:"name"`
+		List []int  `json:"list"`
+	}
+	fields, err := jsonPatchFields(withList{Name: "n", List: []int{1, 2}}, []patchOp{
+		{Op: "add", Path: "/list/-", Value: json.RawMessage("3")},
+		{Op: "add", Path: "/list/0", Value: json.RawMessage("0")},
+		{Op: "remove", Path: "/list/1"},
+		{Op: "test", Path: "/name", Value: json.RawMessage(`"n"`)},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, withList{Name: "n", List: []int{0, 2, 3}}, patchDto(withList{Name: "n"}, fields))
+}
+
+func TestCount(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+
+		data.permit = false
+		code, _, _ := util.GetJsonRequestResponse(app, "GET", "/test/count", nil)
+		assert.Equal(t, 401, code)
+
+		data.permit = true
+		code, resp, err := util.GetJsonRequestResponse(app, "GET", "/test/count", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.EqualValues(t, 2, resp["count"])
+
+		code, resp, _ = util.GetJsonRequestResponse(app, "GET", "/test/count?Data=data2", nil)
+		assert.Equal(t, 200, code)
+		assert.EqualValues(t, 1, resp["count"])
+
+		code, resp, _ = util.GetJsonRequestResponse(app, "POST", "/test/count", TestItemDto{Id: "id1"})
+		assert.Equal(t, 200, code)
+		assert.EqualValues(t, 1, resp["count"])
+
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/test/count?Nope=1", nil)
+		assert.Equal(t, 400, code)
+
+		// No Search to filter with
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/test2/count?Id=id1", nil)
+		assert.Equal(t, 400, code)
+	})
+}
+
+func TestCountCallback(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		var gotFilter *TestItemDto
+		RegisterAPI(app, Api[TestItem, TestItemDto]{
+			Path:    "testc",
+			Find:    func(key string) (TestItem, bool) { return TestItem{}, false },
+			FindAll: func() []TestItem { return nil },
+			Count: func(filter *TestItemDto) (int64, error) {
+				gotFilter = filter
+				if filter != nil && filter.Id == "fail" {
+					return 0, errors.New("count error")
+				}
+				return 42, nil
+			},
+			Dto: ItemToDto,
+		})
+
+		code, resp, _ := util.GetJsonRequestResponse(app, "GET", "/testc/count", nil)
+		assert.Equal(t, 200, code)
+		assert.EqualValues(t, 42, resp["count"])
+		assert.Nil(t, gotFilter)
+
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testc/count?Id=x", nil)
+		assert.Equal(t, 200, code)
+		if assert.NotNil(t, gotFilter) {
+			assert.Equal(t, "x", gotFilter.Id)
+		}
+
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testc/count?Id=fail", nil)
+		assert.Equal(t, 500, code)
+	})
+}
+
+type Employee struct {
+	EmployeeNo int
+	FullName   string
+	HTTPPort   int
+	Team       string `json:"team_name"`
+}
+
+func TestFieldNaming(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		var lock sync.Mutex
+		employees := map[string]Employee{}
+		MustRegisterAPI(app, Api[Employee, Employee]{
+			Path: "employees",
+			Find: func(key string) (Employee, bool) {
+				lock.Lock()
+				defer lock.Unlock()
+				e, ok := employees[key]
+				return e, ok
+			},
+			FindAll: func() []Employee {
+				lock.Lock()
+				defer lock.Unlock()
+				var all []Employee
+				for _, e := range employees {
+					all = append(all, e)
+				}
+				return all
+			},
+			Search: func(filter Employee) []Employee {
+				lock.Lock()
+				defer lock.Unlock()
+				var found []Employee
+				for _, e := range employees {
+					if e.EmployeeNo == filter.EmployeeNo {
+						found = append(found, e)
+					}
+				}
+				return found
+			},
+			SearchAdvanced: func(filter Employee, conditions []Condition) ([]Employee, error) {
+				lock.Lock()
+				defer lock.Unlock()
+				var found []Employee
+				for _, e := range employees {
+					for _, cond := range conditions {
+						if cond.Field == "EmployeeNo" && cond.Op == OpIn {
+							for _, v := range cond.Values {
+								if v == e.EmployeeNo {
+									found = append(found, e)
+								}
+							}
+						}
+					}
+				}
+				return found, nil
+			},
+			Create: func(e Employee) (Employee, error) {
+				lock.Lock()
+				defer lock.Unlock()
+				employees[strconv.Itoa(e.EmployeeNo)] = e
+				return e, nil
+			},
+			Dto:         func(e Employee) Employee { return e },
+			QueryFilter: true,
+			StrictBody:  true,
+			FieldNaming: FieldNamingCamelCase,
+		})
+
+		code, resp, err := util.GetJsonRequestResponse(app, "POST", "/employees", map[string]any{"employeeNo": 3, "fullName": "Ann", "httpPort": 80, "team_name": "a"})
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, map[string]any{"employeeNo": 3.0, "fullName": "Ann", "httpPort": 80.0, "team_name": "a"}, resp)
+		assert.Equal(t, Employee{EmployeeNo: 3, FullName: "Ann", HTTPPort: 80, Team: "a"}, employees["3"])
+		util.GetJsonRequestResponse(app, "POST", "/employees", map[string]any{"employeeNo": 4, "fullName": "Bob"})
+
+		code, resp, _ = util.GetJsonRequestResponse(app, "POST", "/employees", map[string]any{"employeeNo": 5, "nope": 1})
+		assert.Equal(t, 400, code)
+		assert.Contains(t, resp["error"], "nope")
+
+		code, list, _ := util.GetJsonSliceRequestResponse(app, "GET", "/employees?employeeNo=3", nil)
+		assert.Equal(t, 200, code)
+		if assert.Len(t, list, 1) {
+			assert.Equal(t, "Ann", list[0]["fullName"])
+		}
+
+		code, list, _ = util.GetJsonSliceRequestResponse(app, "POST", "/employees/filter", map[string]any{"employeeNo": 4})
+		assert.Equal(t, 200, code)
+		if assert.Len(t, list, 1) {
+			assert.Equal(t, "Bob", list[0]["fullName"])
+		}
+
+		code, list, _ = util.GetJsonSliceRequestResponse(app, "GET", "/employees?sort=-employeeNo&fields=employeeNo", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, []map[string]any{{"employeeNo": 4.0}, {"employeeNo": 3.0}}, list)
+
+		// An operator keeps its suffix on the renamed field
+		code, list, _ = util.GetJsonSliceRequestResponse(app, "GET", "/employees?employeeNo.in=3,5&fields=fullName", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, []map[string]any{{"fullName": "Ann"}}, list)
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/employees?nope.in=3", nil)
+		assert.Equal(t, 400, code)
+	})
+
+	for name, want := range map[string][2]string{
+		"EmployeeNo": {"employeeNo", "employee_no"},
+		"ID":         {"id", "id"},
+		"UserID":     {"userID", "user_id"},
+		"HTTPServer": {"httpServer", "http_server"},
+		"Address2":   {"address2", "address2"},
+	} {
+		assert.Equal(t, want[0], renameField(name, FieldNamingCamelCase), name)
+		assert.Equal(t, want[1], renameField(name, FieldNamingSnakeCase), name)
+	}
+}
+
+func TestHeadOne(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+
+		head := func(url string) (int, []byte) {
+			resp, err := app.Test(httptest.NewRequest("HEAD", url, nil))
+			assert.Nil(t, err)
+			body, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, body
+		}
+
+		data.permit = true
+		code, body := head("/test/id1")
+		assert.Equal(t, 200, code)
+		assert.Empty(t, body)
+
+		code, body = head("/test/idmissing")
+		assert.Equal(t, 404, code)
+		assert.Empty(t, body)
+
+		// The headers of GET
+		data.permit = true
+		for _, url := range []string{"/test/id1", "/test/id1?fields=Data", "/test/idmissing"} {
+			get, err := app.Test(httptest.NewRequest("GET", url, nil))
+			assert.Nil(t, err)
+			head, err := app.Test(httptest.NewRequest("HEAD", url, nil))
+			assert.Nil(t, err)
+			get.Header.Del(fiber.HeaderDate)
+			head.Header.Del(fiber.HeaderDate)
+			assert.Equal(t, get.Header, head.Header, url)
+			assert.Equal(t, get.ContentLength, head.ContentLength, url)
+		}
+		resp, err := app.Test(httptest.NewRequest("HEAD", "/test/id1", nil))
+		assert.Nil(t, err)
+		assert.NotEmpty(t, resp.Header.Get(fiber.HeaderETag))
+		assert.Equal(t, fiber.MIMEApplicationJSON, resp.Header.Get(fiber.HeaderContentType))
+		assert.Equal(t, strconv.Itoa(len(`{"Id":"id1","Data":"original data"}`)), resp.Header.Get(fiber.HeaderContentLength))
+
+		// Same auth semantics as GET
+		data.permit = false
+		code, _ = head("/test/id1")
+		assert.Equal(t, 401, code)
+		code, _ = head("/test/idmissing")
+		assert.Equal(t, 401, code)
+	})
+}
+
+func TestAddOneCreatedStatus(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem), permit: true}
+		api := newTestApi(data)
+		api.Path = "testcr"
+		api.CreatedStatus = true
+		api.Key = func(item TestItem) string { return item.Id }
+		RegisterAPI(app, api)
+
+		bodyJson, _ := json.Marshal(TestItemDto{Id: "idnew", Data: "some data"})
+		req := httptest.NewRequest("POST", "/testcr/", bytes.NewReader(bodyJson))
+		req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		assert.Equal(t, 201, resp.StatusCode)
+		assert.Equal(t, "/testcr/idnew", resp.Header.Get("Location"))
+		_, ok := data.entries["idnew"]
+		assert.True(t, ok)
+	})
+}
+
+func TestSpecialKeys(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem), permit: true}
+		api := newTestApi(data)
+		api.Path = "testkeys"
+		api.CreatedStatus = true
+		api.IncludeLinks = true
+		api.Key = func(item TestItem) string { return item.Id }
+		RegisterAPI(app, api)
+
+		for key, escaped := range map[string]string{
+			"1 Wall Street": "1%20Wall%20Street",
+			"a/b":           "a%2Fb",
+			"a+b":           "a+b",
+			"zürich":        "z%C3%BCrich",
+		} {
+			bodyJson, _ := json.Marshal(TestItemDto{Id: key, Data: "created"})
+			req := httptest.NewRequest("POST", "/testkeys/", bytes.NewReader(bodyJson))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			assert.Equal(t, 201, resp.StatusCode, key)
+			assert.Equal(t, "/testkeys/"+escaped, resp.Header.Get("Location"), key)
+
+			code, ret, _ := util.GetJsonRequestResponse(app, "GET", "/testkeys/"+escaped, nil)
+			assert.Equal(t, 200, code, key)
+			assert.Equal(t, key, ret["Id"], key)
+			if links, ok := ret["_links"].(map[string]any); assert.True(t, ok, key) {
+				assert.Equal(t, "/testkeys/"+escaped, links["self"], key)
+			}
+
+			code, _, _ = util.GetJsonRequestResponse(app, "PUT", "/testkeys/"+escaped, TestItemDto{Id: key, Data: "mutated"})
+			assert.Equal(t, 200, code, key)
+			assert.Equal(t, "mutated", data.entries[key].Data, key)
+
+			code, _, _ = util.GetStringRequestResponse(app, "DELETE", "/testkeys/"+escaped, "")
+			assert.Equal(t, 200, code, key)
+			code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testkeys/"+escaped, nil)
+			assert.Equal(t, 404, code, key)
+		}
+	})
+}
+
+func TestJoinKey(t *testing.T) {
+	key := JoinKey("EU", "a/b c", "7")
+	assert.Equal(t, "EU/a%2Fb%20c/7", key)
+	parts, err := SplitKey(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"EU", "a/b c", "7"}, parts)
+	_, err = SplitKey("EU/%zz")
+	assert.NotNil(t, err)
+}
+
+type teapotError struct{}
+
+func (e teapotError) Error() string   { return "teapot" }
+func (e teapotError) StatusCode() int { return fiber.StatusTeapot }
+
+func TestTypedErrors(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem), permit: true}
+		data.entries["id1"] = TestItem{Id: "id1"}
+		errs := map[string]error{
+			"notfound":   fmt.Errorf("lookup: %w", ErrNotFound),
+			"conflict":   fmt.Errorf("insert: %w", ErrConflict),
+			"validation": fmt.Errorf("check: %w", ErrValidation),
+			"forbidden":  ErrForbidden,
+			"teapot":     fmt.Errorf("wrapped: %w", teapotError{}),
+			"other":      errors.New("something else"),
+		}
+		api := newTestApi(data)
+		api.Path = "testerr"
+		api.Create = func(dto TestItemDto) (TestItem, error) {
+			return TestItem{}, errs[dto.Data]
+		}
+		api.Mutate = func(item TestItem, dto TestItemDto) (TestItem, error) {
+			return TestItem{}, errs[dto.Data]
+		}
+		RegisterAPI(app, api)
+
+		expected := map[string]int{
+			"notfound":   404,
+			"conflict":   409,
+			"validation": 422,
+			"forbidden":  403,
+			"teapot":     418,
+			"other":      500,
+		}
+		for name, status := range expected {
+			code, resp, _ := util.GetJsonRequestResponse(app, "POST", "/testerr", TestItemDto{Id: "x", Data: name})
+			assert.Equal(t, status, code, name)
+			if status != 500 {
+				assert.Equal(t, errs[name].Error(), resp["error"], name)
+			}
+			code, _, _ = util.GetJsonRequestResponse(app, "PUT", "/testerr/id1", TestItemDto{Id: "id1", Data: name})
+			assert.Equal(t, status, code, name)
+		}
+	})
+}
+
+func TestAccessValidator(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem)}
+		api := newTestApi(data)
+		_, _ = api.Create(TestItemDto{Id: "id1", Data: "data"})
+		_, _ = api.Create(TestItemDto{Id: "id2", Data: "data"})
+		api.Path = "testaccess"
+		api.Validator = func(c *fiber.Ctx, action Action, item ...TestItem) bool {
+			return false // ignored as AccessValidator is set
+		}
+		access := AccessGranted
+		api.AccessValidator = func(c *fiber.Ctx, action Action, item ...TestItem) Access {
+			return access
+		}
+		RegisterAPI(app, api)
+
+		requests := []struct {
+			method string
+			url    string
+			body   any
+		}{
+			{"GET", "/testaccess/id1", nil},
+			{"GET", "/testaccess/idmissing", nil},
+			{"PUT", "/testaccess/id1", TestItemDto{Id: "id1", Data: "new"}},
+			{"PUT", "/testaccess/idmissing", TestItemDto{Id: "idmissing", Data: "new"}},
+			{"DELETE", "/testaccess/id1", nil},
+			{"DELETE", "/testaccess/idmissing", nil},
+		}
+		for _, expected := range []struct {
+			access Access
+			status int
+		}{{AccessUnauthenticated, 401}, {AccessForbidden, 403}} {
+			access = expected.access
+			for _, r := range requests {
+				code, _, _ := util.GetJsonRequestResponse(app, r.method, r.url, r.body)
+				assert.Equal(t, expected.status, code, r.method+" "+r.url)
+			}
+		}
+
+		access = AccessGranted
+		code, _, _ := util.GetJsonRequestResponse(app, "GET", "/testaccess/id1", nil)
+		assert.Equal(t, 200, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "PUT", "/testaccess/id1", TestItemDto{Id: "id1", Data: "new"})
+		assert.Equal(t, 200, code)
+		code, _, _ = util.GetStringRequestResponse(app, "DELETE", "/testaccess/id1", "")
+		assert.Equal(t, 200, code)
+	})
+}
+
+func TestValidatorE(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem)}
+		api := newTestApi(data)
+		_, _ = api.Create(TestItemDto{Id: "id1", Data: "data"})
+		api.Path = "testreason"
+		api.AccessValidator = func(c *fiber.Ctx, action Action, item ...TestItem) Access {
+			return AccessForbidden // ignored as ValidatorE is set
+		}
+		var denial error
+		api.ValidatorE = func(c *fiber.Ctx, action Action, item ...TestItem) error {
+			return denial
+		}
+		RegisterAPI(app, api)
+
+		requests := []struct {
+			method string
+			url    string
+			body   any
+		}{
+			{"GET", "/testreason/id1", nil},
+			{"PUT", "/testreason/id1", TestItemDto{Id: "id1", Data: "new"}},
+			{"POST", "/testreason/filter", TestItemDto{Data: "data"}},
+		}
+		for _, r := range requests {
+			denial = Denial{Status: fiber.StatusForbidden, Code: "tenant_mismatch", Message: "the item belongs to another tenant"}
+			code, resp, _ := util.GetJsonRequestResponse(app, r.method, r.url, r.body)
+			assert.Equal(t, 403, code, r.method+" "+r.url)
+			assert.Equal(t, map[string]any{"error": "the item belongs to another tenant", "reason": "tenant_mismatch"}, resp, r.method+" "+r.url)
+
+			// A wrapped Denial with the default status
+			denial = fmt.Errorf("checking token: %w", Denial{Code: "token_expired"})
+			code, resp, _ = util.GetJsonRequestResponse(app, r.method, r.url, r.body)
+			assert.Equal(t, 401, code, r.method+" "+r.url)
+			assert.Equal(t, "token_expired", resp["reason"], r.method+" "+r.url)
+
+			// Any other error is a 401 without a reason
+			denial = errors.New("no role")
+			code, resp, _ = util.GetJsonRequestResponse(app, r.method, r.url, r.body)
+			assert.Equal(t, 401, code, r.method+" "+r.url)
+			assert.Equal(t, map[string]any{"error": "no role"}, resp, r.method+" "+r.url)
+
+			// Statuses that are not a denial are 401
+			for _, status := range []int{fiber.StatusOK, fiber.StatusNoContent, fiber.StatusFound, fiber.StatusBadGateway} {
+				denial = Denial{Status: status, Code: "odd_status", Message: "denied"}
+				code, resp, _ = util.GetJsonRequestResponse(app, r.method, r.url, r.body)
+				assert.Equal(t, 401, code, r.method+" "+r.url)
+				assert.Equal(t, map[string]any{"error": "denied", "reason": "odd_status"}, resp, r.method+" "+r.url)
+			}
+		}
+
+		denial = nil
+		code, _, _ := util.GetJsonRequestResponse(app, "GET", "/testreason/id1", nil)
+		assert.Equal(t, 200, code)
+	})
+}
+
+func TestValidatorStatus(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		quota := 0
+		api := newTestApi(data)
+		api.Path = "teststatus"
+		api.ValidatorStatus = func(c *fiber.Ctx, action Action, item ...TestItem) (bool, int) {
+			if quota <= 0 {
+				return false, fiber.StatusTooManyRequests
+			}
+			quota--
+			// id2 is hidden from everyone
+			if len(item) > 0 && item[0].Id == "id2" {
+				return false, fiber.StatusNotFound
+			}
+			return true, 0
+		}
+		RegisterAPI(app, api)
+
+		send := func(method, url string, body any) (int, string) {
+			b, _ := json.Marshal(body)
+			req := httptest.NewRequest(method, url, bytes.NewReader(b))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			ret, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, string(ret)
+		}
+
+		// Hidden items look missing for reads and writes
+		quota = 10
+		code, _ := send("GET", "/teststatus/id1", nil)
+		assert.Equal(t, 200, code)
+		code, hidden := send("GET", "/teststatus/id2", nil)
+		assert.Equal(t, 404, code)
+		code, missing := send("GET", "/teststatus/idmissing", nil)
+		assert.Equal(t, 404, code)
+		assert.Equal(t, missing, hidden)
+		code, _ = send("PUT", "/teststatus/id2", TestItemDto{Id: "id2", Data: "changed"})
+		assert.Equal(t, 404, code)
+		code, _ = send("DELETE", "/teststatus/id2", nil)
+		assert.Equal(t, 404, code)
+		assert.Equal(t, "original data2", data.entries["id2"].Data)
+
+		// Denied once the quota is used up
+		quota = 0
+		code, _ = send("GET", "/teststatus/id1", nil)
+		assert.Equal(t, 429, code)
+		code, _ = send("GET", "/teststatus/", nil)
+		assert.Equal(t, 429, code)
+		code, _ = send("PUT", "/teststatus/id1", TestItemDto{Id: "id1", Data: "changed"})
+		assert.Equal(t, 429, code)
+		code, _ = send("POST", "/teststatus/", TestItemDto{Id: "id3", Data: "new"})
+		assert.Equal(t, 429, code)
+		assert.Equal(t, "original data", data.entries["id1"].Data)
+		assert.Len(t, data.entries, 2)
+
+		// A status that isn't 4xx is a 401
+		api.Path = "teststatus500"
+		api.ValidatorStatus = func(c *fiber.Ctx, action Action, item ...TestItem) (bool, int) {
+			return false, 500
+		}
+		RegisterAPI(app, api)
+		code, _ = send("GET", "/teststatus500/id1", nil)
+		assert.Equal(t, 401, code)
+	})
+}
+
+func TestValidators(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem)}
+		api := newTestApi(data)
+		_, _ = api.Create(TestItemDto{Id: "id1", Data: "data"})
+		api.Path = "testvalidators"
+		deny := func(c *fiber.Ctx, item ...TestItem) bool { return false }
+		api.Validators = map[Action]func(c *fiber.Ctx, item ...TestItem) bool{
+			ActionDelete: deny,
+			ActionMutate: deny,
+		}
+		permit := true
+		api.Validator = func(c *fiber.Ctx, action Action, item ...TestItem) bool {
+			return permit
+		}
+		RegisterAPI(app, api)
+
+		// The write validators don't affect reads
+		code, _, _ := util.GetJsonRequestResponse(app, "GET", "/testvalidators/id1", nil)
+		assert.Equal(t, 200, code)
+		code, _, _ = util.GetJsonSliceRequestResponse(app, "GET", "/testvalidators/", nil)
+		assert.Equal(t, 200, code)
+		code, _, _ = util.GetStringRequestResponse(app, "DELETE", "/testvalidators/id1", "")
+		assert.Equal(t, 401, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "PUT", "/testvalidators/id1", TestItemDto{Id: "id1", Data: "new"})
+		assert.Equal(t, 401, code)
+
+		// Actions without a validator of their own fall back to Validator
+		permit = false
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testvalidators/id1", nil)
+		assert.Equal(t, 401, code)
+
+		// Without Validator the other actions are allowed
+		api.Path = "testvalidators2"
+		api.Validator = nil
+		RegisterAPI(app, api)
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testvalidators2/id1", nil)
+		assert.Equal(t, 200, code)
+		code, _, _ = util.GetStringRequestResponse(app, "DELETE", "/testvalidators2/id1", "")
+		assert.Equal(t, 401, code)
+	})
+}
+
+func TestActionSearch(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem), permit: true}
+		api := newTestApi(data)
+		_, _ = api.Create(TestItemDto{Id: "id1", Data: "data"})
+		api.Path = "testsearch"
+		api.Validator = func(c *fiber.Ctx, action Action, item ...TestItem) bool {
+			return action != ActionSearch
+		}
+		RegisterAPI(app, api)
+
+		code, _, _ := util.GetJsonSliceRequestResponse(app, "GET", "/testsearch/", nil)
+		assert.Equal(t, 200, code)
+		code, _, _ = util.GetJsonSliceRequestResponse(app, "POST", "/testsearch/filter", TestItemDto{Data: "data"})
+		assert.Equal(t, 401, code)
+		code, _, _ = util.GetJsonSliceRequestResponse(app, "GET", "/testsearch/?Data=data", nil)
+		assert.Equal(t, 401, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testsearch/count", nil)
+		assert.Equal(t, 200, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testsearch/count?Data=data", nil)
+		assert.Equal(t, 401, code)
+	})
+}
+
+func TestValidatorD(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem)}
+		api := newTestApi(data)
+		_, _ = api.Create(TestItemDto{Id: "id1", Data: "data"})
+		api.Path = "testvd"
+		var gotExisting *TestItem
+		api.ValidatorD = func(c *fiber.Ctx, action Action, existing *TestItem, incoming *TestItemDto) bool {
+			gotExisting = existing
+			// Only admins can use restricted data
+			if incoming != nil && incoming.Data == "restricted" {
+				return c.Get("X-Role") == "admin"
+			}
+			return true
+		}
+		RegisterAPI(app, api)
+
+		code, _, _ := util.GetJsonRequestResponse(app, "POST", "/testvd", TestItemDto{Id: "id2", Data: "restricted"})
+		assert.Equal(t, 401, code)
+		assert.Nil(t, gotExisting)
+		_, ok := data.entries["id2"]
+		assert.False(t, ok)
+
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testvd", TestItemDto{Id: "id2", Data: "ok"})
+		assert.Equal(t, 200, code)
+
+		code, _, _ = util.GetJsonRequestResponse(app, "PUT", "/testvd/id1", TestItemDto{Id: "id1", Data: "restricted"})
+		assert.Equal(t, 401, code)
+		if assert.NotNil(t, gotExisting) {
+			assert.Equal(t, "id1", gotExisting.Id)
+		}
+		assert.Equal(t, "data", data.entries["id1"].Data)
+
+		code, _, _ = util.GetJsonRequestResponse(app, "PATCH", "/testvd/id1", map[string]any{"Data": "restricted"})
+		assert.Equal(t, 401, code)
+
+		// An admin may
+		body, _ := json.Marshal(TestItemDto{Id: "id1", Data: "restricted"})
+		req := httptest.NewRequest("PUT", "/testvd/id1", bytes.NewReader(body))
+		req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+		req.Header.Set("X-Role", "admin")
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "restricted", data.entries["id1"].Data)
+
+		// Reads have no incoming item
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testvd/id1", nil)
+		assert.Equal(t, 200, code)
+	})
+}
+
+type ctxKey string
+
+func TestRequestContext(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		app.Use(func(c *fiber.Ctx) error {
+			c.SetUserContext(context.WithValue(c.UserContext(), ctxKey("user"), "bob"))
+			return c.Next()
+		})
+		var got []any
+		RegisterAPI(app, Api[TestItem, TestItemDto]{
+			Path: "testctx",
+			Find: func(key string) (TestItem, bool) { return TestItem{}, false }, // FindCtx is preferred
+			FindCtx: func(ctx context.Context, key string) (TestItem, bool) {
+				got = append(got, ctx.Value(ctxKey("user")))
+				return TestItem{Id: key}, true
+			},
+			FindAllCtx: func(ctx context.Context) []TestItem {
+				got = append(got, ctx.Value(ctxKey("user")))
+				return []TestItem{{Id: "id1"}}
+			},
+			DeleteCtx: func(ctx context.Context, item TestItem) (TestItem, error) {
+				got = append(got, ctx.Value(ctxKey("user")))
+				return item, nil
+			},
+			Dto: ItemToDto,
+		})
+
+		code, ret, _ := util.GetJsonSliceRequestResponse(app, "GET", "/testctx/", nil)
+		assert.Equal(t, 200, code)
+		assert.Len(t, ret, 1)
+
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testctx/id1", nil)
+		assert.Equal(t, 200, code)
+
+		code, _, _ = util.GetStringRequestResponse(app, "DELETE", "/testctx/id1", "")
+		assert.Equal(t, 200, code)
+
+		assert.Equal(t, []any{"bob", "bob", "bob", "bob"}, got) // find all, find, find + delete
+	})
+}
+
+func TestFindE(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		var findErr error
+		RegisterAPI(app, Api[TestItem, TestItemDto]{
+			Path: "testfe",
+			FindE: func(key string) (TestItem, bool, error) {
+				if findErr != nil {
+					return TestItem{}, false, findErr
+				}
+				return TestItem{Id: key}, key == "id1", nil
+			},
+			FindAll: func() []TestItem { return nil },
+			Mutate:  func(item TestItem, dto TestItemDto) (TestItem, error) { return item, nil },
+			Delete:  func(item TestItem) (TestItem, error) { return item, nil },
+			SubEntities: []SubEntity[TestItem, TestItemDto]{
+				{SubPath: "children", Get: func(item TestItem) []any { return nil }},
+			},
+			Dto: ItemToDto,
+		})
+
+		code, _, _ := util.GetJsonRequestResponse(app, "GET", "/testfe/id1", nil)
+		assert.Equal(t, 200, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testfe/id2", nil)
+		assert.Equal(t, 404, code)
+
+		// A failing backend is not reported as missing
+		findErr = errors.New("database is down")
+		code, _, _ = util.GetStringRequestResponse(app, "GET", "/testfe/id1", "")
+		assert.Equal(t, 500, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "PUT", "/testfe/id1", TestItemDto{Id: "id1"})
+		assert.Equal(t, 500, code)
+		code, _, _ = util.GetStringRequestResponse(app, "DELETE", "/testfe/id1", "")
+		assert.Equal(t, 500, code)
+		code, _, _ = util.GetStringRequestResponse(app, "GET", "/testfe/id1/children", "")
+		assert.Equal(t, 500, code)
+
+		// Connectivity errors are 503
+		findErr = fmt.Errorf("query failed: %w", driver.ErrBadConn)
+		code, _, _ = util.GetStringRequestResponse(app, "GET", "/testfe/id1", "")
+		assert.Equal(t, 503, code)
+		findErr = &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+		code, _, _ = util.GetStringRequestResponse(app, "GET", "/testfe/id1", "")
+		assert.Equal(t, 503, code)
+		findErr = ErrUnavailable
+		code, _, _ = util.GetStringRequestResponse(app, "GET", "/testfe/id1", "")
+		assert.Equal(t, 503, code)
+	})
+}
+
+func TestFindAllESearchE(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		var queryErr error
+		RegisterAPI(app, Api[TestItem, TestItemDto]{
+			Path: "testfae",
+			Find: func(key string) (TestItem, bool) { return TestItem{}, false },
+			FindAllE: func() ([]TestItem, error) {
+				return []TestItem{{Id: "id1"}, {Id: "id2"}}, queryErr
+			},
+			SearchE: func(filter TestItemDto) ([]TestItem, error) {
+				return []TestItem{{Id: filter.Id}}, queryErr
+			},
+			Dto: ItemToDto,
+		})
+
+		code, ret, _ := util.GetJsonSliceRequestResponse(app, "GET", "/testfae/", nil)
+		assert.Equal(t, 200, code)
+		assert.Len(t, ret, 2)
+		code, ret, _ = util.GetJsonSliceRequestResponse(app, "POST", "/testfae/filter", TestItemDto{Id: "id1"})
+		assert.Equal(t, 200, code)
+		assert.Len(t, ret, 1)
+
+		// Failures are a 500 with a JSON error, not an empty list
+		queryErr = errors.New("no such column")
+		code, resp, _ := util.GetJsonRequestResponse(app, "GET", "/testfae/", nil)
+		assert.Equal(t, 500, code)
+		assert.Equal(t, "Internal Server Error", resp["error"])
+		code, resp, _ = util.GetJsonRequestResponse(app, "POST", "/testfae/filter", TestItemDto{Id: "id1"})
+		assert.Equal(t, 500, code)
+		assert.Equal(t, "Internal Server Error", resp["error"])
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testfae/count", nil)
+		assert.Equal(t, 500, code)
+
+		// Typed errors keep their status
+		queryErr = ErrUnavailable
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testfae/", nil)
+		assert.Equal(t, 503, code)
+	})
+}
+
+type change struct {
+	action Action
+	before *TestItem
+	after  *TestItem
+}
+
+func TestOnChange(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		changes := make(chan change, 10)
+		changeApi := newTestApi(data)
+		data.permit = true
+		changeApi.Path = "testoc"
+		changeApi.OnChange = func(action Action, before *TestItem, after *TestItem) {
+			changes <- change{action, before, after}
+		}
+		RegisterAPI(app, changeApi)
+
+		next := func() change {
+			select {
+			case ch := <-changes:
+				return ch
+			case <-time.After(time.Second):
+				t.Fatal("no change notification")
+			}
+			return change{}
+		}
+
+		// Create
+		code, _, _ := util.GetJsonRequestResponse(app, "POST", "/testoc/", TestItemDto{Id: "id9", Data: "new"})
+		assert.Equal(t, 200, code)
+		ch := next()
+		assert.Equal(t, ActionCreate, ch.action)
+		assert.Nil(t, ch.before)
+		if assert.NotNil(t, ch.after) {
+			assert.Equal(t, "id9", ch.after.Id)
+		}
+
+		// Mutate
+		code, _, _ = util.GetJsonRequestResponse(app, "PUT", "/testoc/id9", TestItemDto{Id: "id9", Data: "changed"})
+		assert.Equal(t, 200, code)
+		ch = next()
+		assert.Equal(t, ActionMutate, ch.action)
+		if assert.NotNil(t, ch.before) && assert.NotNil(t, ch.after) {
+			assert.Equal(t, "new", ch.before.Data)
+			assert.Equal(t, "changed", ch.after.Data)
+		}
+
+		// Delete
+		code, _, _ = util.GetStringRequestResponse(app, "DELETE", "/testoc/id9", "")
+		assert.Equal(t, 200, code)
+		ch = next()
+		assert.Equal(t, ActionDelete, ch.action)
+		if assert.NotNil(t, ch.before) {
+			assert.Equal(t, "id9", ch.before.Id)
+		}
+		assert.Nil(t, ch.after)
+
+		// Failures are not notified
+		code, _, _ = util.GetStringRequestResponse(app, "DELETE", "/testoc/id9", "")
+		assert.Equal(t, 404, code)
+		code, _, _ = util.GetStringRequestResponse(app, "PUT", "/testoc/id1", "{bad")
+		assert.Equal(t, 415, code)
+		select {
+		case ch := <-changes:
+			t.Errorf("unexpected change notification %v", ch)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
+
+func TestOnChangePanic(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		done := make(chan bool, 1)
+		changeApi := newTestApi(data)
+		data.permit = true
+		changeApi.Path = "testocp"
+		changeApi.OnChange = func(action Action, before *TestItem, after *TestItem) {
+			done <- true
+			panic("listener failed")
+		}
+		RegisterAPI(app, changeApi)
+
+		code, _, _ := util.GetJsonRequestResponse(app, "POST", "/testocp/", TestItemDto{Id: "id9", Data: "new"})
+		assert.Equal(t, 200, code)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("no change notification")
+		}
+		// The server is still serving
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testocp/id9", nil)
+		assert.Equal(t, 200, code)
+	})
+}
+
+func TestEmptyListIsArray(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+
+		body := func(method string, url string, reqBody string) string {
+			req := httptest.NewRequest(method, url, strings.NewReader(reqBody))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			assert.Equal(t, 200, resp.StatusCode)
+			b, _ := io.ReadAll(resp.Body)
+			return string(b)
+		}
+
+		// Sub entities of an item without children
+		data.entries["empty"] = TestItem{Id: "empty"}
+		assert.Equal(t, "[]", body("GET", "/test/empty/children", ""))
+
+		// Nothing matches the filter
+		assert.Equal(t, "[]", body("POST", "/test/filter", `{"Id":"nothing"}`))
+		assert.Equal(t, "[]", body("GET", "/test/?Id=nothing", ""))
+
+		// Paging past the end
+		assert.Equal(t, "[]", body("GET", "/test/?offset=10", ""))
+		assert.Equal(t, "[]", body("GET", "/test/?offset=10&sort=Id", ""))
+
+		// An empty store
+		data.entries = map[string]TestItem{}
+		assert.Equal(t, "[]", body("GET", "/test/", ""))
+	})
+}
+
+type TestAddress struct {
+	City   string
+	Street string `json:"street"`
+}
+
+type TestPerson struct {
+	Id      string
+	Name    string `json:"name"`
+	Secret  string `json:"-"`
+	Big     int64
+	Address TestAddress
+	Home    *TestAddress
+}
+
+func TestFields(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		people := []TestPerson{
+			{Id: "p1", Name: "one", Secret: "s", Big: 1 << 60, Address: TestAddress{"London", "High St"}, Home: &TestAddress{City: "Leeds"}},
+			{Id: "p2", Name: "two", Address: TestAddress{City: "Paris"}},
+		}
+		RegisterAPI(app, Api[TestPerson, TestPerson]{
+			Path: "testfields",
+			Find: func(key string) (TestPerson, bool) {
+				for _, p := range people {
+					if p.Id == key {
+						return p, true
+					}
+				}
+				return TestPerson{}, false
+			},
+			FindAll: func() []TestPerson { return people },
+			Dto: func(p TestPerson) TestPerson {
+				p.Name = strings.ToUpper(p.Name) // the selection applies to the transformed Dto
+				return p
+			},
+		})
+
+		body := func(url string) (int, string) {
+			resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, string(b)
+		}
+
+		code, ret := body("/testfields/?fields=Id,Name")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `[{"Id":"p1","name":"ONE"},{"Id":"p2","name":"TWO"}]`, ret)
+
+		// Nested struct fields, and numbers are unchanged
+		code, ret = body("/testfields/p1?fields=Address.street,Home.City,Big")
+		assert.Equal(t, 400, code) // street is the json name, not the field name
+		code, ret = body("/testfields/p1?fields=Address.Street,Home.City,Big")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Address":{"street":"High St"},"Home":{"City":"Leeds"},"Big":1152921504606846976}`, ret)
+
+		// A nil struct pointer is sent as null
+		code, ret = body("/testfields/p2?fields=Home.City")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Home":null}`, ret)
+
+		// The whole nested struct
+		code, ret = body("/testfields/p2?fields=Id,Address")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"p2","Address":{"City":"Paris","street":""}}`, ret)
+
+		// Unknown, hidden and invalid nested fields
+		for _, f := range []string{"Missing", "Secret", "Id.Length", "Address.Missing", "Address.", ""} {
+			code, ret = body("/testfields/?fields=Id," + f)
+			assert.Equal(t, 400, code, f)
+			assert.Contains(t, ret, "unknown field", f)
+		}
+		code, _ = body("/testfields/p1?fields=Secret")
+		assert.Equal(t, 400, code)
+
+		// Without fields everything is sent
+		code, ret = body("/testfields/p2")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"p2","name":"TWO","Big":0,"Address":{"City":"Paris","street":""},"Home":null}`, ret)
+	})
+}
+
+func TestETag(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+
+		send := func(method string, url string, ifMatch string, body string) *http.Response {
+			req := httptest.NewRequest(method, url, strings.NewReader(body))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			if ifMatch != "" {
+				req.Header.Set("If-Match", ifMatch)
+			}
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			return resp
+		}
+
+		resp := send("GET", "/test/id1", "", "")
+		assert.Equal(t, 200, resp.StatusCode)
+		etag := resp.Header.Get("ETag")
+		assert.NotEmpty(t, etag)
+		assert.Equal(t, etag, send("HEAD", "/test/id1", "", "").Header.Get("ETag"))
+		assert.Equal(t, etag, send("GET", "/test/id1", "", "").Header.Get("ETag")) // stable
+
+		// Stale versions are rejected without changes
+		resp = send("PUT", "/test/id1", `"stale"`, `{"Id":"id1","Data":"changed"}`)
+		assert.Equal(t, 412, resp.StatusCode)
+		resp = send("PATCH", "/test/id1", `"stale"`, `{"Data":"changed"}`)
+		assert.Equal(t, 412, resp.StatusCode)
+		resp = send("DELETE", "/test/id1", `"stale"`, "")
+		assert.Equal(t, 412, resp.StatusCode)
+		assert.Equal(t, "original data", data.entries["id1"].Data)
+
+		// The current version is accepted and changes the ETag
+		resp = send("PUT", "/test/id1", `"stale", `+etag, `{"Id":"id1","Data":"changed"}`)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "changed", data.entries["id1"].Data)
+		resp = send("PUT", "/test/id1", etag, `{"Id":"id1","Data":"again"}`)
+		assert.Equal(t, 412, resp.StatusCode)
+		etag2 := send("GET", "/test/id1", "", "").Header.Get("ETag")
+		assert.NotEqual(t, etag, etag2)
+
+		// Without If-Match, or with *, the write goes ahead as before
+		resp = send("PUT", "/test/id1", "", `{"Id":"id1","Data":"again"}`)
+		assert.Equal(t, 200, resp.StatusCode)
+		resp = send("DELETE", "/test/id1", "*", "")
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+}
+
+func TestETagVersion(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		versionApi := newTestApi(data)
+		versionApi.Path = "testver"
+		versionApi.Version = func(item TestItem) string { return fmt.Sprintf("v%d", len(item.Data)) }
+		RegisterAPI(app, versionApi)
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/testver/id1", nil))
+		assert.Nil(t, err)
+		assert.Equal(t, `"v13"`, resp.Header.Get("ETag"))
+
+		req := httptest.NewRequest("DELETE", "/testver/id1", nil)
+		req.Header.Set("If-Match", `"v13"`)
+		resp, err = app.Test(req)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+
+		get := func(method string, url string, ifNoneMatch string) (*http.Response, string) {
+			req := httptest.NewRequest(method, url, nil)
+			if ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", ifNoneMatch)
+			}
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return resp, string(b)
+		}
+
+		for _, url := range []string{"/test/id1", "/test/?sort=Id", "/test/?sort=Id&fields=Id"} {
+			resp, body := get("GET", url, "")
+			assert.Equal(t, 200, resp.StatusCode, url)
+			assert.NotEmpty(t, body, url)
+			etag := resp.Header.Get("ETag")
+			assert.NotEmpty(t, etag, url)
+
+			// Cached copies are still valid
+			resp, body = get("GET", url, etag)
+			assert.Equal(t, 304, resp.StatusCode, url)
+			assert.Empty(t, body, url)
+			assert.Equal(t, etag, resp.Header.Get("ETag"), url)
+			resp, _ = get("GET", url, `"other", W/`+etag)
+			assert.Equal(t, 304, resp.StatusCode, url)
+			resp, _ = get("GET", url, "*")
+			assert.Equal(t, 304, resp.StatusCode, url)
+
+			// A stale copy gets the body
+			resp, body = get("GET", url, `"other"`)
+			assert.Equal(t, 200, resp.StatusCode, url)
+			assert.NotEmpty(t, body, url)
+		}
+
+		resp, _ := get("GET", "/test/id1", "")
+		etag := resp.Header.Get("ETag")
+		resp, _ = get("HEAD", "/test/id1", etag)
+		assert.Equal(t, 304, resp.StatusCode)
+
+		// Changes invalidate the tags
+		resp, _ = get("GET", "/test/", "")
+		listETag := resp.Header.Get("ETag")
+		code, _, _ := util.GetJsonRequestResponse(app, "PUT", "/test/id1", TestItemDto{Id: "id1", Data: "changed"})
+		assert.Equal(t, 200, code)
+		resp, _ = get("GET", "/test/id1", etag)
+		assert.Equal(t, 200, resp.StatusCode)
+		resp, _ = get("GET", "/test/", listETag)
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+}
+
+func TestETagRepresentation(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		redacted := newTestApi(data)
+		redacted.Path = "testredacttag"
+		redacted.Redact = func(c *fiber.Ctx, action Action, dto TestItemDto) TestItemDto {
+			if c.Get("X-Role") != "admin" {
+				dto.Data = "REDACTED"
+			}
+			return dto
+		}
+		RegisterAPI(app, redacted)
+		versioned := newTestApi(data)
+		versioned.Path = "testvertag"
+		versioned.Version = func(item TestItem) string { return fmt.Sprintf("v%d", len(item.Data)) }
+		RegisterAPI(app, versioned)
+
+		send := func(method string, url string, role string, header string, tag string, body string) (*http.Response, string) {
+			req := httptest.NewRequest(method, url, strings.NewReader(body))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			req.Header.Set("X-Role", role)
+			if tag != "" {
+				req.Header.Set(header, tag)
+			}
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return resp, string(b)
+		}
+
+		// Each role gets the tag of the body it was sent, so a tag of another role's body isn't a 304
+		resp, body := send("GET", "/testredacttag/id1", "admin", "", "", "")
+		assert.Contains(t, body, "original data")
+		adminTag := resp.Header.Get("ETag")
+		resp, body = send("GET", "/testredacttag/id1", "user", fiber.HeaderIfNoneMatch, adminTag, "")
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Contains(t, body, "REDACTED")
+		userTag := resp.Header.Get("ETag")
+		assert.NotEqual(t, adminTag, userTag)
+		resp, _ = send("GET", "/testredacttag/id1", "user", fiber.HeaderIfNoneMatch, userTag, "")
+		assert.Equal(t, 304, resp.StatusCode)
+
+		// As are the tags of other fields
+		resp, _ = send("GET", "/testredacttag/id1?fields=Id", "admin", fiber.HeaderIfNoneMatch, adminTag, "")
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.NotEqual(t, adminTag, resp.Header.Get("ETag"))
+
+		// The tag a client was sent is its current version
+		resp, _ = send("PUT", "/testredacttag/id1", "user", fiber.HeaderIfMatch, userTag, `{"Id":"id1","Data":"changed"}`)
+		assert.Equal(t, 200, resp.StatusCode)
+		resp, _ = send("PUT", "/testredacttag/id1", "user", fiber.HeaderIfMatch, userTag, `{"Id":"id1","Data":"changed again"}`)
+		assert.Equal(t, 200, resp.StatusCode) // the redacted body is unchanged
+		resp, _ = send("PUT", "/testredacttag/id1", "admin", fiber.HeaderIfMatch, adminTag, `{"Id":"id1","Data":"stale"}`)
+		assert.Equal(t, 412, resp.StatusCode)
+
+		// A Version is the tag of the whole Jdo, and is qualified by a hash for other representations
+		resp, _ = send("GET", "/testvertag/id2", "", "", "", "")
+		assert.Equal(t, `"v14"`, resp.Header.Get("ETag"))
+		resp, _ = send("GET", "/testvertag/id2?fields=Id", "", fiber.HeaderIfNoneMatch, `"v14"`, "")
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.True(t, strings.HasPrefix(resp.Header.Get("ETag"), `"v14-`), resp.Header.Get("ETag"))
+	})
+}
+
+func TestEnvelope(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		data.entries["id1"] = TestItem{Id: "id1", Data: "data1", Children: []ChildItem{{"a"}}}
+		data.entries["id2"] = TestItem{Id: "id2", Data: "data2"}
+		collections := newTestApi(data)
+		collections.Path = "testenv"
+		collections.Envelope = EnvelopeCollections
+		RegisterAPI(app, collections)
+		all := newTestApi(data)
+		all.Path = "testenvall"
+		all.Envelope = EnvelopeAll
+		RegisterAPI(app, all)
+
+		body := func(method string, url string, reqBody string) string {
+			req := httptest.NewRequest(method, url, strings.NewReader(reqBody))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return string(b)
+		}
+
+		for _, path := range []string{"testenv", "testenvall"} {
+			assert.Equal(t, `{"data":[{"Id":"id1","Data":"data1"},{"Id":"id2","Data":"data2"}],"meta":{"count":2,"limit":0,"offset":0}}`,
+				body("GET", "/"+path+"/?sort=Id", ""), path)
+			assert.Equal(t, `{"data":[{"Id":"id2","Data":"data2"}],"meta":{"count":1,"limit":1,"offset":1}}`,
+				body("GET", "/"+path+"/?sort=Id&limit=1&offset=1", ""), path)
+			assert.Equal(t, `{"data":[{"Id":"id1"},{"Id":"id2"}],"meta":{"count":2,"limit":0,"offset":0}}`,
+				body("GET", "/"+path+"/?sort=Id&fields=Id", ""), path)
+			assert.Equal(t, `{"data":[{"Id":"id2","Data":"data2"}],"meta":{"count":1,"limit":0,"offset":0}}`,
+				body("POST", "/"+path+"/filter", `{"Id":"id2"}`), path)
+			assert.Equal(t, `{"data":[],"meta":{"count":0,"limit":0,"offset":0}}`,
+				body("POST", "/"+path+"/filter", `{"Id":"none"}`), path)
+			assert.Equal(t, `{"data":[{"Name":"a"}],"meta":{"count":1,"limit":0,"offset":0}}`,
+				body("GET", "/"+path+"/id1/children", ""), path)
+		}
+
+		// Single items are only wrapped with EnvelopeAll
+		assert.Equal(t, `{"Id":"id1","Data":"data1"}`, body("GET", "/testenv/id1", ""))
+		assert.Equal(t, `{"data":{"Id":"id1","Data":"data1"}}`, body("GET", "/testenvall/id1", ""))
+		assert.Equal(t, `{"data":{"Id":"id1"}}`, body("GET", "/testenvall/id1?fields=Id", ""))
+		assert.Equal(t, `{"data":{"Id":"id1","Data":"new"}}`, body("PUT", "/testenvall/id1", `{"Id":"id1","Data":"new"}`))
+		assert.Equal(t, `{"data":{"Id":"id3","Data":"three"}}`, body("POST", "/testenvall/", `{"Id":"id3","Data":"three"}`))
+
+		// Count is unchanged
+		assert.Equal(t, `{"count":3}`, body("GET", "/testenvall/count", ""))
+	})
+}
+
+func TestIncludeLinks(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		data.entries["id 3"] = TestItem{Id: "id 3", Data: "data3"}
+		linked := newTestApi(data)
+		linked.IncludeLinks = true
+		linked.Key = func(item TestItem) string { return item.Id }
+		RegisterAPI(app.Group("/api/v1"), linked)
+		RegisterAPI(app.Group("/api/:version"), linked)
+		noKey := newTestApi(data)
+		noKey.IncludeLinks = true
+		noKey.Path = "nokey"
+		RegisterAPI(app, noKey)
+
+		body := func(method string, url string, reqBody string) string {
+			req := httptest.NewRequest(method, url, strings.NewReader(reqBody))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return string(b)
+		}
+
+		assert.JSONEq(t, `{"Id":"id1","Data":"original data","_links":{"self":"/api/v1/test/id1","children":"/api/v1/test/id1/children"}}`,
+			body("GET", "/api/v1/test/id1", ""))
+		assert.JSONEq(t, `{"Id":"id1","Data":"original data","_links":{"self":"/api/v2/test/id1","children":"/api/v2/test/id1/children"}}`,
+			body("GET", "/api/v2/test/id1", ""))
+
+		// Each element of a list is linked, with the key escaped
+		assert.JSONEq(t, `[
+			{"Id":"id2","_links":{"self":"/api/v1/test/id2","children":"/api/v1/test/id2/children"}},
+			{"Id":"id1","_links":{"self":"/api/v1/test/id1","children":"/api/v1/test/id1/children"}},
+			{"Id":"id 3","_links":{"self":"/api/v1/test/id%203","children":"/api/v1/test/id%203/children"}}]`,
+			body("GET", "/api/v1/test/?sort=-Id&fields=Id", ""))
+		assert.JSONEq(t, `[{"Id":"id1","Data":"original data","_links":{"self":"/api/v1/test/id1","children":"/api/v1/test/id1/children"}}]`,
+			body("POST", "/api/v1/test/filter", `{"Id":"id1"}`))
+
+		// Without Key only single items are linked
+		assert.JSONEq(t, `{"Id":"id1","Data":"original data","_links":{"self":"/nokey/id1","children":"/nokey/id1/children"}}`,
+			body("GET", "/nokey/id1", ""))
+		assert.JSONEq(t, `[{"Id":"id1"}]`, body("GET", "/nokey/?Id=id1&fields=Id", ""))
+
+		// Without IncludeLinks there are none
+		assert.JSONEq(t, `{"Id":"id1","Data":"original data"}`, body("GET", "/test/id1", ""))
+	})
+}
+
+type TestNested struct {
+	Inner struct {
+		Value string
+	}
+	Renamed string `json:"renamed"`
+	Hidden  string `json:"-"`
+}
+
+func TestStrictBody(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		strict := newTestApi(data)
+		strict.Path = "teststrict"
+		strict.StrictBody = true
+		strict.BodyTypes = []string{fiber.MIMEApplicationJSON, fiber.MIMEApplicationForm}
+		RegisterAPI(app, strict)
+
+		send := func(method string, url string, contentType string, body string) (int, string) {
+			req := httptest.NewRequest(method, url, strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, string(b)
+		}
+
+		// Unknown fields are listed
+		code, body := send("POST", "/teststrict/", fiber.MIMEApplicationJSON, `{"Id":"id9","Data":"x","Dtaa":"y","Extra":1}`)
+		assert.Equal(t, 400, code)
+		assert.JSONEq(t, `{"error":"unknown fields: Dtaa, Extra"}`, body)
+		_, ok := data.entries["id9"]
+		assert.False(t, ok)
+		code, body = send("PUT", "/teststrict/id1", fiber.MIMEApplicationJSONCharsetUTF8, `{"Id":"id1","Daat":"changed"}`)
+		assert.Equal(t, 400, code)
+		assert.JSONEq(t, `{"error":"unknown fields: Daat"}`, body)
+		assert.Equal(t, "original data", data.entries["id1"].Data)
+		code, _ = send("POST", "/teststrict/filter", fiber.MIMEApplicationJSON, `{"Idd":"id1"}`)
+		assert.Equal(t, 400, code)
+
+		// Known fields are matched case insensitively, as encoding/json does
+		code, _ = send("PUT", "/teststrict/id1", fiber.MIMEApplicationJSON, `{"id":"id1","data":"changed"}`)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "changed", data.entries["id1"].Data)
+		code, _ = send("POST", "/teststrict/", fiber.MIMEApplicationJSON, `{"Id":"id9","Data":"new"}`)
+		assert.Equal(t, 200, code)
+
+		// Invalid JSON is a 400 with the offset of the error
+		code, body = send("POST", "/teststrict/", fiber.MIMEApplicationJSON, `{"Id":`)
+		assert.Equal(t, 400, code)
+		assert.JSONEq(t, `{"error":"invalid JSON syntax at offset 6"}`, body)
+
+		// Other accepted content types use the BodyParser
+		code, _ = send("POST", "/teststrict/", fiber.MIMEApplicationForm, "Id=id10&Data=form&Extra=1")
+		assert.Equal(t, 200, code)
+
+		// Without StrictBody unknown fields are ignored
+		code, _ = send("PUT", "/test/id1", fiber.MIMEApplicationJSON, `{"Id":"id1","Daat":"changed"}`)
+		assert.Equal(t, 200, code)
+	})
+}
+
+func TestJsonFieldNames(t *testing.T) {
+	type embedded struct {
+		TestNested
+		Own string
+	}
+	assert.Equal(t, map[string]bool{"inner": true, "renamed": true, "own": true},
+		jsonFieldNames(reflect.TypeOf(embedded{})))
+}
+
+type TestValidated struct {
+	Id      string   `validate:"required"`
+	Name    string   `json:"name" validate:"required,max=5"`
+	Age     int      `validate:"min=18,max=130"`
+	Tags    []string `validate:"max=2"`
+	Address struct {
+		City string `validate:"min=2"`
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	valid := TestValidated{Id: "v1", Name: "José", Age: 18}
+	valid.Address.City = "Rome"
+	assert.Nil(t, ValidateTags(valid))
+
+	invalid := TestValidated{Name: "toolong", Age: 17, Tags: []string{"a", "b", "c"}}
+	invalid.Address.City = "X"
+	assert.Equal(t, FieldErrors{
+		{Field: "Id", Rule: "required", Message: "Id is required"},
+		{Field: "name", Rule: "max=5", Message: "name must have at most 5 elements"},
+		{Field: "Age", Rule: "min=18", Message: "Age must be at least 18"},
+		{Field: "Tags", Rule: "max=2", Message: "Tags must have at most 2 elements"},
+		{Field: "Address.City", Rule: "min=2", Message: "Address.City must have at least 2 elements"},
+	}, ValidateTags(invalid))
+
+	type badRule struct {
+		Value int `validate:"positive,min=x"`
+	}
+	assert.Equal(t, FieldErrors{
+		{Field: "Value", Rule: "positive", Message: "Value has an unknown rule 'positive'"},
+		{Field: "Value", Rule: "min=x", Message: "Value has an invalid rule 'min=x'"},
+	}, ValidateTags(badRule{}))
+}
+
+func TestValidateDto(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		var called []string
+		validated := newTestApi(data)
+		validated.Path = "testvalid"
+		validated.ValidateDto = func(dto TestItemDto) error {
+			called = append(called, dto.Id)
+			switch dto.Data {
+			case "":
+				return FieldErrors{{Field: "Data", Rule: "required", Message: "Data is required"}}
+			case "bad":
+				return errors.New("data is bad")
+			}
+			return nil
+		}
+		RegisterAPI(app, validated)
+
+		send := func(method string, url string, body string) (int, string) {
+			req := httptest.NewRequest(method, url, strings.NewReader(body))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, string(b)
+		}
+
+		// Access is checked before validation
+		code, _ := send("POST", "/testvalid/", `{"Id":"id9"}`)
+		assert.Equal(t, 401, code)
+		assert.Empty(t, called)
+
+		data.permit = true
+		code, body := send("POST", "/testvalid/", `{"Id":"id9"}`)
+		assert.Equal(t, 422, code)
+		assert.JSONEq(t, `[{"field":"Data","rule":"required","message":"Data is required"}]`, body)
+		_, ok := data.entries["id9"]
+		assert.False(t, ok)
+
+		code, body = send("PUT", "/testvalid/id1", `{"Id":"id1","Data":"bad"}`)
+		assert.Equal(t, 422, code)
+		assert.JSONEq(t, `[{"field":"","rule":"","message":"data is bad"}]`, body)
+		assert.Equal(t, "original data", data.entries["id1"].Data)
+
+		// Patch validates the patched Jdo
+		code, _ = send("PATCH", "/testvalid/id1", `{"Data":""}`)
+		assert.Equal(t, 422, code)
+		code, _ = send("PATCH", "/testvalid/id1", `{"Data":"patched"}`)
+		assert.Equal(t, 200, code)
+
+		code, _ = send("POST", "/testvalid/", `{"Id":"id9","Data":"good"}`)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, []string{"id9", "id1", "id1", "id1", "id9"}, called)
+	})
+}
+
+func TestSubEntityDto(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		subDto := newTestApi(data)
+		subDto.Path = "testsubdto"
+		subDto.SubEntities[0].Dto = func(child any) any {
+			return map[string]string{"label": strings.ToUpper(child.(ChildItem).Name)}
+		}
+		RegisterAPI(app, subDto)
+		data.entries["id1"] = TestItem{Id: "id1", Children: []ChildItem{{"a"}, {"b"}}}
+
+		code, ret, _ := util.GetJsonSliceRequestResponse(app, "GET", "/testsubdto/id1/children", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, []map[string]any{{"label": "A"}, {"label": "B"}}, ret)
+	})
+}
+
+func TestGetSubEntityItem(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		keyed := newTestApi(data)
+		keyed.Path = "testsubkey"
+		keyed.SubEntities[0].Key = func(child any) string { return child.(ChildItem).Name }
+		RegisterAPI(app, keyed)
+
+		// Unauthorized
+		code, _, _ := util.GetJsonRequestResponse(app, "GET", "/testsubkey/id1/children/a", nil)
+		assert.Equal(t, 401, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testsubkey/missing/children/a", nil)
+		assert.Equal(t, 401, code)
+
+		data.permit = true
+		code, ret, _ := util.GetJsonRequestResponse(app, "GET", "/testsubkey/id1/children/b", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, map[string]any{"Name": "b"}, ret)
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testsubkey/id1/children/c", nil)
+		assert.Equal(t, 404, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testsubkey/missing/children/a", nil)
+		assert.Equal(t, 404, code)
+
+		// Without a Key there is no route
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/test/id1/children/a", nil)
+		assert.Equal(t, 404, code)
+	})
+}
+
+func TestSubEntityPaging(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		data.entries["id1"] = TestItem{Id: "id1", Children: []ChildItem{{"a"}, {"b"}, {"c"}}}
+		paged := newTestApi(data)
+		paged.Path = "testsubpage"
+		paged.SubEntities[0].DefaultPageSize = 2
+		paged.MaxPageSize = 2
+		RegisterAPI(app, paged)
+
+		names := func(url string) []any {
+			code, ret, err := util.GetJsonSliceRequestResponse(app, "GET", url, nil)
+			assert.Equal(t, 200, code, url)
+			assert.Nil(t, err)
+			var res []any
+			for _, child := range ret {
+				res = append(res, child["Name"])
+			}
+			return res
+		}
+		assert.Equal(t, []any{"a", "b", "c"}, names("/test/id1/children"))
+		assert.Equal(t, []any{"b"}, names("/test/id1/children?limit=1&offset=1"))
+		assert.Nil(t, names("/test/id1/children?offset=3"))
+		assert.Nil(t, names("/test/id1/children?offset=100"))
+
+		// Default and maximum page sizes
+		assert.Equal(t, []any{"a", "b"}, names("/testsubpage/id1/children"))
+		assert.Equal(t, []any{"c"}, names("/testsubpage/id1/children?offset=2"))
+		assert.Equal(t, []any{"a", "b"}, names("/testsubpage/id1/children?limit=10"))
+
+		code, _, _ := util.GetJsonRequestResponse(app, "GET", "/test/id1/children?limit=x", nil)
+		assert.Equal(t, 400, code)
+
+		// A paged getter is used in preference to Get
+		var gotLimit, gotOffset int
+		paged.Path = "testsubgetpage"
+		paged.SubEntities = []SubEntity[TestItem, TestItemDto]{{
+			SubPath: "children",
+			Get:     func(item TestItem) []any { return nil },
+			GetPage: func(ctx context.Context, item TestItem, limit, offset int) ([]any, error) {
+				gotLimit, gotOffset = limit, offset
+				if offset > 0 {
+					return nil, errors.New("page error")
+				}
+				return []any{ChildItem{"z"}}, nil
+			},
+		}}
+		RegisterAPI(app, paged)
+		assert.Equal(t, []any{"z"}, names("/testsubgetpage/id1/children?limit=1"))
+		assert.Equal(t, 1, gotLimit)
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testsubgetpage/id1/children?offset=1", nil)
+		assert.Equal(t, 500, code)
+		assert.Equal(t, 1, gotOffset)
+	})
+}
+
+func TestSubEntitySort(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		data.entries["id1"] = TestItem{Id: "id1", Children: []ChildItem{{"b"}, {"c"}, {"a"}}}
+		sorted := newTestApi(data)
+		sorted.Path = "testsubsort"
+		sorted.SubEntities[0].Sort = func(a, b any) bool { return a.(ChildItem).Name > b.(ChildItem).Name }
+		RegisterAPI(app, sorted)
+
+		names := func(url string) []any {
+			code, ret, err := util.GetJsonSliceRequestResponse(app, "GET", url, nil)
+			assert.Equal(t, 200, code, url)
+			assert.Nil(t, err)
+			var res []any
+			for _, child := range ret {
+				res = append(res, child["Name"])
+			}
+			return res
+		}
+		assert.Equal(t, []any{"b", "c", "a"}, names("/test/id1/children"))
+		assert.Equal(t, []any{"c", "b", "a"}, names("/testsubsort/id1/children"))
+		assert.Equal(t, []any{"b"}, names("/testsubsort/id1/children?limit=1&offset=1"))
+		// The item's own children are left in order
+		assert.Equal(t, []ChildItem{{"b"}, {"c"}, {"a"}}, data.entries["id1"].Children)
+	})
+}
+
+func TestWritableSubEntity(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		var actions []Action
+		writable := newTestApi(data)
+		writable.Path = "testsubwrite"
+		writable.Validator = func(c *fiber.Ctx, action Action, item ...TestItem) bool {
+			actions = append(actions, action)
+			return data.permit
+		}
+		writable.SubEntities[0].Add = func(ctx context.Context, parent TestItem, decode func(child any) error) (any, error) {
+			var child ChildItem
+			if err := decode(&child); err != nil {
+				return nil, err
+			}
+			data.lock.Lock()
+			defer data.lock.Unlock()
+			parent.Children = append(parent.Children, child)
+			data.entries[parent.Id] = parent
+			return child, nil
+		}
+		writable.SubEntities[0].Remove = func(ctx context.Context, parent TestItem, childKey string) error {
+			data.lock.Lock()
+			defer data.lock.Unlock()
+			for i, child := range parent.Children {
+				if child.Name == childKey {
+					parent.Children = append(parent.Children[:i], parent.Children[i+1:]...)
+					data.entries[parent.Id] = parent
+					return nil
+				}
+			}
+			return ErrNotFound
+		}
+		RegisterAPI(app, writable)
+
+		// Unauthorized, checked as a mutation of the parent
+		code, _, _ := util.GetJsonRequestResponse(app, "POST", "/testsubwrite/id1/children", map[string]any{"Name": "c"})
+		assert.Equal(t, 401, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "DELETE", "/testsubwrite/id1/children/a", nil)
+		assert.Equal(t, 401, code)
+		assert.Equal(t, []Action{ActionMutate, ActionMutate}, actions)
+
+		data.permit = true
+		code, ret, _ := util.GetJsonRequestResponse(app, "POST", "/testsubwrite/id1/children", map[string]any{"Name": "c"})
+		assert.Equal(t, 200, code)
+		assert.Equal(t, map[string]any{"Name": "c"}, ret)
+		assert.Equal(t, []ChildItem{{"a"}, {"b"}, {"c"}}, data.entries["id1"].Children)
+
+		code, _, _ = util.GetJsonRequestResponse(app, "DELETE", "/testsubwrite/id1/children/a", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, []ChildItem{{"b"}, {"c"}}, data.entries["id1"].Children)
+		code, _, _ = util.GetJsonRequestResponse(app, "DELETE", "/testsubwrite/id1/children/a", nil)
+		assert.Equal(t, 404, code)
+
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testsubwrite/missing/children", map[string]any{"Name": "c"})
+		assert.Equal(t, 404, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "DELETE", "/testsubwrite/missing/children/a", nil)
+		assert.Equal(t, 404, code)
+
+		// The body is parsed as it is for create
+		req := httptest.NewRequest("POST", "/testsubwrite/id1/children", strings.NewReader("{"))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req)
+		assert.Equal(t, 400, resp.StatusCode)
+		req = httptest.NewRequest("POST", "/testsubwrite/id1/children", strings.NewReader(`{"Name":"d"}`))
+		req.Header.Set("Content-Type", "text/plain")
+		resp, _ = app.Test(req)
+		assert.Equal(t, 415, resp.StatusCode)
+		limited := writable
+		limited.Path = "testsubwritelimited"
+		limited.MaxBodyBytes = 8
+		RegisterAPI(app, limited)
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testsubwritelimited/id1/children", map[string]any{"Name": "too long"})
+		assert.Equal(t, 413, code)
+		strict := writable
+		strict.Path = "testsubwritestrict"
+		strict.StrictBody = true
+		RegisterAPI(app, strict)
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testsubwritestrict/id1/children", map[string]any{"Name": "d", "Other": 1})
+		assert.Equal(t, 400, code)
+		assert.Equal(t, []ChildItem{{"b"}, {"c"}}, data.entries["id1"].Children)
+
+		// Read only without Add and Remove
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/test/id1/children", map[string]any{"Name": "c"})
+		assert.Equal(t, 405, code)
+	})
+}
+
+func TestNestedSubEntity(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.entries["id1"] = TestItem{Id: "id1", Children: []ChildItem{{"ab"}, {"cd"}}}
+		nested := newTestApi(data)
+		nested.Path = "testnested"
+		// children have their letters as children, and each letter its upper case form
+		nested.SubEntities[0].Key = func(child any) string { return child.(ChildItem).Name }
+		nested.SubEntities[0].SubEntities = []SubEntity[any, any]{{
+			SubPath: "letters",
+			Get: func(child any) []any {
+				var letters []any
+				for _, r := range child.(ChildItem).Name {
+					letters = append(letters, string(r))
+				}
+				return letters
+			},
+			Key: func(letter any) string { return letter.(string) },
+			SubEntities: []SubEntity[any, any]{{
+				SubPath: "upper",
+				Get:     func(letter any) []any { return []any{strings.ToUpper(letter.(string))} },
+				Key:     func(upper any) string { return upper.(string) },
+				Dto:     func(upper any) any { return map[string]any{"Upper": upper} },
+			}},
+		}}
+		RegisterAPI(app, nested)
+
+		code, _, _ := util.GetJsonSliceRequestResponse(app, "GET", "/testnested/id1/children/ab/letters", nil)
+		assert.Equal(t, 401, code)
+
+		data.permit = true
+		code, list, _ := util.GetJsonSliceRequestResponse(app, "GET", "/testnested/id1/children/cd/letters/d/upper", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, []map[string]any{{"Upper": "D"}}, list)
+		code, ret, _ := util.GetJsonRequestResponse(app, "GET", "/testnested/id1/children/ab/letters/a/upper/A", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, map[string]any{"Upper": "A"}, ret)
+
+		req := httptest.NewRequest("GET", "/testnested/id1/children/ab/letters?limit=1&offset=1", nil)
+		resp, _ := app.Test(req)
+		assert.Equal(t, 200, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, `["b"]`, string(body))
+		req = httptest.NewRequest("GET", "/testnested/id1/children/ab/letters/b", nil)
+		resp, _ = app.Test(req)
+		assert.Equal(t, 200, resp.StatusCode)
+		body, _ = io.ReadAll(resp.Body)
+		assert.Equal(t, `"b"`, string(body))
+
+		// Missing at each level
+		for _, url := range []string{
+			"/testnested/missing/children/ab/letters",
+			"/testnested/id1/children/xx/letters",
+			"/testnested/id1/children/ab/letters/c",
+			"/testnested/id1/children/ab/letters/c/upper",
+			"/testnested/id1/children/ab/letters/a/upper/B",
+		} {
+			code, _, _ = util.GetJsonRequestResponse(app, "GET", url, nil)
+			assert.Equal(t, 404, code, url)
+		}
+	})
+}
+
+func TestOptions(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		readOnly := newTestApi(data)
+		readOnly.Path = "testreadonly"
+		readOnly.Create = nil
+		readOnly.Mutate = nil
+		readOnly.Patch = nil
+		readOnly.Delete = nil
+		RegisterAPI(app, readOnly)
+
+		allow := func(url string) string {
+			req := httptest.NewRequest("OPTIONS", url, nil)
+			resp, _ := app.Test(req)
+			assert.Equal(t, 204, resp.StatusCode, url)
+			return resp.Header.Get("Allow")
+		}
+		assert.Equal(t, "GET, HEAD, POST, OPTIONS", allow("/test"))
+		assert.Equal(t, "GET, HEAD, PUT, PATCH, DELETE, OPTIONS", allow("/test/id1"))
+		assert.Equal(t, "GET, HEAD, OPTIONS", allow("/testreadonly"))
+		assert.Equal(t, "GET, HEAD, OPTIONS", allow("/testreadonly/id1"))
+
+		// Create is only served if provided
+		req := httptest.NewRequest("POST", "/testreadonly", strings.NewReader(`{"Id":"id3"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req)
+		assert.Equal(t, 405, resp.StatusCode)
+	})
+}
+
+func TestCustomActions(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		var actions []Action
+		custom := newTestApi(data)
+		custom.Path = "testcustom"
+		custom.Validator = func(c *fiber.Ctx, action Action, item ...TestItem) bool {
+			actions = append(actions, action)
+			return data.permit
+		}
+		custom.CustomActions = []CustomAction[TestItem, TestItemDto]{
+			{
+				SubPath: "promote",
+				Handler: func(c *fiber.Ctx, item TestItem) (TestItemDto, error) {
+					data.lock.Lock()
+					defer data.lock.Unlock()
+					item.Data = "promoted " + c.Query("to")
+					data.entries[item.Id] = item
+					return ItemToDto(item), nil
+				},
+			},
+			{
+				SubPath: "archive",
+				Method:  "PUT",
+				Handler: func(c *fiber.Ctx, item TestItem) (TestItemDto, error) {
+					return TestItemDto{}, fmt.Errorf("%w: already archived", ErrConflict)
+				},
+			},
+			{
+				SubPath:    "summary",
+				Method:     "GET",
+				Collection: true,
+				Handler: func(c *fiber.Ctx, item TestItem) (TestItemDto, error) {
+					data.lock.Lock()
+					defer data.lock.Unlock()
+					return TestItemDto{Id: "summary", Data: fmt.Sprint(len(data.entries))}, nil
+				},
+			},
+		}
+		RegisterAPI(app, custom)
+
+		// Unauthorized
+		code, _, _ := util.GetJsonRequestResponse(app, "POST", "/testcustom/id1/promote", nil)
+		assert.Equal(t, 401, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testcustom/missing/promote", nil)
+		assert.Equal(t, 401, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testcustom/summary", nil)
+		assert.Equal(t, 401, code)
+		assert.Equal(t, []Action{ActionCustom, ActionCustom, ActionCustom}, actions)
+		assert.Equal(t, "original data", data.entries["id1"].Data)
+
+		data.permit = true
+		code, ret, _ := util.GetJsonRequestResponse(app, "POST", "/testcustom/id1/promote?to=manager", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, map[string]any{"Id": "id1", "Data": "promoted manager"}, ret)
+		assert.Equal(t, "promoted manager", data.entries["id1"].Data)
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testcustom/missing/promote", nil)
+		assert.Equal(t, 404, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testcustom/id1/promote", nil)
+		assert.Equal(t, 405, code)
+
+		code, ret, _ = util.GetJsonRequestResponse(app, "PUT", "/testcustom/id1/archive", nil)
+		assert.Equal(t, 409, code)
+		assert.Equal(t, "conflict: already archived", ret["error"])
+
+		// The collection action is not treated as a key
+		code, ret, _ = util.GetJsonRequestResponse(app, "GET", "/testcustom/summary", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, map[string]any{"Id": "summary", "Data": "2"}, ret)
+	})
+}
+
+func TestReservedKeys(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		reserved := newTestApi(data)
+		reserved.Path = "testreserved"
+		reserved.Subscriptions = true
+		reserved.UpsertOnPut = true
+		reserved.SetKey = func(dto *TestItemDto, key string) error {
+			dto.Id = key
+			return nil
+		}
+		reserved.CustomActions = []CustomAction[TestItem, TestItemDto]{
+			{SubPath: "summary", Method: "GET", Collection: true, Handler: func(c *fiber.Ctx, item TestItem) (TestItemDto, error) {
+				return TestItemDto{}, nil
+			}},
+			{SubPath: "rebuild", Collection: true, Handler: func(c *fiber.Ctx, item TestItem) (TestItemDto, error) {
+				return TestItemDto{}, nil
+			}},
+		}
+		reg := MustRegisterAPI(app, reserved)
+		assert.Equal(t, []string{"count", "ws", "summary"}, reg.Reserved)
+
+		// Upserting a reserved key is rejected
+		code, ret, _ := util.GetJsonRequestResponse(app, "PUT", "/testreserved/summary", TestItemDto{Data: "new"})
+		assert.Equal(t, 422, code)
+		assert.Equal(t, "validation failed: key 'summary' is reserved", ret["error"])
+		_, ok := data.entries["summary"]
+		assert.False(t, ok)
+
+		// "filter" is only POST so an item with that key can be fetched, updated and deleted
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testreserved", TestItemDto{Id: "filter", Data: "new"})
+		assert.Equal(t, 200, code)
+		code, ret, _ = util.GetJsonRequestResponse(app, "GET", "/testreserved/filter", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "new", ret["Data"])
+		code, _, _ = util.GetJsonRequestResponse(app, "PUT", "/testreserved/rebuild", TestItemDto{Data: "rebuilt"})
+		assert.Equal(t, 201, code)
+		code, ret, _ = util.GetJsonRequestResponse(app, "GET", "/testreserved/rebuild", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "rebuilt", ret["Data"])
+	})
+}
+
+func TestStrictRouting(t *testing.T) {
+	assert.NotPanics(t, func() {
+		_, data := setup()
+		app := fiber.New(fiber.Config{StrictRouting: true})
+		defer cleanup(app)
+		data.permit = true
+		reg := MustRegisterAPI(app, newTestApi(data))
+		assert.Contains(t, reg.Routes, Route{fiber.MethodGet, "/test"})
+		assert.Contains(t, reg.Routes, Route{fiber.MethodGet, "/test/"})
+
+		for _, url := range []string{"/test", "/test/"} {
+			code, ret, err := util.GetJsonSliceRequestResponse(app, "GET", url, nil)
+			assert.Nil(t, err)
+			assert.Equal(t, 200, code, url)
+			assert.Len(t, ret, 2, url)
+		}
+		for _, url := range []string{"/test/filter", "/test/filter/"} {
+			code, ret, err := util.GetJsonSliceRequestResponse(app, "POST", url, TestItemDto{Id: "id1"})
+			assert.Nil(t, err)
+			assert.Equal(t, 200, code, url)
+			assert.Len(t, ret, 1, url)
+		}
+		code, _, _ := util.GetJsonRequestResponse(app, "POST", "/test", TestItemDto{Id: "id3", Data: "new"})
+		assert.Equal(t, 200, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/test/", TestItemDto{Id: "id4", Data: "new"})
+		assert.Equal(t, 200, code)
+		assert.Len(t, data.entries, 4)
+		code, ret, _ := util.GetJsonRequestResponse(app, "GET", "/test/count/", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, 4.0, ret["count"])
+	})
+}
+
+func TestMethodOverride(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		var actions []Action
+		override := newTestApi(data)
+		override.Path = "testoverride"
+		override.MethodOverride = true
+		override.Validator = func(c *fiber.Ctx, action Action, item ...TestItem) bool {
+			actions = append(actions, action)
+			return data.permit
+		}
+		RegisterAPI(app, override)
+
+		post := func(url string, method string, body string) (int, string) {
+			req := httptest.NewRequest("POST", url, strings.NewReader(body))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			if method != "" {
+				req.Header.Set(HeaderMethodOverride, method)
+			}
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, string(b)
+		}
+
+		// Denied with the Action of the method
+		code, _ := post("/testoverride/id1", "DELETE", "")
+		assert.Equal(t, 401, code)
+		assert.Equal(t, []Action{ActionDelete}, actions)
+
+		data.permit = true
+		actions = nil
+		code, body := post("/testoverride/id1", "PUT", `{"Id":"id1","Data":"put"}`)
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"id1","Data":"put"}`, body)
+		assert.Equal(t, "put", data.entries["id1"].Data)
+		code, _ = post("/testoverride/id1", "patch", `{"Data":"patched"}`)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "patched", data.entries["id1"].Data)
+		code, _ = post("/testoverride/id1", "DELETE", "")
+		assert.Equal(t, 200, code)
+		_, ok := data.entries["id1"]
+		assert.False(t, ok)
+		assert.Equal(t, []Action{ActionMutate, ActionMutate, ActionDelete}, actions)
+
+		// Only PUT, PATCH and DELETE can be sent as POST
+		code, _ = post("/testoverride/id2", "GET", "")
+		assert.Equal(t, 405, code)
+		code, _ = post("/testoverride/id2", "", `{"Id":"id2","Data":"post"}`)
+		assert.Equal(t, 405, code)
+
+		// The header is ignored unless enabled
+		code, _ = post("/test/id2", "DELETE", "")
+		assert.Equal(t, 405, code)
+		_, ok = data.entries["id2"]
+		assert.True(t, ok)
+	})
+}
+
+func TestErrorHandler(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		var errs []error
+		handled := newTestApi(data)
+		handled.Path = "testhandled"
+		handled.ErrorHandler = func(c *fiber.Ctx, status int, err error) error {
+			errs = append(errs, err)
+			if status == fiber.StatusInternalServerError {
+				status = fiber.StatusServiceUnavailable
+			}
+			return c.Status(status).JSON(fiber.Map{"message": err.Error(), "correlation": c.Get("X-Request-Id")})
+		}
+		RegisterAPI(app, handled)
+
+		send := func(method, url string, body string) (int, map[string]any) {
+			req := httptest.NewRequest(method, url, strings.NewReader(body))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			req.Header.Set("X-Request-Id", "req1")
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			var ret map[string]any
+			_ = json.NewDecoder(resp.Body).Decode(&ret)
+			return resp.StatusCode, ret
+		}
+
+		// The original error of a failing Mutate, with the status changed
+		data.fail = true
+		code, ret := send("PUT", "/testhandled/id1", `{"Id":"id1","Data":"changed"}`)
+		assert.Equal(t, 503, code)
+		assert.Equal(t, map[string]any{"message": "update error", "correlation": "req1"}, ret)
+		if assert.Len(t, errs, 1) {
+			assert.EqualError(t, errs[0], "update error")
+		}
+		data.fail = false
+
+		// A status without an error
+		code, ret = send("GET", "/testhandled/idmissing", "")
+		assert.Equal(t, 404, code)
+		assert.Equal(t, "Not Found", ret["message"])
+		var fe *fiber.Error
+		assert.ErrorAs(t, errs[1], &fe)
+
+		// Denials and bad bodies
+		data.permit = false
+		code, ret = send("GET", "/testhandled/id1", "")
+		assert.Equal(t, 401, code)
+		assert.Equal(t, "Unauthorized", ret["message"])
+		data.permit = true
+		code, _ = send("POST", "/testhandled", `{"Id":`)
+		assert.Equal(t, 400, code)
+		assert.Len(t, errs, 4)
+
+		// Other apis are unaffected
+		data.fail = true
+		code, _ = send("PUT", "/test/id1", `{"Id":"id1","Data":"changed"}`)
+		assert.Equal(t, 500, code)
+		assert.Len(t, errs, 4)
+	})
+}
+
+// TestUnencodableDto is a Jdo that fails to encode as JSON
+type TestUnencodableDto struct {
+	Id string
+}
+
+func (d TestUnencodableDto) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("unencodable")
+}
+
+func TestErrorHandlerOutgoing(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		test := newTestApi(data)
+		var errs []error
+		handled := Api[TestItem, TestUnencodableDto]{
+			Path:    "testunencodable",
+			Find:    test.Find,
+			FindAll: test.FindAll,
+			Search: func(filter TestUnencodableDto) []TestItem {
+				return test.FindAll()
+			},
+			Patch: func(item TestItem, fields map[string]any) (TestItem, error) {
+				return item, nil
+			},
+			Dto: func(item TestItem) TestUnencodableDto {
+				return TestUnencodableDto{Id: item.Id}
+			},
+			OmitZeroFields: true,
+			ErrorHandler: func(c *fiber.Ctx, status int, err error) error {
+				errs = append(errs, err)
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"message": err.Error()})
+			},
+		}
+		RegisterAPI(app, handled)
+
+		// Failures preparing the Jdos are sent by the ErrorHandler
+		requests := []struct {
+			method string
+			url    string
+			body   string
+		}{
+			{"GET", "/testunencodable", ""},
+			{"GET", "/testunencodable/id1", ""},
+			{"POST", "/testunencodable/filter", `{}`},
+		}
+		for i, r := range requests {
+			req := httptest.NewRequest(r.method, r.url, strings.NewReader(r.body))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			assert.Equal(t, 503, resp.StatusCode, r.method+" "+r.url)
+			assert.Len(t, errs, i+1, r.method+" "+r.url)
+		}
+		req := httptest.NewRequest("PATCH", "/testunencodable/id1", strings.NewReader(`[{"op":"test","path":"/Id","value":"id1"}]`))
+		req.Header.Set("Content-Type", MIMEApplicationJSONPatch)
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		assert.Equal(t, 503, resp.StatusCode)
+		if assert.Len(t, errs, 4) {
+			assert.ErrorContains(t, errs[3], "unencodable")
+		}
+	})
+}
+
+func TestSerializeMutations(t *testing.T) {
+	assert.NotPanics(t, func() {
+		type counter struct {
+			Id string
+			N  int
+		}
+		var lock sync.Mutex
+		counters := map[string]counter{"a": {Id: "a"}, "b": {Id: "b"}}
+		newApi := func(path string, serialize bool) Api[counter, counter] {
+			return Api[counter, counter]{
+				Path: path,
+				Find: func(key string) (counter, bool) {
+					lock.Lock()
+					defer lock.Unlock()
+					item, ok := counters[key]
+					return item, ok
+				},
+				FindAll: func() []counter { return nil },
+				// Increments the counter as found, so interleaved requests lose updates
+				Mutate: func(item counter, _ counter) (counter, error) {
+					time.Sleep(time.Millisecond)
+					item.N++
+					lock.Lock()
+					defer lock.Unlock()
+					counters[item.Id] = item
+					return item, nil
+				},
+				Dto:                func(item counter) counter { return item },
+				SerializeMutations: serialize,
+			}
+		}
+		app := fiber.New()
+		defer cleanup(app)
+		serialized := newApi("serialized", true)
+		RegisterAPI(app, serialized)
+		RegisterAPI(app, newApi("parallel", false))
+
+		put := func(url string, n int) {
+			var wg sync.WaitGroup
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					req := httptest.NewRequest("PUT", url, strings.NewReader(`{}`))
+					req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+					resp, err := app.Test(req, -1)
+					assert.Nil(t, err)
+					assert.Equal(t, 200, resp.StatusCode)
+				}()
+			}
+			wg.Wait()
+		}
+
+		put("/serialized/a", 20)
+		assert.Equal(t, 20, counters["a"].N)
+		put("/parallel/b", 20)
+		assert.Less(t, counters["b"].N, 20, "updates are lost without SerializeMutations")
+	})
+}
+
+func TestKeyLocks(t *testing.T) {
+	locks := newKeyLocks()
+	unlockA := locks.lock("a")
+	unlockB := locks.lock("b") // Other keys aren't blocked
+	assert.Equal(t, 2, locks.size())
+
+	locked := make(chan bool)
+	go func() {
+		unlock := locks.lock("a")
+		locked <- true
+		unlock()
+	}()
+	select {
+	case <-locked:
+		t.Fatal("a was locked twice")
+	case <-time.After(10 * time.Millisecond):
+	}
+	unlockA()
+	<-locked
+	unlockB()
+
+	// Reclaimed once unlocked
+	assert.Eventually(t, func() bool { return locks.size() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestUpsertOnPut(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		var actions []Action
+		upsert := newTestApi(data)
+		upsert.Path = "testupsert"
+		upsert.UpsertOnPut = true
+		upsert.SetKey = func(dto *TestItemDto, key string) error {
+			dto.Id = key
+			return nil
+		}
+		upsert.Validator = func(c *fiber.Ctx, action Action, item ...TestItem) bool {
+			actions = append(actions, action)
+			return data.permit
+		}
+		RegisterAPI(app, upsert)
+
+		code, _, _ := util.GetJsonRequestResponse(app, "PUT", "/testupsert/id3", TestItemDto{Data: "new"})
+		assert.Equal(t, 401, code)
+		assert.Equal(t, []Action{ActionCreate}, actions)
+
+		data.permit = true
+		code, ret, _ := util.GetJsonRequestResponse(app, "PUT", "/testupsert/id3", TestItemDto{Data: "new"})
+		assert.Equal(t, 201, code)
+		assert.Equal(t, map[string]any{"Id": "id3", "Data": "new"}, ret)
+		assert.Equal(t, "new", data.entries["id3"].Data)
+
+		// The key in the path wins over the body
+		code, ret, _ = util.GetJsonRequestResponse(app, "PUT", "/testupsert/id4", TestItemDto{Id: "id5", Data: "moved"})
+		assert.Equal(t, 201, code)
+		assert.Equal(t, "id4", ret["Id"])
+		assert.Equal(t, "moved", data.entries["id4"].Data)
+		_, found := data.entries["id5"]
+		assert.False(t, found)
+
+		// An existing item is mutated
+		code, _, _ = util.GetJsonRequestResponse(app, "PUT", "/testupsert/id3", TestItemDto{Id: "id3", Data: "changed"})
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "changed", data.entries["id3"].Data)
+
+		// Without the flag a missing key is still 404
+		code, _, _ = util.GetJsonRequestResponse(app, "PUT", "/test/id6", TestItemDto{Id: "id6", Data: "new"})
+		assert.Equal(t, 404, code)
+		_, found = data.entries["id6"]
+		assert.False(t, found)
+	})
+}
+
+// newStreamApi has only an iterator over n generated items
+func newStreamApi(path string, n int) Api[TestItem, TestItemDto] {
+	return Api[TestItem, TestItemDto]{
+		Path: path,
+		Find: func(key string) (TestItem, bool) { return TestItem{}, false },
+		IterateAll: func(yield func(TestItem) bool) {
+			for i := 0; i < n; i++ {
+				if !yield(TestItem{Id: fmt.Sprintf("id%d", i), Data: "data"}) {
+					return
+				}
+			}
+		},
+		Dto: ItemToDto,
+		Key: func(item TestItem) string { return item.Id },
+	}
+}
+
+func TestStreamAll(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, _ := setup()
+		defer cleanup(app)
+		RegisterAPI(app, newStreamApi("teststream", 3))
+		empty := newStreamApi("teststreamempty", 0)
+		RegisterAPI(app, empty)
+		enveloped := newStreamApi("teststreamenvelope", 2)
+		enveloped.Envelope = EnvelopeCollections
+		enveloped.IncludeLinks = true
+		RegisterAPI(app, enveloped)
+
+		get := func(url string) (int, string, http.Header) {
+			resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+			assert.Nil(t, err)
+			body, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, string(body), resp.Header
+		}
+
+		code, body, header := get("/teststream")
+		assert.Equal(t, 200, code)
+		assert.Equal(t, `[{"Id":"id0","Data":"data"},{"Id":"id1","Data":"data"},{"Id":"id2","Data":"data"}]`, body)
+		assert.Equal(t, "application/json", header.Get("Content-Type"))
+		assert.Equal(t, "", header.Get("ETag"))
+
+		code, body, _ = get("/teststreamempty")
+		assert.Equal(t, 200, code)
+		assert.Equal(t, `[]`, body)
+
+		code, body, _ = get("/teststreamenvelope")
+		assert.Equal(t, 200, code)
+		var env map[string]any
+		assert.Nil(t, json.Unmarshal([]byte(body), &env))
+		assert.Equal(t, map[string]any{"count": 2.0, "limit": 0.0, "offset": 0.0}, env["meta"])
+		data := env["data"].([]any)
+		assert.Len(t, data, 2)
+		assert.Equal(t, map[string]any{"self": "/teststreamenvelope/id1"}, data[1].(map[string]any)["_links"])
+
+		// Paged requests are buffered from the iterator
+		code, body, header = get("/teststream?limit=1&offset=1")
+		assert.Equal(t, 200, code)
+		assert.Equal(t, `[{"Id":"id1","Data":"data"}]`, body)
+		assert.NotEqual(t, "", header.Get("ETag"))
+		code, body, _ = get("/teststream?fields=Id&sort=-Id")
+		assert.Equal(t, 200, code)
+		assert.Equal(t, `[{"Id":"id2"},{"Id":"id1"},{"Id":"id0"}]`, body)
+	})
+}
+
+// BenchmarkGetAll compares streaming with buffering the list.  The bytes allocated per item stay
+// flat when streaming, as only one item is held at a time, while buffering grows with the list.
+func BenchmarkGetAll(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		for _, stream := range []bool{true, false} {
+			api := newStreamApi("bench", n)
+			name := "stream"
+			if !stream {
+				name = "buffered"
+				iterate := api.IterateAll
+				api.IterateAll = nil
+				api.FindAll = func() []TestItem {
+					var all []TestItem
+					iterate(func(item TestItem) bool {
+						all = append(all, item)
+						return true
+					})
+					return all
+				}
+			}
+			b.Run(fmt.Sprintf("%s-%d", name, n), func(b *testing.B) {
+				app := fiber.New()
+				RegisterAPI(app, api)
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					resp, err := app.Test(httptest.NewRequest("GET", "/bench", nil), -1)
+					if err != nil {
+						b.Fatal(err)
+					}
+					_, _ = io.Copy(io.Discard, resp.Body)
+				}
+			})
+		}
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		RegisterAPI(app, newStreamApi("teststream", 250))
+
+		lines := func(req *http.Request) []TestItemDto {
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			assert.Equal(t, 200, resp.StatusCode)
+			assert.Equal(t, MIMEApplicationNDJSON, resp.Header.Get("Content-Type"))
+			var rows []TestItemDto
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				var row TestItemDto
+				assert.Nil(t, json.Unmarshal(scanner.Bytes(), &row), scanner.Text())
+				rows = append(rows, row)
+			}
+			return rows
+		}
+
+		// Streamed from the iterator
+		rows := lines(httptest.NewRequest("GET", "/teststream?format=ndjson", nil))
+		assert.Len(t, rows, 250)
+		assert.Equal(t, TestItemDto{Id: "id249", Data: "data"}, rows[249])
+
+		// From FindAll, selected with the Accept header
+		req := httptest.NewRequest("GET", "/test?sort=Id", nil)
+		req.Header.Set("Accept", MIMEApplicationNDJSON)
+		rows = lines(req)
+		assert.Equal(t, []TestItemDto{{Id: "id1", Data: "original data"}, {Id: "id2", Data: "original data2"}}, rows)
+
+		// JSON remains the default
+		code, list, _ := util.GetJsonSliceRequestResponse(app, "GET", "/test", nil)
+		assert.Equal(t, 200, code)
+		assert.Len(t, list, 2)
+	})
+}
+
+func TestXML(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		enveloped := newTestApi(data)
+		enveloped.Path = "testxmlenvelope"
+		enveloped.Envelope = EnvelopeAll
+		RegisterAPI(app, enveloped)
+
+		send := func(method, url, body string) (int, string, string) {
+			req := httptest.NewRequest(method, url, strings.NewReader(body))
+			req.Header.Set("Accept", "application/xml")
+			if body != "" {
+				req.Header.Set("Content-Type", "application/xml")
+			}
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, resp.Header.Get("Content-Type"), string(b)
+		}
+
+		// Create
+		code, mime, body := send("POST", "/test", `<TestItemDto><Id>id3</Id><Data>from xml</Data></TestItemDto>`)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "application/xml", mime)
+		assert.Equal(t, `<TestItemDto><Id>id3</Id><Data>from xml</Data></TestItemDto>`, body)
+		assert.Equal(t, "from xml", data.entries["id3"].Data)
+
+		// Read
+		code, _, body = send("GET", "/test/id3", "")
+		assert.Equal(t, 200, code)
+		assert.Equal(t, `<TestItemDto><Id>id3</Id><Data>from xml</Data></TestItemDto>`, body)
+		code, _, body = send("GET", "/test?sort=Id", "")
+		assert.Equal(t, 200, code)
+		var list struct {
+			Items []TestItemDto `xml:"item"`
+		}
+		assert.Nil(t, xml.Unmarshal([]byte(body), &list))
+		assert.Equal(t, []TestItemDto{{"id1", "original data"}, {"id2", "original data2"}, {"id3", "from xml"}}, list.Items)
+		code, _, body = send("GET", "/test/count", "")
+		assert.Equal(t, 200, code)
+		assert.Equal(t, `<count>3</count>`, body)
+
+		// Update
+		code, _, body = send("PUT", "/test/id3", `<TestItemDto><Id>id3</Id><Data>changed</Data></TestItemDto>`)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, `<TestItemDto><Id>id3</Id><Data>changed</Data></TestItemDto>`, body)
+		assert.Equal(t, "changed", data.entries["id3"].Data)
+
+		// Envelopes
+		code, _, body = send("GET", "/testxmlenvelope/id3", "")
+		assert.Equal(t, 200, code)
+		assert.Equal(t, `<envelope><data><Id>id3</Id><Data>changed</Data></data></envelope>`, body)
+		code, _, body = send("GET", "/testxmlenvelope?sort=Id&limit=1", "")
+		assert.Equal(t, 200, code)
+		assert.Equal(t, `<envelope><data><item><Id>id1</Id><Data>original data</Data></item></data><meta><count>1</count><limit>1</limit><offset>0</offset></meta></envelope>`, body)
+
+		// Selected fields are maps that can't be sent as XML
+		code, _, _ = send("GET", "/test?fields=Id", "")
+		assert.Equal(t, 406, code)
+
+		// JSON remains the default
+		code, ret, _ := util.GetJsonRequestResponse(app, "GET", "/test/id3", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "changed", ret["Data"])
+	})
+}
+
+func TestMsgpack(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+
+		send := func(method, url string, body any) (int, string, []byte) {
+			var reader io.Reader
+			if body != nil {
+				b, err := msgpack.Marshal(body)
+				assert.Nil(t, err)
+				reader = bytes.NewReader(b)
+			}
+			req := httptest.NewRequest(method, url, reader)
+			req.Header.Set("Accept", MIMEApplicationMsgpack)
+			if body != nil {
+				req.Header.Set("Content-Type", MIMEApplicationMsgpack)
+			}
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, resp.Header.Get("Content-Type"), b
+		}
+
+		code, mime, body := send("POST", "/test", map[string]any{"Id": "id3", "Data": "packed"})
+		assert.Equal(t, 200, code)
+		assert.Equal(t, MIMEApplicationMsgpack, mime)
+		var item TestItemDto
+		assert.Nil(t, msgpack.Unmarshal(body, &item))
+		assert.Equal(t, TestItemDto{Id: "id3", Data: "packed"}, item)
+		assert.Equal(t, "packed", data.entries["id3"].Data)
+
+		code, _, body = send("PATCH", "/test/id3", map[string]any{"Data": "patched"})
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "patched", data.entries["id3"].Data)
+
+		code, _, body = send("GET", "/test?sort=Id", nil)
+		assert.Equal(t, 200, code)
+		var list []TestItemDto
+		assert.Nil(t, msgpack.Unmarshal(body, &list))
+		assert.Equal(t, []TestItemDto{{"id1", "original data"}, {"id2", "original data2"}, {"id3", "patched"}}, list)
+
+		code, _, body = send("GET", "/test/count", nil)
+		assert.Equal(t, 200, code)
+		var count map[string]int
+		assert.Nil(t, msgpack.Unmarshal(body, &count))
+		assert.Equal(t, map[string]int{"count": 3}, count)
+	})
+}
+
+// BenchmarkGetAllCodecs compares a 1,000 item GET / as JSON and as MessagePack
+func BenchmarkGetAllCodecs(b *testing.B) {
+	items := make([]TestItem, 1000)
+	for i := range items {
+		items[i] = TestItem{Id: fmt.Sprintf("id%d", i), Data: "some data for the item"}
+	}
+	app := fiber.New()
+	RegisterAPI(app, Api[TestItem, TestItemDto]{
+		Path:    "bench",
+		Find:    func(key string) (TestItem, bool) { return TestItem{}, false },
+		FindAll: func() []TestItem { return items },
+		Dto:     ItemToDto,
+	})
+	for _, mime := range []string{fiber.MIMEApplicationJSON, MIMEApplicationMsgpack} {
+		b.Run(mime, func(b *testing.B) {
+			b.ReportAllocs()
+			size := 0
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest("GET", "/bench", nil)
+				req.Header.Set("Accept", mime)
+				resp, err := app.Test(req, -1)
+				if err != nil {
+					b.Fatal(err)
+				}
+				n, _ := io.Copy(io.Discard, resp.Body)
+				size = int(n)
+			}
+			b.ReportMetric(float64(size), "body-B")
+		})
+	}
+}
+
+func TestContentType(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		lenient := newTestApi(data)
+		lenient.Path = "testlenient"
+		lenient.LenientContentType = true
+		RegisterAPI(app, lenient)
+
+		send := func(method, url, mime, body string) (int, map[string]any) {
+			req := httptest.NewRequest(method, url, strings.NewReader(body))
+			if mime != "" {
+				req.Header.Set("Content-Type", mime)
+			}
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			var ret map[string]any
+			_ = json.NewDecoder(resp.Body).Decode(&ret)
+			return resp.StatusCode, ret
+		}
+
+		// 415 with the accepted types
+		for _, url := range []string{"/test", "/test/filter"} {
+			code, ret := send("POST", url, fiber.MIMETextPlain, `{"Id":"id3"}`)
+			assert.Equal(t, 415, code, url)
+			assert.Equal(t, "unsupported content type 'text/plain', expected one of application/json, application/xml, application/msgpack", ret["error"])
+		}
+		code, _ := send("PUT", "/test/id1", fiber.MIMETextPlain, `{"Id":"id1"}`)
+		assert.Equal(t, 415, code)
+		code, _ = send("PATCH", "/test/id1", fiber.MIMETextPlain, `{"Data":"patched"}`)
+		assert.Equal(t, 415, code)
+		code, ret := send("POST", "/test", "", `{"Id":"id3"}`)
+		assert.Equal(t, 415, code)
+		assert.Equal(t, "missing content type, expected one of application/json, application/xml, application/msgpack", ret["error"])
+
+		// 400 for an accepted type that doesn't parse
+		code, _ = send("POST", "/test", fiber.MIMEApplicationJSONCharsetUTF8, `{"Id":`)
+		assert.Equal(t, 400, code)
+
+		// 200 for an accepted type, with parameters
+		code, _ = send("POST", "/test", fiber.MIMEApplicationJSONCharsetUTF8, `{"Id":"id3","Data":"new"}`)
+		assert.Equal(t, 200, code)
+
+		// A missing content type is JSON when lenient
+		code, _ = send("POST", "/testlenient", "", `{"Id":"id4","Data":"new"}`)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "new", data.entries["id4"].Data)
+		code, _ = send("PATCH", "/testlenient/id4", "", `{"Data":"patched"}`)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "patched", data.entries["id4"].Data)
+		code, _ = send("POST", "/testlenient", fiber.MIMETextPlain, `{"Id":"id5"}`)
+		assert.Equal(t, 415, code)
+	})
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		limited := newTestApi(data)
+		limited.Path = "testlimited"
+		limited.MaxBodyBytes = 64
+		created := 0
+		create := limited.Create
+		limited.Create = func(dto TestItemDto) (TestItem, error) {
+			created++
+			return create(dto)
+		}
+		RegisterAPI(app, limited)
+
+		send := func(method, url, mime, body string) (int, map[string]any) {
+			req := httptest.NewRequest(method, url, strings.NewReader(body))
+			req.Header.Set("Content-Type", mime)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			var ret map[string]any
+			_ = json.NewDecoder(resp.Body).Decode(&ret)
+			return resp.StatusCode, ret
+		}
+
+		large := `{"Id":"id9","Data":"` + strings.Repeat("x", 100) + `"}`
+		code, ret := send("POST", "/testlimited", fiber.MIMEApplicationJSON, large)
+		assert.Equal(t, 413, code)
+		assert.Equal(t, "request body larger than 64 bytes", ret["error"])
+		assert.Equal(t, 0, created)
+		_, ok := data.entries["id9"]
+		assert.False(t, ok)
+
+		// Checked before the content type
+		code, _ = send("POST", "/testlimited", fiber.MIMETextPlain, large)
+		assert.Equal(t, 413, code)
+
+		code, _ = send("PUT", "/testlimited/id1", fiber.MIMEApplicationJSON, large)
+		assert.Equal(t, 413, code)
+		assert.Equal(t, "original data", data.entries["id1"].Data)
+		code, _ = send("PATCH", "/testlimited/id1", MIMEApplicationMergePatch, large)
+		assert.Equal(t, 413, code)
+		code, _ = send("POST", "/testlimited/filter", fiber.MIMEApplicationJSON, large)
+		assert.Equal(t, 413, code)
+
+		// Bodies within the limit, and other Apis, are unaffected
+		code, _ = send("POST", "/testlimited", fiber.MIMEApplicationJSON, `{"Id":"id9","Data":"small"}`)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, 1, created)
+		code, _ = send("POST", "/test", fiber.MIMEApplicationJSON, large)
+		assert.Equal(t, 200, code)
+	})
+}
+
+func TestSubscriptions(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		subs := newTestApi(data)
+		subs.Path = "testsubs"
+		subs.Subscriptions = true
+		RegisterAPI(app, subs)
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		go func() { _ = app.Listener(ln) }()
+		url := "ws://" + ln.Addr().String() + "/testsubs/ws"
+
+		// Not a websocket
+		code, _, err := util.GetJsonRequestResponse(app, "GET", "/testsubs/ws", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 426, code)
+
+		// The create event
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		assert.Nil(t, err)
+		defer conn.Close()
+		code, _, err = util.GetJsonRequestResponse(app, "POST", "/testsubs", TestItemDto{"id3", "new data"})
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var event map[string]any
+		assert.Nil(t, conn.ReadJSON(&event))
+		assert.Equal(t, "create", event["action"])
+		assert.Equal(t, map[string]any{"Id": "id3", "Data": "new data"}, event["data"])
+
+		// The delete event has the deleted item
+		code, _, err = util.GetStringRequestResponse(app, "DELETE", "/testsubs/id3", "")
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.Nil(t, conn.ReadJSON(&event))
+		assert.Equal(t, "delete", event["action"])
+		assert.Equal(t, map[string]any{"Id": "id3", "Data": "new data"}, event["data"])
+
+		// Not permitted to subscribe
+		data.permit = false
+		_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		// Without subscriptions ws is just a key
+		data.permit = true
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/test/ws", nil)
+		assert.Equal(t, 404, code)
+	})
+}
+
+func TestSubscriptionsRedact(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem), permit: true}
+		test := newTestApi(data)
+		var actions []Action
+		var mu sync.Mutex
+		app.Use(func(c *fiber.Ctx) error {
+			c.Locals("role", c.Get("X-Role"))
+			return c.Next()
+		})
+		RegisterAPI(app, Api[TestItem, TestEmployeeDto]{
+			Path:    "employeesubs",
+			Find:    test.Find,
+			FindAll: test.FindAll,
+			Create: func(dto TestEmployeeDto) (TestItem, error) {
+				return test.Create(TestItemDto{Id: dto.Id, Data: dto.Data})
+			},
+			Dto: func(item TestItem) TestEmployeeDto {
+				return TestEmployeeDto{Id: item.Id, Data: item.Data, Salary: 1000 * len(item.Data)}
+			},
+			Redact: func(c *fiber.Ctx, action Action, dto TestEmployeeDto) TestEmployeeDto {
+				mu.Lock()
+				actions = append(actions, action)
+				mu.Unlock()
+				if c.Locals("role") != "hr" {
+					dto.Salary = 0
+				}
+				return dto
+			},
+			OmitZeroFields: true,
+			Subscriptions:  true,
+		})
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		go func() { _ = app.Listener(ln) }()
+		url := "ws://" + ln.Addr().String() + "/employeesubs/ws"
+
+		// Each subscriber gets the change redacted for its own role
+		hr, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Role": {"hr"}})
+		assert.Nil(t, err)
+		defer hr.Close()
+		staff, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Role": {"staff"}})
+		assert.Nil(t, err)
+		defer staff.Close()
+		// A filter on a redacted field matches nothing
+		assert.Nil(t, staff.WriteJSON(map[string]any{"Salary": 4000}))
+		time.Sleep(50 * time.Millisecond)
+
+		code, _, err := util.GetJsonRequestResponse(app, "POST", "/employeesubs", TestEmployeeDto{Id: "id3", Data: "data"})
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		code, _, err = util.GetJsonRequestResponse(app, "POST", "/employeesubs", TestEmployeeDto{Id: "id4", Data: "text"})
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+
+		_ = hr.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var event map[string]any
+		assert.Nil(t, hr.ReadJSON(&event))
+		assert.Equal(t, map[string]any{"Id": "id3", "Data": "data", "Salary": 4000.0}, event["data"])
+		_ = staff.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		assert.NotNil(t, staff.ReadJSON(&event))
+
+		staff, _, err = websocket.DefaultDialer.Dial(url, http.Header{"X-Role": {"staff"}})
+		assert.Nil(t, err)
+		defer staff.Close()
+		time.Sleep(50 * time.Millisecond)
+		code, _, err = util.GetJsonRequestResponse(app, "POST", "/employeesubs", TestEmployeeDto{Id: "id5", Data: "more"})
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		_ = staff.SetReadDeadline(time.Now().Add(5 * time.Second))
+		assert.Nil(t, staff.ReadJSON(&event))
+		assert.Equal(t, "create", event["action"])
+		assert.Equal(t, map[string]any{"Id": "id5", "Data": "more"}, event["data"])
+		mu.Lock()
+		assert.Contains(t, actions, ActionGetAll)
+		mu.Unlock()
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		var calls []string
+		limited := newTestApi(data)
+		limited.Path = "mw"
+		validator := limited.Validator
+		limited.Validator = func(c *fiber.Ctx, action Action, item ...TestItem) bool {
+			calls = append(calls, "validator")
+			return validator(c, action, item...)
+		}
+		limited.Middleware = []fiber.Handler{
+			func(c *fiber.Ctx) error {
+				calls = append(calls, "first")
+				return c.Next()
+			},
+			func(c *fiber.Ctx) error {
+				calls = append(calls, "limit")
+				if c.Get("X-Limited") != "" {
+					return c.SendStatus(fiber.StatusTooManyRequests)
+				}
+				return c.Next()
+			},
+		}
+		RegisterAPI(app, limited)
+		other := newTestApi(data)
+		other.Path = "mwx"
+		RegisterAPI(app, other)
+
+		// Run in order before the access check
+		code, _, err := util.GetJsonRequestResponse(app, "GET", "/mw/id1", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, []string{"first", "limit", "validator"}, calls)
+
+		// Short circuit before any handler
+		calls = nil
+		req := httptest.NewRequest("DELETE", "/mw/id1", nil)
+		req.Header.Set("X-Limited", "1")
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		assert.Equal(t, 429, resp.StatusCode)
+		assert.Equal(t, []string{"first", "limit"}, calls)
+		_, ok := data.entries["id1"]
+		assert.True(t, ok)
+
+		// Not run for another api sharing the path prefix
+		calls = nil
+		req = httptest.NewRequest("GET", "/mwx/id1", nil)
+		req.Header.Set("X-Limited", "1")
+		resp, err = app.Test(req)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Empty(t, calls)
+	})
+}
+
+// recordingLogger records each message with its level
+type recordingLogger struct {
+	lock     sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) record(level, format string, args ...any) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.messages = append(l.messages, level+": "+strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (l *recordingLogger) Debugf(format string, args ...any) { l.record("debug", format, args...) }
+func (l *recordingLogger) Infof(format string, args ...any)  { l.record("info", format, args...) }
+func (l *recordingLogger) Warnf(format string, args ...any)  { l.record("warn", format, args...) }
+func (l *recordingLogger) Errorf(format string, args ...any) { l.record("error", format, args...) }
+
+func TestLogger(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		logger := &recordingLogger{}
+		logged := newTestApi(data)
+		logged.Path = "testlog"
+		logged.Logger = logger
+		RegisterAPI(app, logged)
+		assert.Equal(t, []string{"info: Registering REST api testlog"}, logger.messages)
+
+		// A bad body is a warning
+		logger.messages = nil
+		code, _, err := util.GetStringRequestResponse(app, "POST", "/testlog", "{")
+		assert.Nil(t, err)
+		assert.Equal(t, 415, code)
+		req := httptest.NewRequest("POST", "/testlog", strings.NewReader("{"))
+		req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		assert.Equal(t, 400, resp.StatusCode)
+		assert.Len(t, logger.messages, 2)
+		for _, msg := range logger.messages {
+			assert.True(t, strings.HasPrefix(msg, "warn: Error parsing body"), msg)
+		}
+
+		// A failed create is an error with the path and key
+		logger.messages = nil
+		data.fail = true
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testlog", TestItemDto{"id3", "new data"})
+		assert.Equal(t, 500, code)
+		assert.Equal(t, []string{"error: Error creating item in testlog: {id3 new data}, create error"}, logger.messages)
+
+		// The package logger is used by apis without their own
+		packageLogger := &recordingLogger{}
+		SetLogger(packageLogger)
+		defer SetLogger(nil)
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/test", TestItemDto{"id3", "new data"})
+		assert.Equal(t, 500, code)
+		assert.Equal(t, []string{"error: Error creating item in test: {id3 new data}, create error"}, packageLogger.messages)
+		assert.Len(t, logger.messages, 1)
+	})
+}
+
+func TestLogRequest(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		var records []RequestRecord
+		logged := newTestApi(data)
+		logged.Path = "testreq"
+		logged.LogRequest = func(r RequestRecord) {
+			records = append(records, r)
+		}
+		RegisterAPI(app, logged)
+
+		check := func(method, url string, body any, action Action, key string, status int) {
+			records = nil
+			code, _, _ := util.GetJsonRequestResponse(app, method, url, body)
+			assert.Equal(t, status, code, url)
+			if assert.Len(t, records, 1, url) {
+				r := records[0]
+				assert.Equal(t, "testreq", r.Path)
+				assert.Equal(t, action, r.Action, url)
+				assert.Equal(t, key, r.Key, url)
+				assert.Equal(t, status, r.Status, url)
+				assert.Greater(t, r.Latency, time.Duration(0))
+				assert.Nil(t, r.Err)
+			}
+		}
+		check("GET", "/testreq", nil, ActionGetAll, "", 200)
+		check("GET", "/testreq/id1", nil, ActionGetOne, "id1", 200)
+		check("GET", "/testreq/id1/children", nil, ActionGetOne, "id1", 200)
+		check("POST", "/testreq", TestItemDto{"id3", "new data"}, ActionCreate, "", 200)
+		check("PUT", "/testreq/id3", TestItemDto{"id3", "edited"}, ActionMutate, "id3", 200)
+		check("DELETE", "/testreq/id3", nil, ActionDelete, "id3", 200)
+		check("POST", "/testreq/filter", TestItemDto{Id: "id1"}, ActionSearch, "", 200)
+		check("GET", "/testreq/missing", nil, ActionGetOne, "missing", 404)
+
+		// Denied requests are logged with the action of the route
+		data.permit = false
+		check("DELETE", "/testreq/id1", nil, ActionDelete, "id1", 401)
+
+		// Other apis are not logged
+		records = nil
+		code, _, _ := util.GetJsonRequestResponse(app, "GET", "/test/id1", nil)
+		assert.Equal(t, 401, code)
+		assert.Empty(t, records)
+	})
+}
+
+// fakeMetrics records the labels of each observed request
+type fakeMetrics struct {
+	observed []string
+}
+
+func (m *fakeMetrics) ObserveRequest(path string, action Action, status int, dur time.Duration) {
+	m.observed = append(m.observed, fmt.Sprintf("%s %s %d", path, action, status))
+}
+
+func TestMetrics(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		metrics := &fakeMetrics{}
+		measured := newTestApi(data)
+		measured.Path = "testmetrics"
+		measured.Metrics = metrics
+		RegisterAPI(app, measured)
+
+		code, _, err := util.GetJsonRequestResponse(app, "GET", "/testmetrics/id1", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		data.fail = true
+		code, _, _ = util.GetJsonRequestResponse(app, "PUT", "/testmetrics/id1", TestItemDto{"id1", "edited"})
+		assert.Equal(t, 500, code)
+		assert.Equal(t, []string{"testmetrics getOne 200", "testmetrics mutate 500"}, metrics.observed)
+
+		// Denied requests and bodies that can't be parsed are observed
+		metrics.observed = nil
+		code, _, _ = util.GetStringRequestResponse(app, "PUT", "/testmetrics/id1", "{")
+		assert.Equal(t, 415, code)
+		data.permit = false
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testmetrics", nil)
+		assert.Equal(t, 401, code)
+		assert.Equal(t, []string{"testmetrics mutate 415", "testmetrics getAll 401"}, metrics.observed)
+	})
+}
+
+func TestPanicRecovery(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		var panics []any
+		panicky := newTestApi(data)
+		panicky.Path = "testpanic"
+		panicky.Mutate = func(item TestItem, dto TestItemDto) (TestItem, error) {
+			panic("mutate failed")
+		}
+		panicky.OnPanic = func(c *fiber.Ctx, recovered any) {
+			assert.Equal(t, "/testpanic/id1", c.Path())
+			panics = append(panics, recovered)
+		}
+		metrics := &fakeMetrics{}
+		panicky.Metrics = metrics
+		RegisterAPI(app, panicky)
+
+		code, ret, err := util.GetJsonRequestResponse(app, "PUT", "/testpanic/id1", TestItemDto{"id1", "edited"})
+		assert.Nil(t, err)
+		assert.Equal(t, 500, code)
+		assert.Equal(t, map[string]any{"error": "Internal Server Error"}, ret)
+		assert.Equal(t, []any{"mutate failed"}, panics)
+		assert.Equal(t, []string{"testpanic mutate 500"}, metrics.observed)
+
+		// The app still serves requests
+		code, _, err = util.GetJsonRequestResponse(app, "GET", "/testpanic/id1", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+	})
+}
+
+func TestRegistration(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+
+		// The handle describes the api
+		readOnly := newTestApi(data)
+		readOnly.Path = "testreg"
+		readOnly.Mutate = nil
+		readOnly.Patch = nil
+		readOnly.Delete = nil
+		readOnly.SubEntities = nil
+		reg, err := RegisterAPI(app.Group("/v1"), readOnly)
+		assert.Nil(t, err)
+		assert.Equal(t, "/v1/testreg", reg.Path)
+		assert.Equal(t, []Action{ActionGetAll, ActionGetOne, ActionCreate, ActionSearch}, reg.Actions)
+		assert.Contains(t, reg.Routes, Route{fiber.MethodGet, "/v1/testreg/"})
+		assert.Contains(t, reg.Routes, Route{fiber.MethodPost, "/v1/testreg/"})
+		assert.Contains(t, reg.Routes, Route{fiber.MethodGet, "/v1/testreg/:id"})
+		assert.Contains(t, reg.Routes, Route{fiber.MethodPut, "/v1/testreg/:id"})
+
+		// A duplicate path is an error and registers nothing
+		reg, err = RegisterAPI(app, newTestApi(data))
+		assert.Nil(t, reg)
+		assert.ErrorIs(t, err, ErrDuplicatePath)
+		assert.EqualError(t, err, "duplicate api path: /test")
+		assert.Panics(t, func() {
+			MustRegisterAPI(app, newTestApi(data))
+		})
+
+		// The same path on another router is fine
+		_, err = RegisterAPI(fiber.New(), newTestApi(data))
+		assert.Nil(t, err)
+
+		// Missing functions are an error
+		invalid := newTestApi(data)
+		invalid.Path = "testinvalid"
+		invalid.Dto = nil
+		_, err = RegisterAPI(app, invalid)
+		assert.ErrorIs(t, err, ErrInvalidApi)
+		invalid = newTestApi(data)
+		invalid.Path = "testinvalid"
+		invalid.UpsertOnPut = true
+		_, err = RegisterAPI(app, invalid)
+		assert.EqualError(t, err, "invalid api: testinvalid has UpsertOnPut without SetKey")
+		invalid = newTestApi(data)
+		invalid.Path = "testinvalid"
+		invalid.SearchableFields = []string{"Nope"}
+		_, err = RegisterAPI(app, invalid)
+		assert.EqualError(t, err, "invalid api: testinvalid has searchable field Nope that is not on the Jdo")
+		invalid = newTestApi(data)
+		invalid.Path = "testinvalid"
+		invalid.SortableFields = []string{"Children"}
+		_, err = RegisterAPI(app, invalid)
+		assert.EqualError(t, err, "invalid api: testinvalid has sortable field Children that is not a sortable field of the Jdo")
+	})
+}
+
+// updateGolden rewrites the golden files in testdata with the current output, go test -run TestIndex -update
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestIndex(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		RegisterIndex(app, "/_index")
+		v1 := app.Group("/v1")
+		readOnly := newTestApi(data)
+		readOnly.Path = "readonly"
+		readOnly.Create = nil
+		readOnly.Mutate = nil
+		readOnly.Patch = nil
+		readOnly.Delete = nil
+		RegisterAPI(v1, readOnly)
+
+		// Apis on other apps are not listed
+		other, otherData := setup()
+		defer cleanup(other)
+		otherApi := newTestApi(otherData)
+		otherApi.Path = "other"
+		RegisterAPI(other, otherApi)
+
+		code, body, err := util.GetStringRequestResponse(app, "GET", "/_index", "")
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		var out bytes.Buffer
+		assert.Nil(t, json.Indent(&out, []byte(body), "", "  "))
+		out.WriteString("\n")
+
+		golden := "testdata/index.golden.json"
+		if *updateGolden {
+			assert.Nil(t, os.WriteFile(golden, out.Bytes(), 0o644))
+		}
+		want, err := os.ReadFile(golden)
+		assert.Nil(t, err)
+		assert.Equal(t, string(want), out.String())
+	})
+}
+
+type intKeyed struct {
+	ID   int
+	Name string
+}
+
+func TestHAL(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		hal := newTestApi(data)
+		hal.Path = "testhal"
+		hal.Key = func(item TestItem) string { return item.Id }
+		RegisterAPI(app.Group("/v1"), hal)
+		ints := map[int]intKeyed{7: {7, "seven"}}
+		RegisterAPI(app, Api[intKeyed, intKeyed]{
+			Path: "testints",
+			Find: func(key string) (intKeyed, bool) {
+				id, _ := strconv.Atoi(key)
+				item, ok := ints[id]
+				return item, ok
+			},
+			FindAll: func() []intKeyed { return []intKeyed{ints[7]} },
+			Dto:     func(item intKeyed) intKeyed { return item },
+			Key:     func(item intKeyed) string { return strconv.Itoa(item.ID) },
+		})
+
+		get := func(url string) (string, map[string]any) {
+			req := httptest.NewRequest("GET", url, nil)
+			req.Header.Set(fiber.HeaderAccept, MIMEApplicationHAL)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			assert.Equal(t, 200, resp.StatusCode, url)
+			var ret map[string]any
+			assert.Nil(t, json.NewDecoder(resp.Body).Decode(&ret))
+			return resp.Header.Get(fiber.HeaderContentType), ret
+		}
+		link := func(href string) map[string]any {
+			return map[string]any{"href": href}
+		}
+
+		// An item with string keys, links and embedded children
+		mime, ret := get("/v1/testhal/id1")
+		assert.Equal(t, MIMEApplicationHAL, mime)
+		assert.Equal(t, "original data", ret["Data"])
+		assert.Equal(t, map[string]any{
+			"self":       link("/v1/testhal/id1"),
+			"collection": link("/v1/testhal"),
+			"children":   link("/v1/testhal/id1/children"),
+		}, ret["_links"])
+		assert.Equal(t, map[string]any{"children": []any{
+			map[string]any{"Name": "a"},
+			map[string]any{"Name": "b"},
+		}}, ret["_embedded"])
+
+		// The collection embeds the items under the api path
+		mime, ret = get("/v1/testhal?sort=Id")
+		assert.Equal(t, MIMEApplicationHAL, mime)
+		assert.Equal(t, map[string]any{"self": link("/v1/testhal?sort=Id")}, ret["_links"])
+		assert.Equal(t, float64(2), ret["count"])
+		items := ret["_embedded"].(map[string]any)["testhal"].([]any)
+		assert.Len(t, items, 2)
+		assert.Equal(t, link("/v1/testhal/id2"), items[1].(map[string]any)["_links"].(map[string]any)["self"])
+
+		// Integer keys
+		_, ret = get("/testints/7")
+		assert.Equal(t, float64(7), ret["ID"])
+		assert.Equal(t, map[string]any{"self": link("/testints/7"), "collection": link("/testints")}, ret["_links"])
+		assert.NotContains(t, ret, "_embedded")
+		_, ret = get("/testints")
+		items = ret["_embedded"].(map[string]any)["testints"].([]any)
+		assert.Equal(t, link("/testints/7"), items[0].(map[string]any)["_links"].(map[string]any)["self"])
+
+		// Plain JSON is unchanged
+		code, plain, err := util.GetJsonRequestResponse(app, "GET", "/v1/testhal/id1", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, map[string]any{"Id": "id1", "Data": "original data"}, plain)
+
+		// HAL isn't accepted for bodies
+		req := httptest.NewRequest("POST", "/v1/testhal", strings.NewReader(`{"Id":"id3"}`))
+		req.Header.Set(fiber.HeaderContentType, MIMEApplicationHAL)
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		assert.Equal(t, 415, resp.StatusCode)
+	})
+}
+
+func TestDeleteWhere(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem)}
+		bulkApi := newTestApi(data)
+		bulkApi.Path = "testbd"
+		bulkApi.AllowBulkDelete = true
+		var gotActions []Action
+		var gotItems int
+		bulkApi.Validator = func(ctx *fiber.Ctx, action Action, item ...TestItem) bool {
+			gotActions = append(gotActions, action)
+			gotItems = len(item)
+			return data.permit
+		}
+		RegisterAPI(app, bulkApi)
+		// Not registered without AllowBulkDelete
+		RegisterAPI(app, newTestApi(data))
+
+		_, _ = bulkApi.Create(TestItemDto{"id1", "keep"})
+		_, _ = bulkApi.Create(TestItemDto{"id2", "old data"})
+		_, _ = bulkApi.Create(TestItemDto{"id3", "old data3"})
+
+		code, _, _ := util.GetJsonRequestResponse(app, "POST", "/test/deleteWhere", TestItemDto{Data: "old"})
+		assert.NotEqual(t, 200, code)
+
+		// An empty filter would delete everything
+		data.permit = true
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testbd/deleteWhere", TestItemDto{})
+		assert.Equal(t, 400, code)
+
+		data.permit = false
+		gotActions = nil
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testbd/deleteWhere", TestItemDto{Data: "old"})
+		assert.Equal(t, 401, code)
+		assert.Len(t, data.entries, 3)
+
+		// A filter matching more than MaxResults is refused
+		data.permit = true
+		capped := newTestApi(data)
+		capped.Path = "testbdcap"
+		capped.AllowBulkDelete = true
+		capped.MaxResults = 1
+		RegisterAPI(app, capped)
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testbdcap/deleteWhere", TestItemDto{Data: "old"})
+		assert.Equal(t, 400, code)
+		assert.Len(t, data.entries, 3)
+
+		gotActions = nil
+		code, resp, err := util.GetJsonRequestResponse(app, "POST", "/testbd/deleteWhere", TestItemDto{Data: "old"})
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.EqualValues(t, 2, resp["deleted"])
+		assert.Equal(t, []Action{ActionDelete}, gotActions)
+		assert.Equal(t, 2, gotItems)
+		assert.Len(t, data.entries, 1)
+		assert.Contains(t, data.entries, "id1")
+
+		code, resp, _ = util.GetJsonRequestResponse(app, "POST", "/testbd/deleteWhere", TestItemDto{Data: "old"})
+		assert.Equal(t, 200, code)
+		assert.EqualValues(t, 0, resp["deleted"])
+
+		data.fail = true
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testbd/deleteWhere", TestItemDto{Id: "id1"})
+		assert.Equal(t, 500, code)
+	})
+}
+
+func TestUpdateWhere(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem)}
+		bulkApi := newTestApi(data)
+		bulkApi.Path = "testbu"
+		bulkApi.AllowBulkUpdate = true
+		var gotActions []Action
+		var gotItems int
+		bulkApi.Validator = func(ctx *fiber.Ctx, action Action, item ...TestItem) bool {
+			gotActions = append(gotActions, action)
+			gotItems = len(item)
+			return data.permit
+		}
+		RegisterAPI(app, bulkApi)
+		// Without Patch the set fields are applied to the Jdo for Mutate
+		mutateApi := bulkApi
+		mutateApi.Path = "testbm"
+		mutateApi.Patch = nil
+		RegisterAPI(app, mutateApi)
+		// Not registered without AllowBulkUpdate
+		RegisterAPI(app, newTestApi(data))
+
+		_, _ = bulkApi.Create(TestItemDto{"id1", "keep"})
+		_, _ = bulkApi.Create(TestItemDto{"id2", "old data"})
+		_, _ = bulkApi.Create(TestItemDto{"id3", "old data3"})
+
+		body := map[string]any{"filter": TestItemDto{Data: "old"}, "set": map[string]any{"Data": "new"}}
+		code, _, _ := util.GetJsonRequestResponse(app, "POST", "/test/updateWhere", body)
+		assert.NotEqual(t, 200, code)
+
+		data.permit = true
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testbu/updateWhere", map[string]any{"set": map[string]any{"Data": "new"}})
+		assert.Equal(t, 400, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testbu/updateWhere", map[string]any{"filter": TestItemDto{Data: "old"}})
+		assert.Equal(t, 400, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testbu/updateWhere", map[string]any{"filter": TestItemDto{Data: "old"}, "set": map[string]any{"Nope": 1}})
+		assert.Equal(t, 400, code)
+
+		data.permit = false
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testbu/updateWhere", body)
+		assert.Equal(t, 401, code)
+		assert.Equal(t, "old data", data.entries["id2"].Data)
+
+		data.permit = true
+		gotActions = nil
+		code, resp, err := util.GetJsonRequestResponse(app, "POST", "/testbu/updateWhere", body)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.EqualValues(t, 2, resp["matched"])
+		assert.EqualValues(t, 2, resp["updated"])
+		assert.Equal(t, []Action{ActionMutate}, gotActions)
+		assert.Equal(t, 2, gotItems)
+		for _, id := range []string{"id2", "id3"} {
+			assert.Equal(t, "new", data.entries[id].Data)
+			assert.Equal(t, id, data.entries[id].Id)
+			assert.Len(t, data.entries[id].Children, 2)
+		}
+		assert.Equal(t, "keep", data.entries["id1"].Data)
+
+		body = map[string]any{"filter": TestItemDto{Id: "id1"}, "set": map[string]any{"Data": "kept"}}
+		code, resp, _ = util.GetJsonRequestResponse(app, "POST", "/testbm/updateWhere", body)
+		assert.Equal(t, 200, code)
+		assert.EqualValues(t, 1, resp["updated"])
+		assert.Equal(t, TestItem{Id: "id1", Data: "kept", Children: []ChildItem{{"a"}, {"b"}}}, data.entries["id1"])
+
+		data.fail = true
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testbu/updateWhere", body)
+		assert.Equal(t, 500, code)
+	})
+}
+
+func TestValidateRoutes(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		writes := 0
+		var gotActions []Action
+		validated := newTestApi(data)
+		validated.Path = "testvr"
+		validated.ValidateRoutes = true
+		validated.ValidateDto = func(dto TestItemDto) error {
+			if dto.Data == "" {
+				return FieldErrors{{Field: "Data", Rule: "required", Message: "Data is required"}}
+			}
+			return nil
+		}
+		validated.SetKey = func(dto *TestItemDto, key string) error {
+			dto.Id = key
+			return nil
+		}
+		create, mutate := validated.Create, validated.Mutate
+		validated.Create = func(dto TestItemDto) (TestItem, error) {
+			writes++
+			return create(dto)
+		}
+		validated.Mutate = func(item TestItem, dto TestItemDto) (TestItem, error) {
+			writes++
+			return mutate(item, dto)
+		}
+		// Validating is allowed without write access
+		validated.Validator = func(ctx *fiber.Ctx, action Action, item ...TestItem) bool {
+			gotActions = append(gotActions, action)
+			return action == ActionValidate || data.permit
+		}
+		reg, err := RegisterAPI(app, validated)
+		assert.Nil(t, err)
+		assert.Contains(t, reg.Actions, ActionValidate)
+		assert.Equal(t, "validate", ActionValidate.String())
+
+		code, _, _ := util.GetJsonRequestResponse(app, "POST", "/testvr/", TestItemDto{Id: "id9", Data: "new"})
+		assert.Equal(t, 401, code)
+
+		gotActions = nil
+		code, resp, err := util.GetJsonRequestResponse(app, "POST", "/testvr/validate", TestItemDto{Id: "id9", Data: "new"})
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "id9", resp["Id"])
+		assert.Equal(t, []Action{ActionValidate}, gotActions)
+
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testvr/validate", TestItemDto{Id: "id9"})
+		assert.Equal(t, 422, code)
+
+		// The key in the path replaces the one in the body
+		code, resp, _ = util.GetJsonRequestResponse(app, "POST", "/testvr/id1/validate", TestItemDto{Id: "other", Data: "changed"})
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "id1", resp["Id"])
+		assert.Equal(t, "changed", resp["Data"])
+
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testvr/id1/validate", TestItemDto{})
+		assert.Equal(t, 422, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testvr/nope/validate", TestItemDto{Data: "x"})
+		assert.Equal(t, 404, code)
+
+		assert.Equal(t, 0, writes)
+		assert.Equal(t, "original data", data.entries["id1"].Data)
+		_, ok := data.entries["id9"]
+		assert.False(t, ok)
+
+		// Not registered unless enabled
+		data.permit = true
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/test/id1/validate", TestItemDto{Data: "x"})
+		assert.NotEqual(t, 200, code)
+	})
+}
+
+func TestClone(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		cloned := newTestApi(data)
+		cloned.Path = "testclone"
+		cloned.Clone = true
+		cloned.CreatedStatus = true
+		cloned.Key = func(item TestItem) string { return item.Id }
+		create := cloned.Create
+		cloned.Create = func(dto TestItemDto) (TestItem, error) {
+			if _, ok := data.entries[dto.Id]; ok {
+				return TestItem{}, fmt.Errorf("%w: %s exists", ErrConflict, dto.Id)
+			}
+			return create(dto)
+		}
+		var gotIncoming *TestItemDto
+		var gotItems []TestItem
+		cloned.ValidatorD = func(c *fiber.Ctx, action Action, existing *TestItem, incoming *TestItemDto) bool {
+			if action == ActionCreate {
+				gotIncoming = incoming
+				gotItems = nil
+				if existing != nil {
+					gotItems = append(gotItems, *existing)
+				}
+			}
+			return data.permit
+		}
+		RegisterAPI(app, cloned)
+
+		code, _, _ := util.GetJsonRequestResponse(app, "POST", "/testclone/id1/clone", map[string]any{"Id": "id9"})
+		assert.Equal(t, 401, code)
+
+		data.permit = true
+		req := httptest.NewRequest("POST", "/testclone/id1/clone", strings.NewReader(`{"Id":"id9"}`))
+		req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		assert.Equal(t, 201, resp.StatusCode)
+		assert.Equal(t, "/testclone/id9", resp.Header.Get("Location"))
+		assert.Equal(t, "original data", data.entries["id9"].Data)
+		assert.Equal(t, TestItemDto{Id: "id9", Data: "original data"}, *gotIncoming)
+		assert.Equal(t, []TestItem{data.entries["id1"]}, gotItems)
+
+		// With the fields overridden
+		code, ret, _ := util.GetJsonRequestResponse(app, "POST", "/testclone/id1/clone", map[string]any{"Id": "id10", "Data": "copy"})
+		assert.Equal(t, 201, code)
+		assert.Equal(t, "copy", ret["Data"])
+		assert.Equal(t, "copy", data.entries["id10"].Data)
+		assert.Equal(t, "original data", data.entries["id1"].Data)
+
+		// The key is taken
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testclone/id1/clone", map[string]any{"Id": "id2"})
+		assert.Equal(t, 409, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testclone/id1/clone", nil)
+		assert.Equal(t, 409, code)
+		assert.Equal(t, "original data2", data.entries["id2"].Data)
+
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testclone/id1/clone", map[string]any{"Nope": 1})
+		assert.Equal(t, 400, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testclone/nope/clone", map[string]any{"Id": "id11"})
+		assert.Equal(t, 404, code)
+
+		// Not registered unless enabled
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/test/id1/clone", map[string]any{"Id": "id11"})
+		assert.NotEqual(t, 200, code)
+		_, ok := data.entries["id11"]
+		assert.False(t, ok)
+	})
+}
+
+func TestExpand(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		expanded := newTestApi(data)
+		expanded.Path = "testexpand"
+		expanded.SubEntities[0].Dto = func(child any) any {
+			return map[string]string{"label": strings.ToUpper(child.(ChildItem).Name)}
+		}
+		expanded.SubEntities = append(expanded.SubEntities, SubEntity[TestItem, TestItemDto]{SubPath: "names", Get: func(item TestItem) []any {
+			return []any{item.Id}
+		}})
+		RegisterAPI(app, expanded)
+
+		code, body := getBody(t, app, "/testexpand/id1?expand=children")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"id1","Data":"original data","children":[{"label":"A"},{"label":"B"}]}`, body)
+
+		code, body = getBody(t, app, "/testexpand/id1?expand=children,names&fields=Id")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"id1","children":[{"label":"A"},{"label":"B"}],"names":["id1"]}`, body)
+
+		code, body = getBody(t, app, "/testexpand/id1?expand=*")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"id1","Data":"original data","children":[{"label":"A"},{"label":"B"}],"names":["id1"]}`, body)
+
+		code, _ = getBody(t, app, "/testexpand/id1?expand=nope")
+		assert.Equal(t, 400, code)
+		code, _ = getBody(t, app, "/testexpand?expand=nope")
+		assert.Equal(t, 400, code)
+
+		// Lists and searches
+		code, body = getBody(t, app, "/testexpand?expand=names&sort=Id")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `[{"Id":"id1","Data":"original data","names":["id1"]},{"Id":"id2","Data":"original data2","names":["id2"]}]`, body)
+
+		code, list, _ := util.GetJsonSliceRequestResponse(app, "POST", "/testexpand/filter?expand=names", TestItemDto{Id: "id2"})
+		assert.Equal(t, 200, code)
+		assert.Equal(t, []map[string]any{{"Id": "id2", "Data": "original data2", "names": []any{"id2"}}}, list)
+	})
+}
+
+// getBody sends a GET for url returning the status and body
+func getBody(t *testing.T, app *fiber.App, url string) (int, string) {
+	resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+	assert.Nil(t, err)
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func TestSearchableFields(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		searched := 0
+		restricted := newTestApi(data)
+		restricted.Path = "testsearchable"
+		restricted.SearchableFields = []string{"Id"}
+		search := restricted.Search
+		restricted.Search = func(filter TestItemDto) []TestItem {
+			searched++
+			return search(filter)
+		}
+		RegisterAPI(app, restricted)
+
+		code, ret, _ := util.GetJsonRequestResponse(app, "POST", "/testsearchable/filter", TestItemDto{Data: "data2"})
+		assert.Equal(t, 400, code)
+		assert.Equal(t, "field 'Data' is not searchable", ret["error"])
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testsearchable?Data=data2", nil)
+		assert.Equal(t, 400, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testsearchable/count?Data=data2", nil)
+		assert.Equal(t, 400, code)
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testsearchable/filter", TestItemDto{Id: "id2", Data: "data2"})
+		assert.Equal(t, 400, code)
+		assert.Equal(t, 0, searched)
+
+		// Allowed fields still filter
+		code, list, _ := util.GetJsonSliceRequestResponse(app, "POST", "/testsearchable/filter", TestItemDto{Id: "id2"})
+		assert.Equal(t, 200, code)
+		assert.Equal(t, []map[string]any{{"Id": "id2", "Data": "original data2"}}, list)
+		code, list, _ = util.GetJsonSliceRequestResponse(app, "GET", "/testsearchable?Id=id1", nil)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, []map[string]any{{"Id": "id1", "Data": "original data"}}, list)
+		code, list, _ = util.GetJsonSliceRequestResponse(app, "GET", "/testsearchable", nil)
+		assert.Equal(t, 200, code)
+		assert.Len(t, list, 2)
+	})
+}
+
+func TestBodyErrorDetail(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem), permit: true}
+		RegisterAPI(app, newTestApi(data))
+		_, _ = newTestApi(data).Create(TestItemDto{"id1", "original data"})
+
+		send := func(method string, url string, body string) (int, string) {
+			req := httptest.NewRequest(method, url, strings.NewReader(body))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, string(b)
+		}
+
+		// A value of the wrong type names the field, without echoing the value
+		for _, r := range [][2]string{{"POST", "/test/"}, {"PUT", "/test/id1"}, {"POST", "/test/filter"}} {
+			code, body := send(r[0], r[1], `{"Id":"id1","Data":12345}`)
+			assert.Equal(t, 400, code, r[1])
+			assert.JSONEq(t, `{"error":"invalid value for field 'Data', expected string not number"}`, body, r[1])
+		}
+
+		code, body := send("POST", "/test/", `{"Id":"id9",,}`)
+		assert.Equal(t, 400, code)
+		assert.JSONEq(t, `{"error":"invalid JSON syntax at offset 13"}`, body)
+		code, body = send("POST", "/test/", `["id9"]`)
+		assert.Equal(t, 400, code)
+		assert.JSONEq(t, `{"error":"invalid value, expected easyrest.TestItemDto not array"}`, body)
+		assert.Equal(t, "original data", data.entries["id1"].Data)
+	})
+}
+
+func TestJSONCodec(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem), permit: true}
+		var encoded, decoded int
+		api := newTestApi(data)
+		api.JSONEncoder = func(v any) ([]byte, error) {
+			encoded++
+			return json.Marshal(v)
+		}
+		api.JSONDecoder = func(b []byte, v any) error {
+			decoded++
+			return json.Unmarshal(b, v)
+		}
+		RegisterAPI(app, api)
+		plain := newTestApi(data)
+		plain.Path = "plain"
+		RegisterAPI(app, plain)
+
+		send := func(method string, url string, mime string, body string) (int, string) {
+			req := httptest.NewRequest(method, url, strings.NewReader(body))
+			req.Header.Set("Content-Type", mime)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, string(b)
+		}
+
+		code, body := send("POST", "/test/", fiber.MIMEApplicationJSON, `{"Id":"id1","Data":"some data"}`)
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"id1","Data":"some data"}`, body)
+		assert.Equal(t, 1, decoded)
+		assert.Equal(t, 1, encoded)
+
+		code, body = send("PATCH", "/test/id1", MIMEApplicationMergePatch, `{"Data":"patched"}`)
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"id1","Data":"patched"}`, body)
+		assert.Equal(t, 2, decoded)
+
+		code, _ = send("GET", "/test/", "", "")
+		assert.Equal(t, 200, code)
+		assert.Equal(t, 3, encoded)
+
+		// Other apis keep the app's encoder
+		code, body = send("GET", "/plain/", "", "")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `[{"Id":"id1","Data":"patched"}]`, body)
+		assert.Equal(t, 3, encoded)
+		assert.Equal(t, 2, decoded)
+	})
+}
+
+// BenchmarkGetAllJSONEncoder compares the app's default encoding/json encoder with jsoniter as an api JSONEncoder
+func BenchmarkGetAllJSONEncoder(b *testing.B) {
+	items := make([]TestItem, 1000)
+	for i := range items {
+		items[i] = TestItem{Id: fmt.Sprintf("id%d", i), Data: "some data for the item"}
+	}
+	encoders := map[string]utils.JSONMarshal{
+		"default":  nil,
+		"jsoniter": jsoniter.ConfigFastest.Marshal,
+	}
+	for name, encoder := range encoders {
+		app := fiber.New()
+		RegisterAPI(app, Api[TestItem, TestItemDto]{
+			Path:        "bench",
+			Find:        func(key string) (TestItem, bool) { return TestItem{}, false },
+			FindAll:     func() []TestItem { return items },
+			Dto:         ItemToDto,
+			JSONEncoder: encoder,
+		})
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				resp, err := app.Test(httptest.NewRequest("GET", "/bench", nil), -1)
+				if err != nil {
+					b.Fatal(err)
+				}
+				_, _ = io.Copy(io.Discard, resp.Body)
+			}
+		})
+	}
+}
+
+// TestNullableDto has a Note that is null when the item has no Data
+type TestNullableDto struct {
+	Id   string
+	Note *string
+}
+
+// dropNulls removes the null valued keys from the objects in v
+func dropNulls(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if e == nil {
+				delete(v, k)
+			} else {
+				v[k] = dropNulls(e)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = dropNulls(e)
+		}
+	}
+	return v
+}
+
+func TestSerialize(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem), permit: true}
+		data.entries["id1"] = TestItem{Id: "id1", Data: "some data"}
+		data.entries["id2"] = TestItem{Id: "id2"}
+		test := newTestApi(data)
+		var got []any
+		RegisterAPI(app, Api[TestItem, TestNullableDto]{
+			Path:    "nulls",
+			Find:    test.Find,
+			FindAll: test.FindAll,
+			Dto: func(item TestItem) TestNullableDto {
+				dto := TestNullableDto{Id: item.Id}
+				if item.Data != "" {
+					dto.Note = &item.Data
+				}
+				return dto
+			},
+			Serialize: func(c *fiber.Ctx, v any) ([]byte, string, error) {
+				got = append(got, v)
+				b, err := json.Marshal(v)
+				if err != nil {
+					return nil, "", err
+				}
+				var out any
+				if err = json.Unmarshal(b, &out); err != nil {
+					return nil, "", err
+				}
+				b, err = json.Marshal(dropNulls(out))
+				return b, fiber.MIMEApplicationJSONCharsetUTF8, err
+			},
+		})
+
+		get := func(url string) (int, string, string) {
+			req := httptest.NewRequest("GET", url, nil)
+			req.Header.Set("Accept", fiber.MIMEApplicationXML)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, resp.Header.Get("Content-Type"), string(b)
+		}
+
+		code, mime, body := get("/nulls/id2")
+		assert.Equal(t, 200, code)
+		assert.Equal(t, fiber.MIMEApplicationJSONCharsetUTF8, mime)
+		assert.JSONEq(t, `{"Id":"id2"}`, body)
+		code, _, body = get("/nulls/id1")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"id1","Note":"some data"}`, body)
+
+		code, _, body = get("/nulls/?sort=Id")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `[{"Id":"id1","Note":"some data"},{"Id":"id2"}]`, body)
+
+		assert.Len(t, got, 3)
+		assert.IsType(t, TestNullableDto{}, got[0])
+		assert.IsType(t, []TestNullableDto{}, got[2])
+
+		// Errors are not serialised
+		code, _, _ = get("/nulls/id9")
+		assert.Equal(t, 404, code)
+		assert.Len(t, got, 3)
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem), permit: true}
+		api := newTestApi(data)
+		var validated, limited []Action
+		validator := api.Validator
+		api.Validator = func(c *fiber.Ctx, action Action, item ...TestItem) bool {
+			validated = append(validated, action)
+			return validator(c, action, item...)
+		}
+		api.RateLimiter = func(c *fiber.Ctx, action Action) (bool, time.Duration) {
+			limited = append(limited, action)
+			return action != ActionCreate, 1500 * time.Millisecond
+		}
+		RegisterAPI(app, api)
+
+		req := httptest.NewRequest("POST", "/test/", strings.NewReader(`{"Id":"id1","Data":"some data"}`))
+		req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		assert.Equal(t, 429, resp.StatusCode)
+		assert.Equal(t, "2", resp.Header.Get(fiber.HeaderRetryAfter))
+		body, _ := io.ReadAll(resp.Body)
+		assert.JSONEq(t, `{"error":"rate limit exceeded"}`, string(body))
+		assert.Equal(t, []Action{ActionCreate}, limited)
+		assert.Empty(t, validated)
+		assert.Empty(t, data.entries)
+
+		resp, err = app.Test(httptest.NewRequest("GET", "/test/", nil))
+		assert.Nil(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, []Action{ActionCreate, ActionGetAll}, limited)
+		assert.Equal(t, []Action{ActionGetAll}, validated)
+	})
+}
+
+// TestEmployeeDto has a Salary only HR may see
+type TestEmployeeDto struct {
+	Id     string
+	Data   string
+	Salary int
+}
+
+func TestRedact(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem), permit: true}
+		data.entries["id1"] = TestItem{Id: "id1", Data: "some data"}
+		data.entries["id2"] = TestItem{Id: "id2", Data: "more data"}
+		test := newTestApi(data)
+		var actions []Action
+		redact := func(c *fiber.Ctx, action Action, dto TestEmployeeDto) TestEmployeeDto {
+			actions = append(actions, action)
+			if c.Get("X-Role") != "hr" {
+				dto.Salary = 0
+			}
+			return dto
+		}
+		api := Api[TestItem, TestEmployeeDto]{
+			Path:    "employees",
+			Find:    test.Find,
+			FindAll: test.FindAll,
+			Search: func(filter TestEmployeeDto) []TestItem {
+				return test.Search(TestItemDto{Id: filter.Id, Data: filter.Data})
+			},
+			Delete:         test.Delete,
+			DeleteResponse: DeleteResponseDto,
+			Dto: func(item TestItem) TestEmployeeDto {
+				return TestEmployeeDto{Id: item.Id, Data: item.Data, Salary: 1000 * len(item.Data)}
+			},
+			Key:            func(item TestItem) string { return item.Id },
+			Redact:         redact,
+			OmitZeroFields: true,
+		}
+		RegisterAPI(app, api)
+		zeros := api
+		zeros.Path = "zeros"
+		zeros.OmitZeroFields = false
+		RegisterAPI(app, zeros)
+
+		send := func(method string, url string, role string, body string) (int, string) {
+			req := httptest.NewRequest(method, url, strings.NewReader(body))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			req.Header.Set("X-Role", role)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, string(b)
+		}
+
+		code, body := send("GET", "/employees/id1", "hr", "")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"id1","Data":"some data","Salary":9000}`, body)
+		code, body = send("GET", "/employees/id1", "sales", "")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"id1","Data":"some data"}`, body)
+
+		code, body = send("GET", "/employees/?sort=Id", "hr", "")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `[{"Id":"id1","Data":"some data","Salary":9000},{"Id":"id2","Data":"more data","Salary":9000}]`, body)
+		code, body = send("GET", "/employees/?sort=Id", "sales", "")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `[{"Id":"id1","Data":"some data"},{"Id":"id2","Data":"more data"}]`, body)
+
+		code, body = send("POST", "/employees/filter", "sales", `{"Id":"id2"}`)
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `[{"Id":"id2","Data":"more data"}]`, body)
+
+		// Selecting fields doesn't undo the redaction, of the list or an item
+		code, body = send("GET", "/zeros/?sort=Id&fields=Id,Salary", "sales", "")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `[{"Id":"id1","Salary":0},{"Id":"id2","Salary":0}]`, body)
+		code, body = send("GET", "/zeros/id1?fields=Salary", "sales", "")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Salary":0}`, body)
+		code, body = send("GET", "/zeros/?sort=Id&fields=Salary", "hr", "")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `[{"Salary":9000},{"Salary":9000}]`, body)
+
+		// Without OmitZeroFields the redacted field is sent empty
+		code, body = send("GET", "/zeros/id1", "sales", "")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"id1","Data":"some data","Salary":0}`, body)
+
+		code, body = send("DELETE", "/employees/id2", "sales", "")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"id2","Data":"more data"}`, body)
+		assert.Equal(t, []Action{ActionGetOne, ActionGetOne, ActionGetAll, ActionGetAll, ActionGetAll, ActionGetAll,
+			ActionSearch, ActionGetAll, ActionGetAll, ActionGetOne, ActionGetAll, ActionGetAll, ActionGetOne, ActionDelete}, actions)
+	})
+}
+
+func TestTransform(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem), permit: true}
+		api := newTestApi(data)
+		var validated []string
+		api.TransformIn = func(c *fiber.Ctx, dto TestItemDto) (TestItemDto, error) {
+			dto.Data = strings.Join(strings.Fields(dto.Data), " ")
+			if dto.Data == "bad" {
+				return dto, FieldErrors{{Field: "Data", Rule: "normal", Message: "Data cannot be normalised"}}
+			}
+			return dto, nil
+		}
+		api.ValidateDto = func(dto TestItemDto) error {
+			validated = append(validated, dto.Data)
+			return nil
+		}
+		api.TransformOut = func(c *fiber.Ctx, dto TestItemDto) TestItemDto {
+			dto.Data = fmt.Sprintf("%s (%d)", dto.Data, len(dto.Data))
+			return dto
+		}
+		RegisterAPI(app, api)
+
+		send := func(method string, url string, body string) (int, string) {
+			req := httptest.NewRequest(method, url, strings.NewReader(body))
+			req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, string(b)
+		}
+
+		// Normalised before validation and saving
+		code, body := send("POST", "/test/", `{"Id":"id1","Data":"  some   data "}`)
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"id1","Data":"some data (9)"}`, body)
+		assert.Equal(t, "some data", data.entries["id1"].Data)
+		assert.Equal(t, []string{"some data"}, validated)
+
+		code, body = send("PUT", "/test/id1", `{"Id":"id1","Data":" bad "}`)
+		assert.Equal(t, 422, code)
+		assert.JSONEq(t, `[{"field":"Data","rule":"normal","message":"Data cannot be normalised"}]`, body)
+		assert.Equal(t, "some data", data.entries["id1"].Data)
+		assert.Equal(t, []string{"some data"}, validated)
+
+		// Enriched on every read
+		code, body = send("GET", "/test/id1", "")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `{"Id":"id1","Data":"some data (9)"}`, body)
+		code, body = send("GET", "/test/", "")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `[{"Id":"id1","Data":"some data (9)"}]`, body)
+
+		// Filters are normalised too
+		code, body = send("POST", "/test/filter", `{"Data":"  some  "}`)
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `[{"Id":"id1","Data":"some data (9)"}]`, body)
+		code, body = send("GET", "/test/?Data=%20some%20%20data", "")
+		assert.Equal(t, 200, code)
+		assert.JSONEq(t, `[{"Id":"id1","Data":"some data (9)"}]`, body)
+		code, _ = send("POST", "/test/filter", `{"Data":"bad"}`)
+		assert.Equal(t, 422, code)
+	})
+}
+
+func TestSearchAdvanced(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem), permit: true}
+		for _, id := range []string{"a", "b", "c", "d"} {
+			data.entries[id] = TestItem{Id: id, Data: "data " + id}
+		}
+		api := newTestApi(data)
+		var got [][]Condition
+		api.SearchAdvanced = func(filter TestItemDto, conditions []Condition) ([]TestItem, error) {
+			got = append(got, conditions)
+			var all []TestItem
+			for _, item := range api.FindAll() {
+				if !filter.Match(item) {
+					continue
+				}
+				match := true
+				for _, cond := range conditions {
+					switch cond.Op {
+					case OpGt:
+						match = match && item.Id > cond.Values[0].(string)
+					case OpLte:
+						match = match && item.Id <= cond.Values[0].(string)
+					}
+				}
+				if match {
+					all = append(all, item)
+				}
+			}
+			return all, nil
+		}
+		RegisterAPI(app, api)
+		plain := newTestApi(data)
+		plain.Path = "plain"
+		RegisterAPI(app, plain)
+
+		code, list, err := util.GetJsonSliceRequestResponse(app, "GET", "/test/?Id.gt=a&Id.lte=c&sort=-Id", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		if assert.Len(t, list, 2) {
+			assert.Equal(t, "c", list[0]["Id"])
+			assert.Equal(t, "b", list[1]["Id"])
+		}
+		assert.Equal(t, []Condition{{Field: "Id", Op: OpGt, Values: []any{"a"}}, {Field: "Id", Op: OpLte, Values: []any{"c"}}}, got[0])
+
+		// With a plain filter field
+		code, list, _ = util.GetJsonSliceRequestResponse(app, "GET", "/test/?Data=data%20d&Id.gt=a", nil)
+		assert.Equal(t, 200, code)
+		assert.Len(t, list, 1)
+		code, ret, _ := util.GetJsonRequestResponse(app, "GET", "/test/count?Id.gt=b", nil)
+		assert.Equal(t, 200, code)
+		assert.EqualValues(t, 2, ret["count"])
+
+		got = nil
+		_, _, _ = util.GetJsonSliceRequestResponse(app, "GET", "/test/?Id.in=a,c&Id.between=a,b", nil)
+		assert.Equal(t, [][]Condition{{{Field: "Id", Op: OpIn, Values: []any{"a", "c"}}, {Field: "Id", Op: OpBetween, Values: []any{"a", "b"}}}}, got)
+
+		for url, msg := range map[string]string{
+			"/test/?Id.like=a":        "unknown operator 'like' for filter field 'Id'",
+			"/test/?Name.gt=a":        "unknown filter field 'Name'",
+			"/test/?Id.between=a":     "operator 'between' for filter field 'Id' takes 2 values",
+			"/test/?Id.between=a,b,c": "operator 'between' for filter field 'Id' takes 2 values",
+			"/plain/?Id.gt=a":         "filter operators are not supported",
+			"/plain/count?Id.gte=a":   "filter operators are not supported",
+		} {
+			code, ret, _ := util.GetJsonRequestResponse(app, "GET", url, nil)
+			assert.Equal(t, 400, code, url)
+			assert.Equal(t, msg, ret["error"], url)
+		}
+	})
+}
+
+func TestSearchMap(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app := fiber.New()
+		defer cleanup(app)
+		data := &TestData{entries: make(map[string]TestItem), permit: true}
+		data.entries["id1"] = TestItem{Id: "id1", Data: "some data"}
+		data.entries["id2"] = TestItem{Id: "id2"}
+		api := newTestApi(data)
+		var got []map[string]any
+		api.SearchMap = func(fields map[string]any) []TestItem {
+			got = append(got, fields)
+			var all []TestItem
+			for _, item := range api.FindAll() {
+				if data, ok := fields["Data"]; !ok || item.Data == data {
+					all = append(all, item)
+				}
+			}
+			return all
+		}
+		api.SearchableFields = []string{"Data"}
+		RegisterAPI(app, api)
+
+		code, list, _ := util.GetJsonSliceRequestResponse(app, "POST", "/test/filter", map[string]any{"Data": ""})
+		assert.Equal(t, 200, code)
+		if assert.Len(t, list, 1) {
+			assert.Equal(t, "id2", list[0]["Id"])
+		}
+		code, list, _ = util.GetJsonSliceRequestResponse(app, "GET", "/test/?Data=", nil)
+		assert.Equal(t, 200, code)
+		assert.Len(t, list, 1)
+		assert.Equal(t, []map[string]any{{"Data": ""}, {"Data": ""}}, got)
+
+		// Without a zero value Search is used
+		code, list, _ = util.GetJsonSliceRequestResponse(app, "POST", "/test/filter", map[string]any{"Data": "some"})
+		assert.Equal(t, 200, code)
+		assert.Len(t, list, 1)
+		assert.Len(t, got, 2)
+
+		// A zero value is still checked against the SearchableFields
+		code, ret, _ := util.GetJsonRequestResponse(app, "POST", "/test/filter", map[string]any{"Id": ""})
+		assert.Equal(t, 400, code)
+		assert.Equal(t, "field 'Id' is not searchable", ret["error"])
+	})
+}
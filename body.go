@@ -0,0 +1,216 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// unknownFieldsError is returned by parseBody for a JSON body with fields that are not on the Jdo
+type unknownFieldsError struct {
+	fields []string
+}
+
+func (e unknownFieldsError) Error() string {
+	return "unknown fields: " + strings.Join(e.fields, ", ")
+}
+
+// unsupportedTypeError is returned by parseBody for a body with a content type the Api doesn't accept
+type unsupportedTypeError struct {
+	mime     string
+	accepted []string
+}
+
+func (e unsupportedTypeError) Error() string {
+	if e.mime == "" {
+		return "missing content type, expected one of " + strings.Join(e.accepted, ", ")
+	}
+	return "unsupported content type '" + e.mime + "', expected one of " + strings.Join(e.accepted, ", ")
+}
+
+// bodyTooLargeError is returned by parseBody for a body larger than MaxBodyBytes
+type bodyTooLargeError struct {
+	limit int
+}
+
+func (e bodyTooLargeError) Error() string {
+	return "request body larger than " + strconv.Itoa(e.limit) + " bytes"
+}
+
+// checkBodySize checks the request body is no larger than MaxBodyBytes
+func (api Api[T, D]) checkBodySize(c *fiber.Ctx) error {
+	if api.MaxBodyBytes > 0 && (c.Request().Header.ContentLength() > api.MaxBodyBytes || len(c.Body()) > api.MaxBodyBytes) {
+		return bodyTooLargeError{limit: api.MaxBodyBytes}
+	}
+	return nil
+}
+
+// bodyTypes are the content types accepted for request bodies
+func (api Api[T, D]) bodyTypes() []string {
+	if api.BodyTypes != nil {
+		return api.BodyTypes
+	}
+	return bodyMimes
+}
+
+// checkContentType checks the content type of the request body is accepted.
+// With LenientContentType a body without a content type is treated as JSON.
+func (api Api[T, D]) checkContentType(c *fiber.Ctx) error {
+	mime := contentType(c)
+	if mime == "" && api.LenientContentType {
+		c.Request().Header.SetContentType(fiber.MIMEApplicationJSON)
+		return nil
+	}
+	for _, accepted := range api.bodyTypes() {
+		if mime == accepted {
+			return nil
+		}
+	}
+	return unsupportedTypeError{mime: mime, accepted: api.bodyTypes()}
+}
+
+// contentType is the lower case content type of the request body without parameters
+func contentType(c *fiber.Ctx) string {
+	mime, _, _ := strings.Cut(c.Get(fiber.HeaderContentType), ";")
+	return strings.ToLower(strings.TrimSpace(mime))
+}
+
+// parseBody parses the request body into out.
+// 413 if it is larger than MaxBodyBytes, 415 if the content type isn't accepted.
+// With StrictBody a JSON body is decoded directly and fields that are not on the Jdo are rejected.
+// Other content types always use their codec or the fiber BodyParser.
+func (api Api[T, D]) parseBody(c *fiber.Ctx, out any) error {
+	if err := api.checkBodySize(c); err != nil {
+		return err
+	}
+	if err := api.checkContentType(c); err != nil {
+		return err
+	}
+	if !api.StrictBody || !strings.HasPrefix(strings.ToLower(c.Get(fiber.HeaderContentType)), fiber.MIMEApplicationJSON) {
+		return bodyParser(c, out)
+	}
+	// Collect every unknown top level field for the error
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &raw); err != nil {
+		return err
+	}
+	known := jsonFieldNames(reflect.TypeOf(out).Elem())
+	var unknown []string
+	for name := range raw {
+		if !known[strings.ToLower(name)] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return unknownFieldsError{fields: unknown}
+	}
+	// Nested structs are checked by the decoder
+	dec := json.NewDecoder(bytes.NewReader(c.Body()))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(out); err != nil {
+		if strings.HasPrefix(err.Error(), "json: unknown field ") {
+			return unknownFieldsError{fields: []string{strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)}}
+		}
+		return err
+	}
+	return nil
+}
+
+// jsonFieldNames returns the lower case json names of the fields of struct type t, as matched by encoding/json
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case name == "-":
+			continue
+		case f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct:
+			// Embedded struct fields are promoted
+			for n := range jsonFieldNames(f.Type) {
+				names[n] = true
+			}
+			continue
+		case !f.IsExported():
+			continue
+		case name == "":
+			name = f.Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+	return names
+}
+
+// sendBodyError responds to a body that can't be parsed with 400, listing any unknown fields or describing a JSON type
+// or syntax error, 413 if it is too large, or 415 if its content type isn't accepted
+func (api Api[T, D]) sendBodyError(c *fiber.Ctx, err error) error {
+	api.logger().Warnf("Error parsing body %v\n", err)
+	var unknown unknownFieldsError
+	if errors.As(err, &unknown) {
+		return sendError(c, fiber.StatusBadRequest, unknown)
+	}
+	var unsupported unsupportedTypeError
+	if errors.As(err, &unsupported) {
+		return sendError(c, fiber.StatusUnsupportedMediaType, unsupported)
+	}
+	var tooLarge bodyTooLargeError
+	if errors.As(err, &tooLarge) {
+		return sendError(c, fiber.StatusRequestEntityTooLarge, tooLarge)
+	}
+	if handler := errorHandler(c); handler != nil {
+		return handler(c, fiber.StatusBadRequest, err)
+	}
+	if detail := jsonErrorDetail(err); detail != nil {
+		return sendError(c, fiber.StatusBadRequest, detail)
+	}
+	return c.SendStatus(fiber.StatusBadRequest)
+}
+
+// jsonErrorDetail describes a JSON decoding error without echoing the body: the field and type expected for a value of
+// the wrong type, or the offset of a syntax error.  It is nil for other errors.
+func jsonErrorDetail(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return fmt.Errorf("invalid value for field '%s', expected %s not %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("invalid value, expected %s not %s", typeErr.Type, typeErr.Value)
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("invalid JSON syntax at offset %d", syntaxErr.Offset)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"reflect"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errEmptySet rejects a bulk update without any fields to set
+var errEmptySet = errors.New("no fields to set")
+
+// errEmptyFilter rejects a bulk change without a filter, which would change every item
+var errEmptyFilter = errors.New("a filter is required")
+
+// errTooManyMatched rejects a bulk delete whose filter matches more than MaxResults items, which were not all found
+var errTooManyMatched = errors.New("the filter matches more than the maximum results")
+
+// deletedResponse is the response of POST /deleteWhere
+type deletedResponse struct {
+	XMLName xml.Name `json:"-" xml:"deleted"`
+	Deleted int64    `json:"deleted" xml:",chardata"`
+}
+
+// updateWhereBody is the body of POST /updateWhere
+type updateWhereBody[D any] struct {
+	Filter D              `json:"filter" xml:"filter"`
+	Set    map[string]any `json:"set" xml:"-"` // The Jdo fields to set, as for PATCH
+}
+
+// updatedResponse is the response of POST /updateWhere
+type updatedResponse struct {
+	XMLName xml.Name `json:"-" xml:"result"`
+	Matched int      `json:"matched" xml:"matched"`
+	Updated int      `json:"updated" xml:"updated"`
+}
+
+// updateWhere sets the fields in the body's set on every item matching its filter, leaving the other fields as they were.
+// It responds with the number of items matched and updated.
+// 400 if the filter or set is empty or set names fields that are not on the Jdo.
+// The access check is ActionMutate with every item matched, each patched Jdo is validated before any is changed.
+func updateWhere[T any, D any](api Api[T, D]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body updateWhereBody[D]
+		if err := api.parseBody(c, &body); err != nil {
+			return api.sendBodyError(c, err)
+		}
+		if reflect.ValueOf(&body.Filter).Elem().IsZero() {
+			return sendError(c, fiber.StatusBadRequest, errEmptyFilter)
+		}
+		if err := api.checkSearchable(body.Filter); err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+		if len(body.Set) == 0 {
+			return sendError(c, fiber.StatusBadRequest, errEmptySet)
+		}
+		if err := validatePatch[D](body.Set); err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+
+		ctx := c.UserContext()
+		items, err := api.ops.search(ctx, body.Filter)
+		if err != nil {
+			return api.sendQueryError(c, err)
+		}
+		if err := api.authorize(c, ActionMutate, items...); err != nil {
+			return sendDenied(c, err)
+		}
+		for _, item := range items {
+			if err := api.validate(patchDto(api.Dto(item), body.Set)); err != nil {
+				return sendValidationError(c, err)
+			}
+		}
+
+		updated, err := api.ops.updateAll(ctx, items, body.Set)
+		if err != nil {
+			api.logger().Errorf("Error updating items in %s after %d: %v\n", api.Path, len(updated), err)
+			return sendCallbackError(c, err)
+		}
+		for i := range updated {
+			api.notifyChange(ActionMutate, &items[i], &updated[i])
+		}
+		return render(c, updatedResponse{Matched: len(items), Updated: len(updated)})
+	}
+}
+
+// updateEach is the updateAll of stores without transactions, patching the items one at a time.
+// Without a Patch function the fields are applied to each item's Jdo and it is passed to Mutate.
+// The items patched before any error are returned.
+func (o ops[T, D]) updateEach(dto func(T) D) func(ctx context.Context, items []T, fields map[string]any) ([]T, error) {
+	return func(ctx context.Context, items []T, fields map[string]any) ([]T, error) {
+		updated := make([]T, 0, len(items))
+		for _, item := range items {
+			var err error
+			if o.patch != nil {
+				item, err = o.patch(ctx, item, fields)
+			} else {
+				item, err = o.mutate(ctx, item, patchDto(dto(item), fields))
+			}
+			if err != nil {
+				return updated, err
+			}
+			updated = append(updated, item)
+		}
+		return updated, nil
+	}
+}
+
+// deleteWhere deletes every item matching the filter in the body, responding with the number deleted.
+// 400 if the filter is empty, or matches more than MaxResults items.  The access check is ActionDelete with every item matched,
+// and only the matched items are deleted.
+func deleteWhere[T any, D any](api Api[T, D]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var filter D
+		if err := api.parseBody(c, &filter); err != nil {
+			return api.sendBodyError(c, err)
+		}
+		if reflect.ValueOf(&filter).Elem().IsZero() {
+			return sendError(c, fiber.StatusBadRequest, errEmptyFilter)
+		}
+		if err := api.checkSearchable(filter); err != nil {
+			return sendError(c, fiber.StatusBadRequest, err)
+		}
+
+		ctx := c.UserContext()
+		items, err := api.ops.search(ctx, filter)
+		if err != nil {
+			return api.sendQueryError(c, err)
+		}
+		if api.MaxResults > 0 && len(items) > api.MaxResults {
+			return sendError(c, fiber.StatusBadRequest, errTooManyMatched)
+		}
+		if err := api.authorize(c, ActionDelete, items...); err != nil {
+			return sendDenied(c, err)
+		}
+
+		// In one transaction if the store can, otherwise one at a time
+		var deleted int64
+		if api.ops.deleteAll != nil {
+			deleted, err = api.ops.deleteAll(ctx, items)
+		} else {
+			for _, item := range items {
+				if _, err = api.ops.delete(ctx, item); err != nil {
+					break
+				}
+				deleted++
+			}
+		}
+		if err != nil {
+			api.logger().Errorf("Error deleting items from %s after %d: %v\n", api.Path, deleted, err)
+			return sendCallbackError(c, err)
+		}
+		for i := range items {
+			api.notifyChange(ActionDelete, &items[i], nil)
+		}
+		return render(c, deletedResponse{Deleted: deleted})
+	}
+}
@@ -0,0 +1,101 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// cloneOne creates a copy of the item on the path from its Jdo, with the fields in the body, if any, replacing
+// those of the copy as for PATCH.  The body must set a new key unless Create generates one.
+// The access check is ActionCreate with the Jdo of the copy and the source item.
+// 404 if the source is not found
+// 400 if the body cannot be parsed or names fields that are not on the Jdo
+// 409 if Create reports the key is taken
+func cloneOne[T any, D any](api Api[T, D]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+
+		// Parse the overrides, which are optional
+		var body patchBody
+		if len(c.Body()) > 0 {
+			var err error
+			if body, err = api.parsePatch(c); err != nil {
+				return api.sendBodyError(c, err)
+			}
+			if err := validatePatch[D](body.fields); err != nil {
+				return sendError(c, fiber.StatusBadRequest, err)
+			}
+		}
+
+		// Find the source
+		source, ok, err := api.ops.find(c.UserContext(), api.itemKey(c))
+		if err != nil {
+			return api.sendFindError(c, err)
+		}
+		if !ok {
+			// don't leak existence information if unauthorized
+			if err := api.authorize(c, ActionCreate); err != nil {
+				return sendDenied(c, err)
+			}
+			return sendStatus(c, fiber.StatusNotFound)
+		}
+
+		fields, err := patchFields(api.Dto(source), body)
+		var opErr patchOpError
+		if errors.As(err, &opErr) {
+			return sendPatchOpError(c, opErr)
+		}
+		if err != nil {
+			return sendCallbackError(c, err)
+		}
+		clone := patchDto(api.Dto(source), fields)
+		if err := api.authorizeIncoming(c, ActionCreate, &clone, source); err != nil {
+			return sendDenied(c, err)
+		}
+		if err := api.validate(clone); err != nil {
+			return sendValidationError(c, err)
+		}
+
+		// Create, with copies of the children if the store supports it
+		var item T
+		if api.ops.clone != nil {
+			item, err = api.ops.clone(c.UserContext(), source, clone)
+		} else {
+			item, err = api.ops.create(c.UserContext(), clone)
+		}
+		if err != nil {
+			api.logger().Errorf("Error cloning item in %s: %v, %v\n", api.Path, clone, err)
+			return sendCallbackError(c, err)
+		}
+		api.notifyChange(ActionCreate, nil, &item)
+		if api.CreatedStatus {
+			if api.Key != nil {
+				c.Location(api.prefix + "/" + api.keyPath(api.Key(item)))
+			}
+			c.Status(fiber.StatusCreated)
+		}
+		return api.sendItem(c, ActionCreate, item)
+	}
+}
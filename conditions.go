@@ -0,0 +1,108 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Operator compares a field with the values of a Condition
+type Operator string
+
+const (
+	OpGt      Operator = "gt"      // Greater than the value
+	OpGte     Operator = "gte"     // Greater than or equal to the value
+	OpLt      Operator = "lt"      // Less than the value
+	OpLte     Operator = "lte"     // Less than or equal to the value
+	OpIn      Operator = "in"      // Equal to one of a comma separated list of values
+	OpBetween Operator = "between" // Between two comma separated values, inclusive
+)
+
+// errConditionsUnsupported is the error of a filter with conditions on an Api without SearchAdvanced
+var errConditionsUnsupported = errors.New("filter operators are not supported")
+
+// checkFilterable returns an error if the api cannot search with the query filter, filtered with conditions
+func (api Api[T, D]) checkFilterable(filtered bool, conditions []Condition) error {
+	if len(conditions) > 0 && api.ops.searchAdvanced == nil {
+		return errConditionsUnsupported
+	}
+	if filtered && len(conditions) == 0 && api.ops.search == nil {
+		return errors.New("filtering is not supported")
+	}
+	return nil
+}
+
+// operators are the Operators with the number of values each takes, -1 for one or more
+var operators = map[Operator]int{OpGt: 1, OpGte: 1, OpLt: 1, OpLte: 1, OpIn: -1, OpBetween: 2}
+
+// Condition compares a field of D in a filter, from a query parameter of the field name and operator,
+// e.g. ?Field2.gte=10 or ?Key.in=id1,id2.  Conditions are passed to SearchAdvanced.
+type Condition struct {
+	Field  string   // The name of the field of D
+	Op     Operator // The comparison
+	Values []any    // The values, of the type of the field, one for a comparison, two for between and one or more for in
+}
+
+// parseCondition parses a query parameter of the form field.op into a Condition of a field of dT.
+// ok is false if name has no operator, so it is a plain filter field.
+func parseCondition(dT reflect.Type, name string, value string) (cond Condition, ok bool, err error) {
+	field, op, found := cutLast(name, ".")
+	if !found {
+		return cond, false, nil
+	}
+	f, known := dT.FieldByName(field)
+	if !known || !f.IsExported() || f.Tag.Get("json") == "-" {
+		return cond, true, fmt.Errorf("unknown filter field '%s'", field)
+	}
+	n, known := operators[Operator(op)]
+	if !known {
+		return cond, true, fmt.Errorf("unknown operator '%s' for filter field '%s'", op, field)
+	}
+	parts := []string{value}
+	if n != 1 {
+		parts = strings.Split(value, ",")
+	}
+	if n > 0 && len(parts) != n {
+		return cond, true, fmt.Errorf("operator '%s' for filter field '%s' takes %d values", op, field, n)
+	}
+	cond = Condition{Field: field, Op: Operator(op)}
+	for _, part := range parts {
+		v := reflect.New(f.Type).Elem()
+		if err := setFromString(v, part); err != nil {
+			return cond, true, fmt.Errorf("invalid value for filter field '%s': %v", name, err)
+		}
+		cond.Values = append(cond.Values, v.Interface())
+	}
+	return cond, true, nil
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s string, sep string) (before string, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,113 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeaderNextCursor is the header of a full page of a list with the cursor of the next page, when the Api pages with cursors
+const HeaderNextCursor = "X-Next-Cursor"
+
+// errInvalidCursor is a ?cursor= that can't be decoded, or that was issued for a different sort, a 400
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor is the position after the last item of a page, sent to clients base64 encoded as an opaque cursor.
+// The next page is the items after it in the order of the sort, which is checked is unchanged.
+type pageCursor struct {
+	Sort     string            `json:"s"`           // The sort specification the cursor was issued for
+	Values   []json.RawMessage `json:"v"`           // The values of the sort fields and then the keys of the last item
+	Position int               `json:"p,omitempty"` // The number of items before the next page, to cap the list at MaxResults
+}
+
+// sortSpec formats sort fields as a sort specification, e.g. "-Field2,Key"
+func sortSpec(fields []SortField) string {
+	specs := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f.Desc {
+			specs = append(specs, "-"+f.Field)
+		} else {
+			specs = append(specs, f.Field)
+		}
+	}
+	return strings.Join(specs, ",")
+}
+
+// parseCursor reads the ?cursor= query parameter, returning the values of the item the page starts after, nil if there is none,
+// and the number of items before the page
+func (api Api[T, D]) parseCursor(c *fiber.Ctx, fields []SortField) ([]json.RawMessage, int, error) {
+	s := c.Query("cursor")
+	if s == "" {
+		return nil, 0, nil
+	}
+	if api.ops.findAfter == nil {
+		return nil, 0, errors.New("cursor paging is not supported")
+	}
+	if c.Query("offset") != "" {
+		return nil, 0, errors.New("offset cannot be used with a cursor")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, 0, errInvalidCursor
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, 0, errInvalidCursor
+	}
+	if cursor.Sort != sortSpec(fields) {
+		return nil, 0, fmt.Errorf("%w, it was issued for sort '%s'", errInvalidCursor, cursor.Sort)
+	}
+	var emptyT T
+	if len(cursor.Values) != len(api.ops.cursor(emptyT, fields)) || cursor.Position < 0 {
+		return nil, 0, errInvalidCursor
+	}
+	return cursor.Values, cursor.Position, nil
+}
+
+// nextCursor returns the cursor of the page after items, which start at position in the list.
+// It is "" if the Api doesn't page with cursors or items is not a full page.
+func (api Api[T, D]) nextCursor(items []T, fields []SortField, limit int, position int) (string, error) {
+	if api.ops.cursor == nil || limit <= 0 || len(items) < limit {
+		return "", nil
+	}
+	values := api.ops.cursor(items[len(items)-1], fields)
+	cursor := pageCursor{Sort: sortSpec(fields), Values: make([]json.RawMessage, 0, len(values)), Position: position + len(items)}
+	for _, v := range values {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		cursor.Values = append(cursor.Values, b)
+	}
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
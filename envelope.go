@@ -0,0 +1,58 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import "encoding/xml"
+
+// envelope wraps a response when the Api uses an Envelope
+type envelope struct {
+	XMLName xml.Name      `json:"-" xml:"envelope"`
+	Data    any           `json:"data" xml:"data"`
+	Meta    *envelopeMeta `json:"meta,omitempty" xml:"meta,omitempty"`
+}
+
+// envelopeMeta describes the list in an envelope
+type envelopeMeta struct {
+	Count  int `json:"count" xml:"count"`   // The number of items in data
+	Limit  int `json:"limit" xml:"limit"`   // The page size, 0 if not paged
+	Offset int `json:"offset" xml:"offset"` // The offset of the first item
+
+	Truncated  bool   `json:"truncated,omitempty" xml:"truncated,omitempty"`     // The list was truncated to MaxResults
+	NextCursor string `json:"next_cursor,omitempty" xml:"next_cursor,omitempty"` // The ?cursor= of the next page, if the Api pages with cursors
+}
+
+// list wraps a list response if collections are enveloped
+func (api Api[T, D]) list(data any, count int, limit int, offset int, truncated bool, next string) any {
+	if api.Envelope == EnvelopeNone {
+		return data
+	}
+	return envelope{Data: data, Meta: &envelopeMeta{Count: count, Limit: limit, Offset: offset, Truncated: truncated, NextCursor: next}}
+}
+
+// one wraps a single item response if all responses are enveloped
+func (api Api[T, D]) one(data any) any {
+	if api.Envelope != EnvelopeAll {
+		return data
+	}
+	return envelope{Data: data}
+}
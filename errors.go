@@ -0,0 +1,136 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// Errors that FindE, FindAllE, SearchE, Create, Mutate, Patch and Delete functions can return (or wrap) to signal a specific response status.
+// Any other error results in a 500.
+var (
+	ErrNotFound    = errors.New("not found")           // 404 Not Found
+	ErrConflict    = errors.New("conflict")            // 409 Conflict
+	ErrValidation  = errors.New("validation failed")   // 422 Unprocessable Entity
+	ErrForbidden   = errors.New("forbidden")           // 403 Forbidden
+	ErrUnavailable = errors.New("service unavailable") // 503 Service Unavailable
+)
+
+// StatusCoder can be implemented by errors to choose their own response status.
+// It is found with errors.As so wrapped errors are supported.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// errorStatus maps an error to its response status, defaulting to 500
+func errorStatus(err error) int {
+	var coder StatusCoder
+	switch {
+	case errors.As(err, &coder):
+		return coder.StatusCode()
+	case errors.Is(err, ErrNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		return fiber.StatusConflict
+	case errors.Is(err, ErrValidation):
+		return fiber.StatusUnprocessableEntity
+	case errors.Is(err, ErrForbidden):
+		return fiber.StatusForbidden
+	case isUnavailableError(err):
+		return fiber.StatusServiceUnavailable
+	}
+	return fiber.StatusInternalServerError
+}
+
+// isUnavailableError detects errors where the backend could not be reached,
+// either ErrUnavailable, a bad driver connection or a network error.
+func isUnavailableError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, ErrUnavailable) || errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr)
+}
+
+// sendFindError responds to a failed Find, logging the cause
+func (api Api[T, D]) sendFindError(c *fiber.Ctx, err error) error {
+	api.logger().Errorf("Error finding %s: %v\n", api.itemKey(c), err)
+	return sendCallbackError(c, err)
+}
+
+// sendQueryError responds to a failed FindAll or Search with a JSON error.
+// Internal errors are logged rather than described to the client.
+func (api Api[T, D]) sendQueryError(c *fiber.Ctx, err error) error {
+	api.logger().Errorf("Error querying %s: %v\n", c.Path(), err)
+	status := errorStatus(err)
+	if handler := errorHandler(c); handler != nil {
+		return handler(c, status, err)
+	}
+	if status == fiber.StatusInternalServerError {
+		err = errors.New(utils.StatusMessage(status))
+	}
+	return sendError(c, status, err)
+}
+
+// sendCallbackError responds with the status for an error returned by an Api function.
+// Internal errors are not described to the client, but are passed to the ErrorHandler.
+func sendCallbackError(c *fiber.Ctx, err error) error {
+	status := errorStatus(err)
+	if handler := errorHandler(c); handler != nil {
+		return handler(c, status, err)
+	}
+	if status == fiber.StatusInternalServerError {
+		return c.SendStatus(status)
+	}
+	return sendError(c, status, err)
+}
+
+// errorHandlerKey is the Locals key of the ErrorHandler of the Api handling the request
+type errorHandlerKey struct{}
+
+// handlingErrors wraps handler so its error responses are sent by the ErrorHandler, if the Api has one
+func (api Api[T, D]) handlingErrors(handler fiber.Handler) fiber.Handler {
+	if api.ErrorHandler == nil {
+		return handler
+	}
+	return func(c *fiber.Ctx) error {
+		c.Locals(errorHandlerKey{}, api.ErrorHandler)
+		return handler(c)
+	}
+}
+
+// errorHandler returns the ErrorHandler of the Api handling the request, nil if it has none
+func errorHandler(c *fiber.Ctx) func(c *fiber.Ctx, status int, err error) error {
+	handler, _ := c.Locals(errorHandlerKey{}).(func(c *fiber.Ctx, status int, err error) error)
+	return handler
+}
+
+// sendStatus responds with an error status and its message, or with the ErrorHandler and a *fiber.Error of the status
+func sendStatus(c *fiber.Ctx, status int) error {
+	if handler := errorHandler(c); handler != nil {
+		return handler(c, status, fiber.NewError(status))
+	}
+	return c.SendStatus(status)
+}
@@ -0,0 +1,131 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// etag returns the quoted entity tag of item, from Version if set or otherwise a hash of its serialised Jdo
+func (api Api[T, D]) etag(item T) string {
+	if api.Version != nil {
+		return `"` + api.Version(item) + `"`
+	}
+	b, err := api.marshal(api.Dto(item))
+	if err != nil {
+		return ""
+	}
+	return hashETag(b)
+}
+
+// taggedOne encodes out, the response of a GET of item from representOne, returning the body with its content type and entity tag.
+// The tag is a hash of the body, so each representation of the item, e.g. redacted for a role or restricted to some fields, has its own.
+// With Version the tag is the version, with a hash of the body appended unless it is the whole Jdo of the item as JSON.
+func (api Api[T, D]) taggedOne(c *fiber.Ctx, item T, out any, whole bool) (b []byte, mime string, etag string, err error) {
+	if b, mime, err = encode(c, out); err != nil {
+		return nil, "", "", err
+	}
+	switch {
+	case api.Version == nil:
+		etag = hashETag(b)
+	case whole && mime == fiber.MIMEApplicationJSON:
+		etag = `"` + api.Version(item) + `"`
+	default:
+		etag = `"` + api.Version(item) + "-" + strings.Trim(hashETag(b), `"`) + `"`
+	}
+	return b, mime, etag, nil
+}
+
+// hashETag returns a quoted entity tag that is a hash of b
+func hashETag(b []byte) string {
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	return fmt.Sprintf(`"%x"`, h.Sum64())
+}
+
+// ifMatch checks the If-Match header of the request against the entity tag of item, or the tag of item as a GET
+// with the request would send it, see taggedOne.  A request without If-Match always matches.
+func (api Api[T, D]) ifMatch(c *fiber.Ctx, item T) bool {
+	header := c.Get(fiber.HeaderIfMatch)
+	if header == "" {
+		return true
+	}
+	if etagMatches(header, api.etag(item)) {
+		return true
+	}
+	fields, err := parseFields[D](c.Query("fields"))
+	if err != nil {
+		return false
+	}
+	expand, err := api.parseExpand(c.Query("expand"))
+	if err != nil {
+		return false
+	}
+	out, whole, err := api.representOne(c, item, fields, expand)
+	if err != nil {
+		return false
+	}
+	_, _, etag, err := api.taggedOne(c, item, out, whole)
+	return err == nil && etagMatches(header, etag)
+}
+
+// notModified checks the If-None-Match header of the request against etag using the weak comparison
+func notModified(c *fiber.Ctx, etag string) bool {
+	header := c.Get(fiber.HeaderIfNoneMatch)
+	if header == "" {
+		return false
+	}
+	header = strings.ReplaceAll(header, "W/", "")
+	return etagMatches(header, strings.TrimPrefix(etag, "W/"))
+}
+
+// sendTagged sends v as JSON, or the preferred codec, with an ETag that is a hash of the body.
+// If the ETag matches If-None-Match, 304 is sent without the body.
+func sendTagged(c *fiber.Ctx, v any) error {
+	b, mime, err := encode(c, v)
+	if err != nil {
+		return sendEncodeError(c, err)
+	}
+	etag := hashETag(b)
+	c.Set(fiber.HeaderETag, etag)
+	if notModified(c, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	c.Set(fiber.HeaderContentType, mime)
+	return c.Send(b)
+}
+
+// etagMatches checks if etag is in a comma separated list of entity tags, "*" matches any tag
+func etagMatches(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || (tag == etag && etag != "") {
+			return true
+		}
+	}
+	return false
+}
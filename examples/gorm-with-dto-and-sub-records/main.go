@@ -34,6 +34,7 @@ import (
 
 // This example implements a more complex structure where DTOs are used and child objects are exposed
 // For example:  http://localhost:8080/api/v1/department/Sales/employees to list the employees of the sales department.
+// Child paths can be nested, http://localhost:8080/api/v1/departments/Sales/employees/2/location is the location of an employee.
 // The Location is also exposed on the employee directly http://localhost:8080/api/v1/employees/1
 // And Locations are also exposed http://localhost:8080/api/v§/locations/
 
@@ -51,7 +52,7 @@ type Employee struct {
 	Name         string
 	DepartmentID string // Foreign key
 	LocationID   string
-	Location     Location
+	Location     Location `rest:"child"`
 }
 
 type EmployeeDto struct {
@@ -81,9 +82,12 @@ func main() {
 
 	api := app.Group("/api")
 	apiV1 := api.Group("/v1")
-	easyrest.RegisterApi(apiV1, db, "employees", easyrest.DefaultOptions[Employee, EmployeeDto]())
-	easyrest.RegisterApi(apiV1, db, "departments", easyrest.DefaultOptions[Department, DepartmentDto]())
-	easyrest.RegisterApi(apiV1, db, "locations", easyrest.DefaultOptions[Location, Location]())
+	easyrest.MustRegisterApi(apiV1, db, "employees", easyrest.DefaultOptions[Employee, EmployeeDto]())
+	// Preload the Location of each employee, so it is populated in /departments/Sales/employees
+	departments := easyrest.DefaultOptions[Department, DepartmentDto]()
+	departments.Preloads = []string{"Employees.Location"}
+	easyrest.MustRegisterApi(apiV1, db, "departments", departments)
+	easyrest.MustRegisterApi(apiV1, db, "locations", easyrest.DefaultOptions[Location, Location]())
 
 	// Create some test data
 	elm := Location{Name: "Elm", Address: "1 Wall Street"}
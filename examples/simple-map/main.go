@@ -111,7 +111,7 @@ func main() {
 		},
 	}
 
-	easyrest.RegisterAPI(apiV1, restApi)
+	easyrest.MustRegisterAPI(apiV1, restApi)
 
 	_ = app.Listen("127.0.0.1:8080")
 }
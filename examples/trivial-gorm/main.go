@@ -35,7 +35,7 @@ import (
 // This example exposes a CRUD API for "Employee" backed by GORM on http://127.0.0.1:8080/api/v1/employees
 // Using the Employee type as both the data object and as the transport object.
 // With GET employees/ to get all
-// With POST employees/filter to search with exact matches ( "like" is not yet implemented )
+// With POST employees/filter to search, the Name is matched as a substring and the other fields exactly
 // With GET employees/:id to get one
 // With PUT employees/:id to change one
 // With DELETE employees/:id to delete one
@@ -43,7 +43,7 @@ import (
 
 type Employee struct {
 	gorm.Model
-	Name       string
+	Name       string `rest:"search=contains"`
 	EmployeeNo int
 	Department string
 }
@@ -63,7 +63,7 @@ func main() {
 
 	api := app.Group("/api")
 	apiV1 := api.Group("/v1")
-	easyrest.RegisterApi(apiV1, db, "employees", easyrest.DefaultOptions[Employee, Employee]())
+	easyrest.MustRegisterApi(apiV1, db, "employees", easyrest.DefaultOptions[Employee, Employee]())
 
 	// Add some test records
 	db.Save(&Employee{
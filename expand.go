@@ -0,0 +1,98 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// parseExpand parses the SubEntities to embed in a response, a comma separated list of their SubPaths or "*" for all of them
+func (api Api[T, D]) parseExpand(spec string) ([]SubEntity[T, D], error) {
+	if spec == "" {
+		return nil, nil
+	}
+	if spec == "*" {
+		return api.SubEntities, nil
+	}
+	var subs []SubEntity[T, D]
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, sub := range api.SubEntities {
+			if sub.SubPath == name {
+				subs = append(subs, sub)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown expansion '%s'", name)
+		}
+	}
+	return subs, nil
+}
+
+// expandOne embeds the children of item from each of subs in v, the Jdo of item, under their SubPath
+func (api Api[T, D]) expandOne(ctx context.Context, v any, item T, subs []SubEntity[T, D]) (any, error) {
+	all, err := asDecoded(v)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := all.(map[string]any); ok {
+		for _, sub := range subs {
+			if m[sub.SubPath], err = expandedChildren(ctx, sub, item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return all, nil
+}
+
+// expandList embeds the children of each of items from each of subs in v, the list of their Jdos
+func (api Api[T, D]) expandList(ctx context.Context, v any, items []T, subs []SubEntity[T, D]) (any, error) {
+	all, err := asDecoded(v)
+	if err != nil {
+		return nil, err
+	}
+	list, _ := all.([]any)
+	for i, dto := range list {
+		if i >= len(items) {
+			break
+		}
+		if list[i], err = api.expandOne(ctx, dto, items[i], subs); err != nil {
+			return nil, err
+		}
+	}
+	return all, nil
+}
+
+// expandedChildren returns every child of parent from sub, transformed by its Dto.
+// Get is preferred to GetPage so children loaded with the parent, as gormrest preloads them, are not queried again for each parent.
+func expandedChildren[T any, D any](ctx context.Context, sub SubEntity[T, D], parent T) ([]any, error) {
+	if sub.Get != nil || sub.GetCtx != nil {
+		sub.GetPage = nil
+	}
+	return pageChildren(ctx, sub, parent, 0, 0)
+}
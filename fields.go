@@ -0,0 +1,139 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// parseFields parses a field selection of the form "Name,Address.City" into the json key paths of the fields.
+// Each name must be an exported field of D that is not excluded from JSON, fields of nested structs are named with a '.'.
+func parseFields[D any](spec string) ([][]string, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var emptyD D
+	dT := reflect.TypeOf(emptyD)
+	var paths [][]string
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		path, ok := jsonPath(dT, s)
+		if !ok {
+			return nil, fmt.Errorf("unknown field '%s'", s)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// jsonPath translates a dotted field name of t into the json keys used when t is serialised
+func jsonPath(t reflect.Type, name string) ([]string, bool) {
+	var path []string
+	for _, part := range strings.Split(name, ".") {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if part == "" || t.Kind() != reflect.Struct {
+			return nil, false
+		}
+		f, ok := t.FieldByName(part)
+		if !ok || !f.IsExported() {
+			return nil, false
+		}
+		key, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if key == "-" {
+			return nil, false
+		}
+		if key == "" {
+			key = f.Name
+		}
+		path = append(path, key)
+		t = f.Type
+	}
+	return path, true
+}
+
+// withFields returns v, a DTO or slice of DTOs, serialised and decoded keeping only the selected fields
+func withFields(v any, paths [][]string) (any, error) {
+	all, err := decoded(v)
+	if err != nil {
+		return nil, err
+	}
+	if list, ok := all.([]any); ok {
+		for i, item := range list {
+			list[i] = selectFields(item, paths)
+		}
+		return list, nil
+	}
+	return selectFields(all, paths), nil
+}
+
+// decoded returns v serialised to JSON and decoded back into maps and slices.
+// Numbers are decoded as json.Number so they are sent unchanged.
+func decoded(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var all any
+	err = dec.Decode(&all)
+	return all, err
+}
+
+// selectFields returns a copy of a serialised DTO with only the fields on the key paths
+func selectFields(v any, paths [][]string) any {
+	src, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	dest := map[string]any{}
+	for _, path := range paths {
+		copyPath(dest, src, path)
+	}
+	return dest
+}
+
+// copyPath copies the value at path from src to dest, creating any parent objects on the way
+func copyPath(dest map[string]any, src map[string]any, path []string) {
+	v, ok := src[path[0]]
+	if !ok {
+		return
+	}
+	child, isObject := v.(map[string]any)
+	if len(path) == 1 || !isObject {
+		dest[path[0]] = v
+		return
+	}
+	d, ok := dest[path[0]].(map[string]any)
+	if !ok {
+		d = map[string]any{}
+		dest[path[0]] = d
+	}
+	copyPath(d, child, path[1:])
+}
@@ -0,0 +1,218 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// reservedQueryParams are query parameters with their own meaning on collection endpoints,
+// they are never bound into a filter.
+var reservedQueryParams = map[string]bool{
+	"limit":  true,
+	"offset": true,
+	"cursor": true,
+	"sort":   true,
+	"fields": true,
+	"expand": true,
+	"format": true,
+
+	"updated_after": true,
+	"since":         true,
+}
+
+// bindQueryFilter binds the non-reserved query parameters of the request into a D filter.
+// Each parameter must name an exported, json visible field of D, or be a field and Operator making one of the conditions.
+// found is false if there are no filter parameters on the request.
+func bindQueryFilter[D any](c *fiber.Ctx) (filter D, conditions []Condition, found bool, err error) {
+	valFilter := reflect.Indirect(reflect.ValueOf(&filter))
+	dT := valFilter.Type()
+	c.Context().QueryArgs().VisitAll(func(key, value []byte) {
+		name := string(key)
+		if err != nil || reservedQueryParams[name] {
+			return
+		}
+		found = true
+		cond, isCondition, e := parseCondition(dT, name, string(value))
+		if isCondition {
+			err = e
+			conditions = append(conditions, cond)
+			return
+		}
+		f, ok := dT.FieldByName(name)
+		if !ok || !f.IsExported() || f.Tag.Get("json") == "-" {
+			err = fmt.Errorf("unknown filter field '%s'", name)
+			return
+		}
+		if e := setFromString(valFilter.FieldByIndex(f.Index), string(value)); e != nil {
+			err = fmt.Errorf("invalid value for filter field '%s': %v", name, e)
+		}
+	})
+	return filter, conditions, found, err
+}
+
+// checkSearchable returns an error naming the first field set in filter, or compared by a condition, that is not one of
+// the SearchableFields.  Every field is searchable if SearchableFields is empty.
+func (api Api[T, D]) checkSearchable(filter D, conditions ...Condition) error {
+	if len(api.SearchableFields) == 0 {
+		return nil
+	}
+	valFilter := reflect.ValueOf(filter)
+	dT := valFilter.Type()
+	for i := 0; i < dT.NumField(); i++ {
+		name := dT.Field(i).Name
+		if !dT.Field(i).IsExported() || valFilter.Field(i).IsZero() {
+			continue
+		}
+		if !api.searchable(name) {
+			return fmt.Errorf("field '%s' is not searchable", name)
+		}
+	}
+	for _, cond := range conditions {
+		if !api.searchable(cond.Field) {
+			return fmt.Errorf("field '%s' is not searchable", cond.Field)
+		}
+	}
+	return nil
+}
+
+// searchable is true if name is one of the SearchableFields
+func (api Api[T, D]) searchable(name string) bool {
+	for _, s := range api.SearchableFields {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyFilterFields returns the fields of filter given in the JSON body of the request, nil for other content types
+func bodyFilterFields[D any](c *fiber.Ctx, filter D) map[string]any {
+	if contentType(c) != fiber.MIMEApplicationJSON {
+		return nil
+	}
+	var raw map[string]json.RawMessage
+	if json.Unmarshal(c.Body(), &raw) != nil {
+		return nil
+	}
+	keys := map[string]bool{}
+	for key := range raw {
+		keys[strings.ToLower(key)] = true
+	}
+	return givenFields(filter, func(f reflect.StructField) bool {
+		key, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if key == "" {
+			key = f.Name
+		}
+		return keys[strings.ToLower(key)]
+	})
+}
+
+// queryFilterFields returns the fields of filter given as query parameters of the request
+func queryFilterFields[D any](c *fiber.Ctx, filter D) map[string]any {
+	return givenFields(filter, func(f reflect.StructField) bool {
+		return c.Context().QueryArgs().Has(f.Name)
+	})
+}
+
+// givenFields returns the values of the exported, json visible, fields of filter that were given, keyed by the field name
+func givenFields[D any](filter D, given func(f reflect.StructField) bool) map[string]any {
+	valFilter := reflect.ValueOf(filter)
+	if valFilter.Kind() != reflect.Struct {
+		return nil
+	}
+	fields := map[string]any{}
+	for i := 0; i < valFilter.NumField(); i++ {
+		f := valFilter.Type().Field(i)
+		if f.IsExported() && f.Tag.Get("json") != "-" && given(f) {
+			fields[f.Name] = valFilter.Field(i).Interface()
+		}
+	}
+	return fields
+}
+
+// searchesMap is true if the filter has to be searched with SearchMap, as a given field has its zero value
+// that searching with D would ignore.  It is an error if such a field isn't one of the SearchableFields.
+func (api Api[T, D]) searchesMap(fields map[string]any) (bool, error) {
+	if api.ops.searchMap == nil {
+		return false, nil
+	}
+	zero := false
+	for name, value := range fields {
+		if reflect.ValueOf(value).IsZero() {
+			if len(api.SearchableFields) > 0 && !api.searchable(name) {
+				return false, fmt.Errorf("field '%s' is not searchable", name)
+			}
+			zero = true
+		}
+	}
+	return zero, nil
+}
+
+// setFromString parses s into v according to the kind of v, or as RFC 3339 for a time.Time
+func setFromString(v reflect.Value, s string) error {
+	switch {
+	case v.Type() == reflect.TypeOf(time.Time{}):
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return fmt.Errorf("'%s' is not an RFC 3339 time", s)
+		}
+		v.Set(reflect.ValueOf(t))
+	case v.CanInt():
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || v.OverflowInt(i) {
+			return fmt.Errorf("'%s' is not an integer", s)
+		}
+		v.SetInt(i)
+	case v.CanUint():
+		i, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || v.OverflowUint(i) {
+			return fmt.Errorf("'%s' is not an unsigned integer", s)
+		}
+		v.SetUint(i)
+	case v.CanFloat():
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a number", s)
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a boolean", s)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
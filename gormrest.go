@@ -23,15 +23,21 @@
 package easyrest
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 // Options for the exposed GORM backed REST API.
@@ -48,6 +54,115 @@ type Options[T any, D any] struct {
 	Mutate    bool                                              // Enable mutate
 	Create    bool                                              // Enable create
 	Validator func(c *fiber.Ctx, action Action, item ...T) bool // Validation function, item is empty if this is a find all query or an item is not found
+
+	Validators map[Action]func(c *fiber.Ctx, item ...T) bool // Validation functions for single actions, used in preference to Validator for those actions
+
+	AccessValidator func(c *fiber.Ctx, action Action, item ...T) Access // Validation function that can deny with 401 or 403, used in preference to Validator and Validators
+
+	ValidatorE func(c *fiber.Ctx, action Action, item ...T) error // Validation function denying with an error sent as JSON with any Reason, used in preference to AccessValidator and Validator
+
+	ValidatorStatus func(c *fiber.Ctx, action Action, item ...T) (bool, int) // Validation function denying with the status it returns, e.g. 404 or 429, used in preference to AccessValidator and Validator
+
+	ValidatorD func(c *fiber.Ctx, action Action, existing *T, incoming *D) bool // Validation function with the incoming Dto for create and mutate, used in preference to the other validators
+
+	QueryFilter   bool // Allow GET / to be filtered with query parameters matching fields of D
+	CreatedStatus bool // Respond to create with 201 Created and a Location header
+
+	SearchableFields []string // The fields of D that filters may set, others are a 400, see Api.SearchableFields
+	SortableFields   []string // The fields of D that ?sort= may order by, others are a 400, see Api.SortableFields
+
+	// PartialStringMatch matches the string fields of a filter as case-insensitive substrings, with ILIKE on postgres
+	// and LIKE elsewhere, rather than exactly.  Without it only the fields of T tagged `rest:"search=contains"` are.
+	// Other fields are always matched exactly.
+	PartialStringMatch bool
+
+	// ZeroValueFilters matches the fields given in a filter body or query with their zero value, e.g. {"Enabled": false},
+	// rather than ignoring them as a struct filter does.  Clients sending every field of the Dto as a filter should leave it off.
+	ZeroValueFilters bool
+
+	DeleteResponse DeleteResponse // The response to a successful delete, defaults to the text "deleted".  DeleteResponseDto sends the deleted item
+
+	OnChange func(action Action, before *T, after *T) // Called asynchronously after a successful create, mutate or delete
+
+	Envelope     Envelope // Wrap responses in an envelope with metadata
+	IncludeLinks bool     // Add _links to the items in GET responses
+	StrictBody   bool     // Reject JSON bodies with fields that are not on the Dto
+
+	ValidateDto func(D) error // Validate incoming Dtos on create and mutate, e.g. ValidateTags[D], failures are a 422
+
+	TransformIn  func(c *fiber.Ctx, dto D) (D, error) // Rewrites incoming Dtos and filters before they are validated, see Api.TransformIn
+	TransformOut func(c *fiber.Ctx, dto D) D          // Rewrites the Dtos sent, see Api.TransformOut
+
+	ValidateRoutes bool // Expose POST /validate and /:id/validate, checking a Dto without saving it, see Api.ValidateRoutes
+
+	Clone         bool // Expose POST /:id/clone, creating a copy of an item from its Dto, see Api.Clone.  Create must be enabled
+	CloneChildren bool // Copy the has one and has many children tagged `rest:"child"` as new rows, their primary keys must be generated by the database
+
+	CustomActions []CustomAction[T, D] // Non CRUD operations on an item or the collection
+
+	DefaultOrder string // The ORDER BY of lists and searches, and of ties in ?sort=, e.g. "name, id desc".  Defaults to the key columns
+
+	// CursorPaging adds an opaque cursor to each full page of GET /, in the X-Next-Cursor header and the next_cursor of an envelope.
+	// GET /?cursor=...&limit= returns the page after it with a WHERE on the sort and key columns rather than an OFFSET, so deep pages
+	// of large tables stay fast.  The sort and filter of the request must be unchanged, and pages after a cursor have no total or Link.
+	// The cursor also holds the position of the next page, so MaxResults caps the list walked with cursors as it does with offsets.
+	// It orders ties by the keys so can't be used with DefaultOrder.
+	CursorPaging bool
+
+	TotalHeader string // The header with the total of lists and searches, counted with COUNT, defaults to X-Total-Count, see Api.TotalHeader
+
+	CountDeleted bool // GET and POST /count include soft deleted rows, which lists and their totals never do
+	MaxResults   int  // Cap lists and searches at MaxResults items, see Api.MaxResults.  At most MaxResults+1 rows are loaded, 0 for no cap
+
+	LookupFields []string // Fields of T with unique values to find items by at path/by/<field>/:value, e.g. Email.  More than one match is 409
+
+	UpsertOnPut bool // PUT to a missing key creates the item at that key with 201, if Create is enabled
+
+	SerializeMutations bool // Run PUT, PATCH and DELETE for the same key one at a time, see Api.SerializeMutations
+	MethodOverride     bool // Handle a POST to an item with X-HTTP-Method-Override: PUT, PATCH or DELETE as that method
+	AllowBulkDelete    bool // Expose POST /deleteWhere, deleting the rows matching a filter by their keys in one transaction, see Api.AllowBulkDelete
+	AllowBulkUpdate    bool // Expose POST /updateWhere, patching the rows matching a filter in one transaction, see Api.AllowBulkUpdate
+
+	Stream bool // Stream GET / row by row rather than loading every row, associations are not loaded for the streamed list
+
+	// Preloads are the associations finds, lists and searches preload, including nested associations such as "Orders.Items".
+	// nil preloads every association of T, empty preloads none.  The children of a `rest:"child"` field that isn't preloaded
+	// are loaded when a child route, ?expand= or a clone needs them, but are empty in a Dto that exposes them.
+	// The nested associations of a child are also preloaded by its routes, so path/:id/orders has the Items of each order.
+	// Each association is one more query per find or page, whether or not the Dto exposes it, and a list loads every
+	// row of each association of the page, so only preload what the responses use.
+	Preloads []string
+
+	NoPreload bool // Preload no associations, as an empty Preloads, for wide schemas where the reads only need the row
+
+	// ChildDtos are the Dto types of the `rest:"child"` fields by field name, e.g. {"Children": ChildDto{}}.
+	// The fields of each child are copied to the identically named fields of its Dto as they are for D, so the child routes
+	// leave out foreign keys and other columns the Dto doesn't have.  Children without one use the Dto of RegisterDto.
+	ChildDtos map[string]any
+
+	BodyTypes          []string // Content types accepted for request bodies, defaults to JSON, XML and MessagePack
+	LenientContentType bool     // Treat a body without a content type as JSON rather than 415
+
+	Subscriptions bool // Expose GET /ws, a websocket sending each change made through the api
+
+	Middleware  []fiber.Handler                                                            // Run in order before every handler of the api, and so before the Validator
+	RateLimiter func(c *fiber.Ctx, action Action) (allowed bool, retryAfter time.Duration) // Allows each request before the Validator, see Api.RateLimiter
+
+	Logger     Logger                            // Logs errors and warnings for the api, defaults to the Logger set with SetLogger
+	LogRequest func(RequestRecord)               // Called once for each request handled by the api, see SlogRequests
+	Metrics    Metrics                           // Observes the status and latency of each request handled by the api
+	OnPanic    func(c *fiber.Ctx, recovered any) // Called when a handler panics, the request gets a 500
+
+	ErrorHandler func(c *fiber.Ctx, status int, err error) error // Sends the error responses of the api, see Api.ErrorHandler
+
+	Redact         func(c *fiber.Ctx, action Action, dto D) D // Changes the Jdo of an item before it is sent, see Api.Redact
+	OmitZeroFields bool                                       // Leave the zero valued fields of a Jdo out of responses
+
+	FieldNaming FieldNaming // Rename the Dto fields without a json tag name in JSON, query filters, sort and fields, e.g. to camelCase
+
+	Serialize   func(c *fiber.Ctx, v any) ([]byte, string, error) // Encodes the successful responses of the api, see Api.Serialize
+	JSONEncoder utils.JSONMarshal                                 // Encodes the JSON of the api in place of the app's JSONEncoder, see Api.JSONEncoder
+	JSONDecoder utils.JSONUnmarshal                               // Decodes the JSON bodies of the api in place of the app's JSONDecoder
 }
 
 // DefaultOptions returns a basic configuration allowing all rest operations and with no authentication
@@ -65,167 +180,1135 @@ func DefaultOptions[T any, D any]() Options[T, D] {
 // Internal implementation
 type grest[T any, D any] struct {
 	Options[T, D]
-	emptyT T // Empty template of T
-	emptyD D // Empty template of D
-	dMap   dtoMap
-	db     *gorm.DB
+	emptyT  T // Empty template of T
+	emptyD  D // Empty template of D
+	dMap    dtoMap
+	db      *gorm.DB
+	schema  *schema.Schema               // GORM schema of T used for column lookups
+	likes   []likeField                  // The string fields of D matched as substrings in filters
+	selects []string                     // The columns lists and searches select, nil to select them all
+	keys    []string                     // The columns findKey selects, the keys and those referenced by the children
+	orders  map[int]clause.OrderByColumn // The orders of the children tagged `rest:"child,order=..."`, by field
+	dtos    map[int]func(child any) any  // The Dto transformations of the children with ChildDtos, by field
+
+	reserved []string // The keys reserved by the api routes, create rejects them
 }
 
 // RegisterApi exposes an api underneath the app route using path and exposing objects of T.
 // Objets of T are managed in db using GORM including mutations as enabled in Options.
 // There must be a single string key field in the T option exposed as the tag `rest:"key"`.
+// Several fields tagged `rest:"key"` are a composite key, served as path/:id/:id2 with a segment for each in declaration order,
+// see Api.KeyParts.  Create requires every part of the key.
 // Child objects can be exposed either directly in the json by making them present in the Dto type or
 // as sub-paths exposed as path/:id/field if specified using the tag `rest:"child"`.  If exposed as child paths
-// the child objects are read only.  If exposed in the json then they will be part of the GORM mutation actions.
-func RegisterApi[T any, D any](app fiber.Router, db *gorm.DB, path string, options Options[T, D]) {
+// children can be added and removed when Mutate is enabled, but not edited.  Fields of the children tagged
+// `rest:"child"` are exposed beneath each child as path/:id/field/:childId/field.
+// The child routes find the item with only its keys and query the children directly, rather than preloading them.
+// Children are listed by primary key, or as tagged with `rest:"child,order=<field> [asc|desc]"`, e.g. `rest:"child,order=ID desc"`.
+// The sub-path of a child is its lower case field name, or as tagged with `rest:"child,path=<path>"`, e.g. `rest:"child,path=employees"`.
+// If exposed in the json then they will be part of the GORM mutation actions.
+// Create rejects keys reserved by the routes of the api, e.g. "count", with 422, see Registration.Reserved.
+// If T has an auto update time, e.g. gorm.Model's UpdatedAt, GET path/?updated_after= lists the items updated since, see Api.FindSince.
+// Lists and searches select only the columns of D, with the keys, when D has fewer fields than T has columns and none are children.
+// It returns ErrInvalidApi if T and D can't be mapped, or their schema can't be parsed, and ErrDuplicatePath as RegisterAPI.
+// See MustRegisterApi to panic instead.
+func RegisterApi[T any, D any](app fiber.Router, db *gorm.DB, path string, options Options[T, D]) (*Registration, error) {
 	// Create the implementation
 	impl := grest[T, D]{
 		Options: options,
 		db:      db,
 	}
 
-	// One off reflection of the types to create the field mappings.
-	// They are stored in the impl.dMap.links as a tuple.  [0] is the dto field and [1] is the source field.
-	// This reflection also finds the key and child tags.
-	impl.dMap = buildDtoMap[T, D](impl.emptyT, impl.emptyD)
+	// One off reflection of the types to create the field mappings.
+	// They are stored in the impl.dMap.links as a tuple.  [0] is the dto field and [1] is the source field.
+	// This reflection also finds the key and child tags.
+	var err error
+	impl.dMap, err = buildDtoMap[T, D](impl.emptyT, impl.emptyD)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidApi, path, err)
+	}
+
+	// Parse the GORM schema so DTO field names can be translated to columns.
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&impl.emptyT); err != nil {
+		return nil, fmt.Errorf("%w: unable to parse schema for %s: %v", ErrInvalidApi, impl.dMap.tT.Name(), err)
+	}
+	impl.schema = stmt.Schema
+	impl.likes = impl.likeFields()
+	impl.selects = impl.selectColumns()
+	impl.keys = impl.keyColumns()
+	impl.orders = map[int]clause.OrderByColumn{}
+	for c, spec := range impl.dMap.childOrders {
+		if impl.orders[c], err = childOrder(db, impl.dMap.tT.Field(c), spec); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidApi, path, err)
+		}
+	}
+	for _, name := range options.LookupFields {
+		if field := impl.schema.LookUpField(name); field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("%w: %s: lookup field %s is not a column of %s", ErrInvalidApi, path, name, impl.dMap.tT.Name())
+		}
+	}
+	if options.NoPreload && len(options.Preloads) > 0 {
+		return nil, fmt.Errorf("%w: %s: NoPreload can't have Preloads", ErrInvalidApi, path)
+	}
+	for _, name := range options.Preloads {
+		if first, _, _ := strings.Cut(name, "."); impl.schema.Relationships.Relations[first] == nil {
+			return nil, fmt.Errorf("%w: %s: preload %s is not an association of %s", ErrInvalidApi, path, name, impl.dMap.tT.Name())
+		}
+	}
+	if impl.dtos, err = impl.childDtos(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidApi, path, err)
+	}
+	if options.CursorPaging && options.DefaultOrder != "" {
+		return nil, fmt.Errorf("%w: %s: cursor paging orders by the keys so can't have a DefaultOrder", ErrInvalidApi, path)
+	}
+
+	// Create the grest struct, assuming all the features are exposed.
+	fullApi := Api[T, D]{
+		Path:           path,
+		SubEntities:    []SubEntity[T, D]{},
+		Validator:      impl.Validator,
+		Dto:            impl.copyToDto,
+		QueryFilter:    options.QueryFilter,
+		Key:            impl.key,
+		CreatedStatus:  options.CreatedStatus,
+		DeleteResponse: options.DeleteResponse,
+		OnChange:       options.OnChange,
+		Envelope:       options.Envelope,
+		IncludeLinks:   options.IncludeLinks,
+		StrictBody:     options.StrictBody,
+		ValidateDto:    options.ValidateDto,
+		TransformIn:    options.TransformIn,
+		TransformOut:   options.TransformOut,
+		ValidateRoutes: options.ValidateRoutes,
+		Clone:          options.Clone,
+		CustomActions:  options.CustomActions,
+		UpsertOnPut:    options.UpsertOnPut,
+		BodyTypes:      options.BodyTypes,
+		SetKey:         impl.setDtoKey,
+
+		LenientContentType: options.LenientContentType,
+		SearchableFields:   options.SearchableFields,
+		SortableFields:     options.SortableFields,
+		Validators:         options.Validators,
+		MaxResults:         options.MaxResults,
+		MethodOverride:     options.MethodOverride,
+		AllowBulkDelete:    options.AllowBulkDelete,
+		AllowBulkUpdate:    options.AllowBulkUpdate,
+		SerializeMutations: options.SerializeMutations,
+		TotalHeader:        options.TotalHeader,
+		AccessValidator:    options.AccessValidator,
+		ValidatorE:         options.ValidatorE,
+		ValidatorStatus:    options.ValidatorStatus,
+		ValidatorD:         options.ValidatorD,
+		Subscriptions:      options.Subscriptions,
+		Middleware:         options.Middleware,
+		RateLimiter:        options.RateLimiter,
+		Logger:             options.Logger,
+		LogRequest:         options.LogRequest,
+		Metrics:            options.Metrics,
+		OnPanic:            options.OnPanic,
+		ErrorHandler:       options.ErrorHandler,
+		Redact:             options.Redact,
+		OmitZeroFields:     options.OmitZeroFields,
+		FieldNaming:        options.FieldNaming,
+		Serialize:          options.Serialize,
+		JSONEncoder:        options.JSONEncoder,
+		JSONDecoder:        options.JSONDecoder,
+		// The data functions take the request context so queries are cancelled with the request
+		ops: ops[T, D]{
+			find:                 impl.finder,
+			findShallow:          impl.findShallow,
+			findKey:              impl.findKey,
+			findAll:              impl.findAll,
+			findPage:             impl.findPage,
+			search:               impl.search,
+			findSorted:           impl.findSorted,
+			searchSorted:         impl.searchSorted,
+			searchPage:           impl.searchPage,
+			searchAdvancedSorted: impl.searchAdvancedSorted,
+			searchAdvanced:       impl.searchAdvanced,
+			countAdvanced:        impl.countAdvanced,
+			count:                impl.count,
+			mutate:               impl.mutate,
+			patch:                impl.patch,
+			create:               impl.create,
+			delete:               impl.delete,
+			deleteAll:            impl.deleteAll,
+			updateAll:            impl.updateAll,
+		},
+	}
+	for _, name := range options.LookupFields {
+		fullApi.Lookups = append(fullApi.Lookups, Lookup[T]{Field: name, Find: impl.lookup(name)})
+	}
+
+	// Several fields tagged `rest:"key"` are a composite key with a path segment each
+	if len(impl.dMap.objKeys) > 1 {
+		fullApi.KeyParts = len(impl.dMap.objKeys)
+	}
+	// Use the auto update timestamp, e.g. gorm.Model's UpdatedAt, as the version if there is one,
+	// and to find the items updated since a time
+	if impl.updatedAt() != nil {
+		fullApi.Version = impl.version
+		fullApi.ops.findSince = impl.findSince
+	}
+
+	if options.Stream {
+		fullApi.ops.iterate = impl.iterate
+	}
+
+	if options.CursorPaging {
+		fullApi.ops.cursor = impl.cursor
+		fullApi.ops.findAfter = impl.findAfter
+	}
+
+	if options.ZeroValueFilters {
+		fullApi.ops.searchMap = impl.searchMap
+		fullApi.ops.searchMapSorted = impl.searchMapSorted
+		fullApi.ops.countMap = impl.countMap
+	}
+
+	// Remove any disabled options
+	if !options.Delete {
+		fullApi.ops.delete = nil
+		fullApi.ops.deleteAll = nil
+	}
+	if !options.Mutate {
+		fullApi.ops.mutate = nil
+		fullApi.ops.patch = nil
+		fullApi.ops.updateAll = nil
+	}
+	if options.CloneChildren {
+		fullApi.ops.clone = impl.clone
+	}
+	if !options.Create {
+		fullApi.ops.create = nil
+		fullApi.ops.clone = nil
+	}
+
+	// Create the API child maps
+	for _, c := range impl.dMap.children {
+		fullApi.SubEntities = append(fullApi.SubEntities, SubEntity[T, D]{
+			SubPath: impl.dMap.childPaths[c],
+			GetCtx:  impl.children(c),
+			Dto:     impl.childDto(c),
+			Key:     childKey(db, childElem(impl.dMap.tT.Field(c).Type)),
+			GetPage: impl.childPage(c),
+			GetOne:  impl.childGet(c),
+
+			SubEntities: nestedChildren(db, childElem(impl.dMap.tT.Field(c).Type), map[reflect.Type]bool{impl.dMap.tT: true}, options.Logger),
+		})
+		// Children can be added and removed through the association if the item can be mutated
+		if options.Mutate {
+			sub := &fullApi.SubEntities[len(fullApi.SubEntities)-1]
+			sub.Add = impl.childAdd(c)
+			sub.Remove = impl.childRemove(c)
+		}
+	}
+
+	// Children of type T exposed by other APIs use the same Dto
+	if impl.dMap.tT != impl.dMap.dT {
+		registerDto(impl.dMap.tT, func(child any) any { return impl.copyToDto(child.(T)) }, false)
+	}
+
+	// Finally register the API with Fiber
+	reg, err := RegisterAPI(app, fullApi)
+	if err == nil {
+		impl.reserved = reg.Reserved
+	}
+	return reg, err
+}
+
+// MustRegisterApi is RegisterApi, panicking if the api can't be registered
+func MustRegisterApi[T any, D any](app fiber.Router, db *gorm.DB, path string, options Options[T, D]) *Registration {
+	reg, err := RegisterApi(app, db, path, options)
+	if err != nil {
+		panic(err)
+	}
+	return reg
+}
+
+// finder for single items.
+// Makes used of the gorm Find() function passing in a template object that has just the key set.
+func (a *grest[T, D]) finder(ctx context.Context, key string) (T, bool, error) {
+	return a.find(ctx, key, true)
+}
+
+// findShallow finds a single item without preloading its associations
+func (a *grest[T, D]) findShallow(ctx context.Context, key string) (T, bool, error) {
+	return a.find(ctx, key, false)
+}
+
+// findKey finds a single item with only its key columns, and those its children reference, to check it exists and query its children
+func (a *grest[T, D]) findKey(ctx context.Context, key string) (T, bool, error) {
+	item, err := a.emptyWithKey(key)
+	if err != nil {
+		return item, false, nil
+	}
+	tx := a.db.WithContext(ctx).Select(a.keys).Limit(1).Find(&item, &item)
+	if tx.Error != nil {
+		return a.emptyT, false, wrapGormError(tx.Error)
+	}
+	if tx.RowsAffected != 1 {
+		return a.emptyT, false, nil
+	}
+	return item, true, nil
+}
+
+// keyColumns returns the primary and key columns of T, and the columns of T referenced by the associations of its children
+func (a *grest[T, D]) keyColumns() []string {
+	var columns []string
+	seen := map[string]bool{}
+	add := func(field *schema.Field) {
+		if field != nil && field.Schema == a.schema && field.DBName != "" && !seen[field.DBName] {
+			seen[field.DBName] = true
+			columns = append(columns, field.DBName)
+		}
+	}
+	for _, field := range a.schema.PrimaryFields {
+		add(field)
+	}
+	for _, index := range a.dMap.objKeys {
+		add(a.schema.LookUpField(a.dMap.tT.FieldByIndex(index).Name))
+	}
+	for _, c := range a.dMap.children {
+		if rel := a.schema.Relationships.Relations[a.dMap.tT.Field(c).Name]; rel != nil {
+			for _, ref := range rel.References {
+				add(ref.PrimaryKey)
+				add(ref.ForeignKey)
+			}
+		}
+	}
+	return columns
+}
+
+// find a single item, preloading joined tables if preload is set
+func (a *grest[T, D]) find(ctx context.Context, key string, preload bool) (T, bool, error) {
+	// Create the template item
+	item, err := a.emptyWithKey(key)
+	if err != nil {
+		return item, false, nil
+	}
+	// Find it.
+	// Preload joined tables so that the object is fully populated.
+	tx := a.db.WithContext(ctx)
+	if preload {
+		tx = a.preload(tx)
+	}
+	tx = tx.Limit(1).Find(&item, &item)
+
+	// Return the result or error
+	if tx.Error != nil {
+		return a.emptyT, false, wrapGormError(tx.Error)
+	}
+	if tx.RowsAffected != 1 {
+		return a.emptyT, false, nil
+	}
+	return item, true, nil
+}
+
+// lookup supplies a function to find the items with a value of the field name, at most 2 so a duplicate is found.
+// The query is made from a template T as for find, with the field selected so a zero value is matched too.
+func (a *grest[T, D]) lookup(name string) func(ctx context.Context, value string) ([]T, error) {
+	field := a.schema.LookUpField(name)
+	return func(ctx context.Context, value string) ([]T, error) {
+		template := a.emptyT
+		if err := setFromString(reflect.Indirect(reflect.ValueOf(&template)).FieldByIndex(field.StructField.Index), value); err != nil {
+			return nil, nil
+		}
+		var items []T
+		err := a.preload(a.db.WithContext(ctx)).Where(&template, field.Name).Limit(2).Find(&items).Error
+		return items, wrapGormError(err)
+	}
+}
+
+// emptyWithKey creates an empty template of T filling in only the key fields.
+func (a *grest[T, D]) emptyWithKey(key string) (T, error) {
+	// Start with our fully empty T
+	item := a.emptyT
+
+	// And set our key fields, selecting the appropriate type
+	if err := a.setKeys(reflect.Indirect(reflect.ValueOf(&item)), a.dMap.objKeys, key); err != nil {
+		return a.emptyT, err
+	}
+	return item, nil
+}
+
+// setDtoKey sets the key fields of an incoming Dto, used when PUT creates an item
+func (a *grest[T, D]) setDtoKey(dto *D, key string) error {
+	return a.setKeys(reflect.ValueOf(dto).Elem(), a.dMap.dtoKeys, key)
+}
+
+// setKeys sets the key fields of val from key, splitting a composite key into its parts
+func (a *grest[T, D]) setKeys(val reflect.Value, keys [][]int, key string) error {
+	parts := []string{key}
+	if len(keys) > 1 {
+		var err error
+		if parts, err = SplitKey(key); err != nil {
+			return fmt.Errorf("%w: %w", ErrValidation, err)
+		}
+		if len(parts) != len(keys) {
+			return fmt.Errorf("%w: key %s does not have %d parts", ErrValidation, key, len(keys))
+		}
+	}
+	for i, index := range keys {
+		valDest := val.FieldByIndex(index)
+		if !valDest.CanSet() {
+			panic(fmt.Sprintf("key field '%s' is not settable", val.Type().FieldByIndex(index).Name))
+		}
+		if err := setKeyValue(valDest, parts[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setKeyValue sets a key field from its string form, selecting the appropriate type
+func setKeyValue(valDest reflect.Value, key string) error {
+	switch {
+	case valDest.CanInt():
+		k, err := strconv.Atoi(key)
+		if err != nil {
+			return fmt.Errorf("%w: key value %s is not an int", ErrValidation, key)
+		}
+		valDest.SetInt(int64(k))
+	case valDest.CanUint():
+		k, err := strconv.Atoi(key)
+		if err != nil {
+			return fmt.Errorf("%w: key value %s is not a uint", ErrValidation, key)
+		}
+		valDest.SetUint(uint64(k))
+	default:
+		valDest.SetString(key)
+	}
+	return nil
+}
+
+// findAll returns all the objects of T as a slice
+func (a *grest[T, D]) findAll(ctx context.Context) ([]T, error) {
+	var all []T
+	err := a.limit(a.defaultOrder(a.list(ctx))).Find(&all).Error
+	return all, wrapGormError(err)
+}
+
+// defaultOrder orders a query by DefaultOrder, or by the key columns, so lists have a stable order
+func (a *grest[T, D]) defaultOrder(tx *gorm.DB) *gorm.DB {
+	if a.DefaultOrder != "" {
+		return tx.Order(a.DefaultOrder)
+	}
+	for _, index := range a.dMap.objKeys {
+		if field := a.schema.LookUpField(a.dMap.tT.FieldByIndex(index).Name); field != nil && field.DBName != "" {
+			tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}})
+		}
+	}
+	return tx
+}
+
+// list starts a query of lists and searches, selecting only the columns of D if it can and preloading the Preloads
+func (a *grest[T, D]) list(ctx context.Context) *gorm.DB {
+	return a.preload(a.selected(a.db.WithContext(ctx)))
+}
+
+// preload preloads the Preloads, or every association if they are nil and NoPreload isn't set
+func (a *grest[T, D]) preload(tx *gorm.DB) *gorm.DB {
+	if a.Preloads == nil && !a.NoPreload {
+		tx = tx.Preload(clause.Associations)
+	}
+	for _, name := range a.Preloads {
+		tx = tx.Preload(name)
+	}
+	// Preloaded children with an order are preloaded in that order
+	for c, order := range a.orders {
+		if name := a.dMap.tT.Field(c).Name; a.preloaded(name) {
+			tx = tx.Preload(name, orderBy(order))
+		}
+	}
+	return tx
+}
+
+// nestedPreloads returns the Preloads beneath the association name, e.g. "Location" for "Employees.Location" beneath "Employees"
+func (a *grest[T, D]) nestedPreloads(name string) []string {
+	var nested []string
+	for _, p := range a.Preloads {
+		if strings.HasPrefix(p, name+".") {
+			nested = append(nested, p[len(name)+1:])
+		}
+	}
+	return nested
+}
+
+// preloaded reports if the association name is preloaded, by itself or as part of a nested association
+func (a *grest[T, D]) preloaded(name string) bool {
+	if a.Preloads == nil && !a.NoPreload {
+		return true
+	}
+	for _, p := range a.Preloads {
+		if p == name || strings.HasPrefix(p, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// selected selects only the selects columns if there are any
+func (a *grest[T, D]) selected(tx *gorm.DB) *gorm.DB {
+	if a.selects != nil {
+		return tx.Select(a.selects)
+	}
+	return tx
+}
+
+// selectColumns returns the columns needed to fill in D when it has fewer fields than T has columns, nil to select them all.
+// These are the columns of the fields of D, the primary and key columns so associations and links can be found,
+// and the auto update time used as the version.  Every column is selected if D has a field that isn't a column,
+// such as a child or an embedded struct, or if a bulk update or delete could save or delete the items found.
+func (a *grest[T, D]) selectColumns() []string {
+	if a.dMap.tT == a.dMap.dT || a.AllowBulkUpdate || a.AllowBulkDelete {
+		return nil
+	}
+	var columns []string
+	seen := map[string]bool{}
+	add := func(field *schema.Field) {
+		if !seen[field.DBName] {
+			seen[field.DBName] = true
+			columns = append(columns, field.DBName)
+		}
+	}
+	for i := 0; i < a.dMap.dT.NumField(); i++ {
+		dF := a.dMap.dT.Field(i)
+		if !dF.IsExported() || dF.Tag.Get("json") == "-" {
+			continue
+		}
+		field := a.schema.LookUpField(dF.Name)
+		if dF.Anonymous || field == nil || field.DBName == "" {
+			return nil
+		}
+		add(field)
+	}
+	for _, field := range a.schema.PrimaryFields {
+		add(field)
+	}
+	for _, index := range a.dMap.objKeys {
+		field := a.schema.LookUpField(a.dMap.tT.FieldByIndex(index).Name)
+		if field == nil || field.DBName == "" {
+			return nil
+		}
+		add(field)
+	}
+	if field := a.updatedAt(); field != nil {
+		add(field)
+	}
+	if len(columns) >= len(a.schema.DBNames) {
+		return nil
+	}
+	return columns
+}
+
+// findSince returns the T updated after since, matching the filter if there is one
+func (a *grest[T, D]) findSince(ctx context.Context, since time.Time, filter *D) ([]T, error) {
+	tx := a.list(ctx).
+		Where(clause.Gt{Column: clause.Column{Table: clause.CurrentTable, Name: a.updatedAt().DBName}, Value: since})
+	if filter != nil {
+		tx = a.where(tx, *filter)
+	}
+	var all []T
+	err := a.limit(a.defaultOrder(tx)).Find(&all).Error
+	return all, wrapGormError(err)
+}
+
+// likeField is a string field of D matched as a substring in filters, with its column
+type likeField struct {
+	fieldLink
+	column string
+}
+
+// likeFields finds the string fields of D matched as substrings, every one with PartialStringMatch
+// or those tagged `rest:"search=contains"` on T
+func (a *grest[T, D]) likeFields() []likeField {
+	var likes []likeField
+	for _, link := range a.dMap.links {
+		tF := a.dMap.tT.FieldByIndex(link.tField)
+		if tF.Type.Kind() != reflect.String {
+			continue
+		}
+		if !a.PartialStringMatch && restTagValue(tF.Tag.Get("rest"), "search") != "contains" {
+			continue
+		}
+		if field := a.schema.LookUpField(tF.Name); field != nil && field.DBName != "" {
+			likes = append(likes, likeField{fieldLink: link, column: field.DBName})
+		}
+	}
+	return likes
+}
+
+// where adds the conditions of a filter to tx.  The non-zero fields are matched exactly, as gorm does for a struct,
+// except the like fields which are matched as case-insensitive substrings.  The values are always bound parameters.
+func (a *grest[T, D]) where(tx *gorm.DB, filter D) *gorm.DB {
+	tFilter := a.copyFromDto(a.emptyT, filter)
+	valT := reflect.ValueOf(&tFilter).Elem()
+	valD := reflect.ValueOf(filter)
+	for _, f := range a.likes {
+		value := valD.FieldByIndex(f.dField).String()
+		if value == "" {
+			continue
+		}
+		// Cleared so the struct condition doesn't also match it exactly
+		valT.FieldByIndex(f.tField).SetString("")
+		tx = tx.Where(a.like(f.column, value))
+	}
+	return tx.Where(&tFilter)
+}
+
+// likeEscaper escapes the LIKE wildcards in a value so they match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// like is a case-insensitive substring match of column with value, ILIKE on postgres and LIKE on a lower cased column elsewhere
+func (a *grest[T, D]) like(column string, value string) clause.Expression {
+	col := clause.Column{Table: clause.CurrentTable, Name: column}
+	pattern := "%" + likeEscaper.Replace(value) + "%"
+	switch a.db.Dialector.Name() {
+	case "postgres":
+		return clause.Expr{SQL: `? ILIKE ?`, Vars: []any{col, pattern}}
+	case "mysql":
+		// Backslash is already the escape character, and can't be written as a plain string literal
+		return clause.Expr{SQL: "LOWER(?) LIKE ?", Vars: []any{col, strings.ToLower(pattern)}}
+	}
+	return clause.Expr{SQL: `LOWER(?) LIKE ? ESCAPE '\'`, Vars: []any{col, strings.ToLower(pattern)}}
+}
+
+// limit loads no more than MaxResults+1 rows, enough to tell a list is truncated
+func (a *grest[T, D]) limit(tx *gorm.DB) *gorm.DB {
+	if a.MaxResults > 0 {
+		return tx.Limit(a.MaxResults + 1)
+	}
+	return tx
+}
+
+// iterate scans every item row by row from a cursor, stopping early if yield returns false
+func (a *grest[T, D]) iterate(ctx context.Context, yield func(T) bool) error {
+	tx := a.db.WithContext(ctx)
+	rows, err := a.defaultOrder(a.selected(tx.Model(&a.emptyT))).Rows()
+	if err != nil {
+		return wrapGormError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item T
+		if err := tx.ScanRows(rows, &item); err != nil {
+			return wrapGormError(err)
+		}
+		if !yield(item) {
+			break
+		}
+	}
+	return wrapGormError(rows.Err())
+}
+
+// search uses the D as a filter, providing it as a mask to the gorm find function
+func (a *grest[T, D]) search(ctx context.Context, filter D) ([]T, error) {
+	var all []T
+	err := a.limit(a.defaultOrder(a.where(a.list(ctx), filter))).Find(&all).Error
+	return all, wrapGormError(err)
+}
+
+// findPage returns a page of T in the default order, so the pages don't overlap, limit 0 means no limit
+func (a *grest[T, D]) findPage(ctx context.Context, limit int, offset int) ([]T, error) {
+	return a.findSorted(ctx, nil, limit, offset)
+}
+
+// findSorted returns a page of T ordered by the sort fields using ORDER BY, limit 0 means no limit
+func (a *grest[T, D]) findSorted(ctx context.Context, fields []SortField, limit int, offset int) ([]T, error) {
+	var all []T
+	err := a.page(a.order(a.list(ctx), fields), limit, offset).Find(&all).Error
+	return all, wrapGormError(err)
+}
+
+// searchPage returns a page of the search ordered by the sort fields, limit 0 means no limit.
+// The total is counted separately by count with the same filter.
+func (a *grest[T, D]) searchPage(ctx context.Context, filter D, fields []SortField, limit int, offset int) ([]T, error) {
+	var all []T
+	err := a.page(a.order(a.where(a.list(ctx), filter), fields), limit, offset).Find(&all).Error
+	return all, wrapGormError(err)
+}
+
+// keyset returns the fields a page is ordered by, the fields of the sort fields with a column and then the keys, and if each is descending
+func (a *grest[T, D]) keyset(sort []SortField) ([]*schema.Field, []bool) {
+	var fields []*schema.Field
+	var desc []bool
+	for _, f := range sort {
+		if _, ok := a.fieldColumn(f.Field); ok {
+			fields = append(fields, a.schema.LookUpField(f.Field))
+			desc = append(desc, f.Desc)
+		}
+	}
+	for _, index := range a.dMap.objKeys {
+		if field := a.schema.LookUpField(a.dMap.tT.FieldByIndex(index).Name); field != nil && field.DBName != "" {
+			fields = append(fields, field)
+			desc = append(desc, false)
+		}
+	}
+	return fields, desc
+}
+
+// cursor returns the values of the keyset of the sort fields of item, the position in the list that the next page starts after
+func (a *grest[T, D]) cursor(item T, sort []SortField) []any {
+	fields, _ := a.keyset(sort)
+	val := reflect.ValueOf(item)
+	values := make([]any, 0, len(fields))
+	for _, field := range fields {
+		v, _ := field.ValueOf(context.Background(), val)
+		values = append(values, v)
+	}
+	return values
+}
+
+// findAfter returns a page of T ordered by the sort fields, starting after the cursor values of the keyset, limit 0 means no limit.
+// For the keyset (a, b) it is WHERE (a > ? OR a = ? AND b > ?), with < for descending fields, so mixed directions can be paged.
+func (a *grest[T, D]) findAfter(ctx context.Context, filter *D, sort []SortField, after []json.RawMessage, limit int) ([]T, error) {
+	fields, desc := a.keyset(sort)
+	if len(after) != len(fields) {
+		return nil, fmt.Errorf("%w, expected %d values", errInvalidCursor, len(fields))
+	}
+	values := make([]any, 0, len(fields))
+	for i, field := range fields {
+		v := reflect.New(field.FieldType)
+		if err := json.Unmarshal(after[i], v.Interface()); err != nil {
+			return nil, fmt.Errorf("%w, %s: %v", errInvalidCursor, field.Name, err)
+		}
+		values = append(values, v.Elem().Interface())
+	}
+	var ors []clause.Expression
+	for i, field := range fields {
+		var ands []clause.Expression
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: fields[j].DBName}, Value: values[j]})
+		}
+		column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+		if desc[i] {
+			ands = append(ands, clause.Lt{Column: column, Value: values[i]})
+		} else {
+			ands = append(ands, clause.Gt{Column: column, Value: values[i]})
+		}
+		ors = append(ors, clause.And(ands...))
+	}
+	tx := a.list(ctx).Where(clause.Or(ors...))
+	if filter != nil {
+		tx = a.where(tx, *filter)
+	}
+	var all []T
+	err := a.page(a.order(tx, sort), limit, 0).Find(&all).Error
+	return all, wrapGormError(err)
+}
+
+// page adds the LIMIT and OFFSET of a page, limit 0 means no limit
+func (a *grest[T, D]) page(tx *gorm.DB, limit int, offset int) *gorm.DB {
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+	if offset > 0 {
+		tx = tx.Offset(offset)
+	}
+	return tx
+}
+
+// searchSorted is search with the results ordered by the sort fields
+func (a *grest[T, D]) searchSorted(ctx context.Context, filter D, fields []SortField) ([]T, error) {
+	var all []T
+	err := a.limit(a.order(a.where(a.list(ctx), filter), fields)).Find(&all).Error
+	return all, wrapGormError(err)
+}
+
+// searchAdvanced is search with a WHERE clause for each condition, the values are always bound parameters
+func (a *grest[T, D]) searchAdvanced(ctx context.Context, filter D, conditions []Condition) ([]T, error) {
+	return a.searchAdvancedSorted(ctx, filter, conditions, nil)
+}
+
+// searchAdvancedSorted is searchAdvanced with the results ordered by the sort fields
+func (a *grest[T, D]) searchAdvancedSorted(ctx context.Context, filter D, conditions []Condition, fields []SortField) ([]T, error) {
+	tx, err := a.whereConditions(a.list(ctx), filter, conditions)
+	if err != nil {
+		return nil, err
+	}
+	var all []T
+	err = a.limit(a.order(tx, fields)).Find(&all).Error
+	return all, wrapGormError(err)
+}
+
+// countAdvanced counts the T matching the filter and the conditions with a COUNT query, for the count route
+func (a *grest[T, D]) countAdvanced(ctx context.Context, filter D, conditions []Condition) (int64, error) {
+	tx, err := a.whereConditions(a.countQuery(ctx), filter, conditions)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	err = tx.Count(&n).Error
+	return n, wrapGormError(err)
+}
+
+// whereConditions adds the WHERE clause of the filter and a clause for each condition, the values are always bound parameters
+func (a *grest[T, D]) whereConditions(tx *gorm.DB, filter D, conditions []Condition) (*gorm.DB, error) {
+	tx = a.where(tx, filter)
+	for _, cond := range conditions {
+		expr, err := a.condition(cond)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where(expr)
+	}
+	return tx, nil
+}
+
+// searchMap is search with the fields given in a filter, by the name of the field of D.
+// Those with their zero value, which a D filter would ignore, are matched exactly.
+func (a *grest[T, D]) searchMap(ctx context.Context, fields map[string]any) ([]T, error) {
+	return a.searchMapSorted(ctx, fields, nil)
+}
+
+// searchMapSorted is searchMap with the results ordered by the sort fields
+func (a *grest[T, D]) searchMapSorted(ctx context.Context, fields map[string]any, sort []SortField) ([]T, error) {
+	tx, err := a.whereMap(a.list(ctx), fields)
+	if err != nil {
+		return nil, err
+	}
+	var all []T
+	err = a.limit(a.order(tx, sort)).Find(&all).Error
+	return all, wrapGormError(err)
+}
+
+// countMap counts the T matching the fields given in a filter with a COUNT query, for the count route
+func (a *grest[T, D]) countMap(ctx context.Context, fields map[string]any) (int64, error) {
+	tx, err := a.whereMap(a.countQuery(ctx), fields)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	err = tx.Count(&n).Error
+	return n, wrapGormError(err)
+}
+
+// whereMap adds the WHERE clause of the fields given in a filter, matching those with their zero value exactly
+func (a *grest[T, D]) whereMap(tx *gorm.DB, fields map[string]any) (*gorm.DB, error) {
+	var filter D
+	valFilter := reflect.ValueOf(&filter).Elem()
+	var zeros []clause.Expression
+	for name, value := range fields {
+		column, ok := a.fieldColumn(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: field %s has no column", ErrValidation, name)
+		}
+		v := reflect.ValueOf(value)
+		if v.IsZero() {
+			zeros = append(zeros, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: value})
+			continue
+		}
+		f := valFilter.FieldByName(name)
+		if v.Type() != f.Type() {
+			return nil, fmt.Errorf("%w: field %s is a %s not %s", ErrValidation, name, f.Type(), v.Type())
+		}
+		f.Set(v)
+	}
+	tx = a.where(tx, filter)
+	if len(zeros) > 0 {
+		tx = tx.Where(clause.And(zeros...))
+	}
+	return tx, nil
+}
+
+// condition translates a Condition into a clause on the column of its field
+func (a *grest[T, D]) condition(cond Condition) (clause.Expression, error) {
+	name, ok := a.fieldColumn(cond.Field)
+	if !ok {
+		return nil, fmt.Errorf("%w: field %s has no column", ErrValidation, cond.Field)
+	}
+	column := clause.Column{Table: clause.CurrentTable, Name: name}
+	switch {
+	case cond.Op == OpIn && len(cond.Values) > 0:
+		return clause.IN{Column: column, Values: cond.Values}, nil
+	case cond.Op == OpBetween && len(cond.Values) == 2:
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []any{column, cond.Values[0], cond.Values[1]}}, nil
+	case len(cond.Values) != 1:
+	case cond.Op == OpGt:
+		return clause.Gt{Column: column, Value: cond.Values[0]}, nil
+	case cond.Op == OpGte:
+		return clause.Gte{Column: column, Value: cond.Values[0]}, nil
+	case cond.Op == OpLt:
+		return clause.Lt{Column: column, Value: cond.Values[0]}, nil
+	case cond.Op == OpLte:
+		return clause.Lte{Column: column, Value: cond.Values[0]}, nil
+	}
+	return nil, fmt.Errorf("%w: invalid condition %s %s with %d values", ErrValidation, cond.Field, cond.Op, len(cond.Values))
+}
+
+// order adds an ORDER BY for each sort field, translating the DTO field name into its column name.
+// Fields without a column are ignored.  Ties are ordered by the default order.
+func (a *grest[T, D]) order(tx *gorm.DB, fields []SortField) *gorm.DB {
+	for _, f := range fields {
+		column, ok := a.fieldColumn(f.Field)
+		if !ok {
+			continue
+		}
+		tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Desc: f.Desc})
+	}
+	return a.defaultOrder(tx)
+}
+
+// fieldColumn returns the column of the field of T matching the named field of D, including the promoted gorm.Model fields.
+// It is false for names that are not json visible fields of D, such as fields only on T, and for fields without a column.
+func (a *grest[T, D]) fieldColumn(name string) (string, bool) {
+	dF, ok := a.dMap.dT.FieldByName(name)
+	if !ok || dF.Tag.Get("json") == "-" {
+		return "", false
+	}
+	tF, ok := a.dMap.tT.FieldByName(dF.Name)
+	if !ok {
+		return "", false
+	}
+	field := a.schema.LookUpField(tF.Name)
+	if field == nil || field.DBName == "" {
+		return "", false
+	}
+	return field.DBName, true
+}
+
+// count uses a COUNT query to count all T, or those matching the filter
+func (a *grest[T, D]) count(ctx context.Context, filter *D) (int64, error) {
+	var n int64
+	var item T
+	tx := a.db.WithContext(ctx).Model(&item)
+	if filter != nil {
+		tx = a.where(tx, *filter)
+	}
+	err := tx.Count(&n).Error
+	return n, wrapGormError(err)
+}
+
+// countQuery starts a COUNT for the count route, without the associations and including the soft deleted rows if CountDeleted is set
+func (a *grest[T, D]) countQuery(ctx context.Context) *gorm.DB {
+	tx := a.db.WithContext(ctx).Model(&a.emptyT)
+	if a.CountDeleted {
+		tx = tx.Unscoped()
+	}
+	return tx
+}
+
+// mutate takes a Dto of type D and applies it to an existing object of T.
+// T is then persisted in the DB.
+func (a *grest[T, D]) mutate(ctx context.Context, orig T, edit D) (T, error) {
+	// Copy the dto
+	orig = a.copyFromDto(orig, edit)
+	// Save it to the database
+	err := a.db.WithContext(ctx).Save(&orig).Error
+	return orig, wrapGormError(err)
+}
+
+// patch applies only the supplied DTO fields to an existing T.
+// Only the matching columns (and any auto update timestamps) are written to the database.
+func (a *grest[T, D]) patch(ctx context.Context, orig T, fields map[string]any) (T, error) {
+	return a.patchWith(a.db.WithContext(ctx), orig, fields)
+}
 
-	// Create the grest struct, assuming all the features are exposed.
-	fullApi := Api[T, D]{
-		Path:        path,
-		Find:        impl.finder,
-		FindAll:     impl.findAll,
-		Search:      impl.search,
-		Mutate:      impl.mutate,
-		Create:      impl.create,
-		Delete:      impl.delete,
-		SubEntities: []SubEntity[T, D]{},
-		Validator:   impl.Validator,
-		Dto:         impl.copyToDto,
+// updateAll patches every item with the same fields in one transaction, none are updated if any fails
+func (a *grest[T, D]) updateAll(ctx context.Context, items []T, fields map[string]any) ([]T, error) {
+	updated := make([]T, 0, len(items))
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, item := range items {
+			item, err := a.patchWith(tx, item, fields)
+			if err != nil {
+				return err
+			}
+			updated = append(updated, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	// Remove any disabled options
-	if !options.Delete {
-		fullApi.Delete = nil
+	return updated, nil
+}
+
+// patchWith sets the fields on orig and saves just those columns, and any auto update time, through tx
+func (a *grest[T, D]) patchWith(tx *gorm.DB, orig T, fields map[string]any) (T, error) {
+	valObj := reflect.Indirect(reflect.ValueOf(&orig))
+	var columns []string
+	for name, value := range fields {
+		tF, ok := a.dMap.tT.FieldByName(name)
+		if !ok {
+			return orig, errors.New("unknown field " + name)
+		}
+		if err := assignJSON(valObj.FieldByIndex(tF.Index), value); err != nil {
+			return orig, err
+		}
+		if field := a.schema.LookUpField(name); field != nil && field.DBName != "" {
+			columns = append(columns, field.DBName)
+		}
 	}
-	if !options.Mutate {
-		fullApi.Mutate = nil
+	if len(columns) == 0 {
+		return orig, nil
 	}
-	if !options.Create {
-		fullApi.Create = nil
+	for _, field := range a.schema.Fields {
+		if field.AutoUpdateTime > 0 {
+			columns = append(columns, field.DBName)
+		}
 	}
+	err := tx.Model(&orig).Select(columns).Updates(&orig).Error
+	return orig, wrapGormError(err)
+}
 
-	// Create the API child maps
-	for _, c := range impl.dMap.children {
-		name := impl.dMap.tT.Field(c).Name
-		fullApi.SubEntities = append(fullApi.SubEntities, SubEntity[T, D]{
-			SubPath: strings.ToLower(name),
-			Get:     impl.children(c),
-		})
+// create inserts a new T built from a template T and D mutation + key field
+func (a *grest[T, D]) create(ctx context.Context, edit D) (T, error) {
+	return a.createFrom(ctx, edit, nil)
+}
+
+// clone inserts a new T as create, with copies of the has one and has many children of source.
+// The copies are saved with the new T, in its transaction.
+func (a *grest[T, D]) clone(ctx context.Context, source T, edit D) (T, error) {
+	copies := map[int]reflect.Value{}
+	for _, c := range a.dMap.children {
+		rel := a.schema.Relationships.Relations[a.dMap.tT.Field(c).Name]
+		if rel == nil || (rel.Type != schema.HasOne && rel.Type != schema.HasMany) {
+			continue
+		}
+		children, err := a.childField(ctx, source, c)
+		if err != nil {
+			return a.emptyT, err
+		}
+		copies[c] = copyRows(children, rel.FieldSchema)
 	}
+	return a.createFrom(ctx, edit, func(item *T) {
+		dst := reflect.ValueOf(item).Elem()
+		for c, rows := range copies {
+			dst.Field(c).Set(rows)
+		}
+	})
+}
 
-	// Finally register the API with Fiber
-	RegisterAPI(app, fullApi)
+// copyRows returns a copy of v, a model or a slice, array or pointer of models of schema s, with the primary keys
+// and create and update times cleared so they are saved as new rows
+func copyRows(v reflect.Value, s *schema.Schema) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		ptr := reflect.New(v.Type().Elem())
+		ptr.Elem().Set(copyRows(v.Elem(), s))
+		return ptr
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		rows := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			rows.Index(i).Set(copyRows(v.Index(i), s))
+		}
+		return rows
+	case reflect.Array:
+		rows := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			rows.Index(i).Set(copyRows(v.Index(i), s))
+		}
+		return rows
+	case reflect.Struct:
+		row := reflect.New(v.Type()).Elem()
+		row.Set(v)
+		for _, f := range s.Fields {
+			if f.PrimaryKey || f.AutoCreateTime > 0 || f.AutoUpdateTime > 0 {
+				field := row.FieldByIndex(f.StructField.Index)
+				field.Set(reflect.Zero(field.Type()))
+			}
+		}
+		return row
+	}
+	return v
 }
 
-// finder for single items.
-// Makes used of the gorm Find() function passing in a template object that has just the key set.
-func (a *grest[T, D]) finder(key string) (T, bool) {
-	// Create the template item
-	item, err := a.emptyWithKey(key)
+// createFrom inserts a new T built from a template T and D mutation + key field, with init, if set, applied before it is saved
+func (a *grest[T, D]) createFrom(ctx context.Context, edit D, init func(item *T)) (T, error) {
+	// Create the new empty object with a key set, every part of a composite key is required.
+	// A zero key, e.g. 0 for an int key, is missing unless the database generates it, as for an auto increment ID.
+	var parts []string
+	for _, index := range a.dMap.dtoKeys {
+		value := reflect.ValueOf(edit).FieldByIndex(index)
+		part := keyToString(value)
+		name := a.dMap.dT.FieldByIndex(index).Name
+		if part == "" || value.IsZero() && !a.generated(name) {
+			return a.emptyT, fmt.Errorf("%w: key field %s is required", ErrValidation, name)
+		}
+		parts = append(parts, part)
+	}
+	keyString := a.joinKey(parts)
+	for _, r := range a.reserved {
+		if keyString == r {
+			return a.emptyT, fmt.Errorf("%w: key '%s' is reserved", ErrValidation, keyString)
+		}
+	}
+	ret, err := a.emptyWithKey(keyString)
 	if err != nil {
-		return item, false
+		return ret, err
 	}
-	// Find it.
-	// Preload joined tables so that the object is fully populated.
-	tx := a.db.Preload(clause.Associations).Limit(1).Find(&item, &item)
-
-	// Return the result or error
-	err2 := tx.Error
-	cnt := tx.RowsAffected
-	if err2 != nil || cnt != 1 {
-		return a.emptyT, false
+	if init != nil {
+		init(&ret)
+	}
+	// Copy the data and save
+	ret, err = a.mutate(ctx, ret, edit)
+	if errors.Is(err, ErrConflict) {
+		return ret, fmt.Errorf("%w: key '%s' already exists", ErrConflict, keyString)
 	}
-	return item, true
+	return ret, err
 }
 
-// emptyWithKey creates an empty template of T filling in only the key field.
-func (a *grest[T, D]) emptyWithKey(key string) (T, error) {
-	// Start with our fully empty T
-	item := a.emptyT
+// generated reports if the column of the field name of T is generated by the database when it is zero, an auto increment key
+func (a *grest[T, D]) generated(name string) bool {
+	field := a.schema.LookUpField(name)
+	return field != nil && field.AutoIncrement
+}
 
-	// Get a mutable reflect.Value
-	valObj := reflect.Indirect(reflect.ValueOf(&item))
-	// And set our key field, selecting the appropriate type
-	valDest := valObj.FieldByIndex(a.dMap.objKey)
-	if valDest.CanSet() {
-		switch {
-		case valDest.CanInt():
-			k, err := strconv.Atoi(key)
-			if err != nil {
-				return a.emptyT, errors.New("key value " + key + " is not an int")
-			}
-			valDest.SetInt(int64(k))
-		case valDest.CanUint():
-			k, err := strconv.Atoi(key)
-			if err != nil {
-				return a.emptyT, errors.New("key value " + key + " is not a uint")
-			}
-			valDest.SetUint(uint64(k))
-		default:
-			valDest.SetString(key)
+// updatedAt returns the auto update time field of T, or nil if it doesn't have one
+func (a *grest[T, D]) updatedAt() *schema.Field {
+	for _, field := range a.schema.Fields {
+		if field.AutoUpdateTime > 0 {
+			return field
 		}
-	} else {
-		panic(fmt.Sprintf("key field '%s' is not settable", a.dMap.tT.FieldByIndex(a.dMap.objKey).Name))
 	}
-	return item, nil
+	return nil
 }
 
-// findAll returns all the objects of T as a slice
-func (a *grest[T, D]) findAll() []T {
-	var all []T
-	a.db.Preload(clause.Associations).Find(&all)
-	return all
+// version returns the auto update time of item as its version
+func (a *grest[T, D]) version(item T) string {
+	v, _ := a.updatedAt().ValueOf(context.Background(), reflect.ValueOf(item))
+	if t, ok := v.(time.Time); ok {
+		return strconv.FormatInt(t.UnixNano(), 10)
+	}
+	return fmt.Sprint(v)
 }
 
-// search uses the D as a filter, providing it as a mask to the gorm find function
-func (a *grest[T, D]) search(filter D) []T {
-	tFilter := a.copyFromDto(a.emptyT, filter)
-	var all []T
-	a.db.Preload(clause.Associations).Find(&all, &tFilter)
-	return all
+// key returns the key fields of item as a string, joined with JoinKey for a composite key
+func (a *grest[T, D]) key(item T) string {
+	var parts []string
+	for _, index := range a.dMap.objKeys {
+		parts = append(parts, keyToString(reflect.ValueOf(item).FieldByIndex(index)))
+	}
+	return a.joinKey(parts)
 }
 
-// mutate takes a Dto of type D and applies it to an existing object of T.
-// T is then persisted in the DB.
-func (a *grest[T, D]) mutate(orig T, edit D) (T, error) {
-	// Copy the dto
-	orig = a.copyFromDto(orig, edit)
-	// Save it to the database
-	err := a.db.Save(&orig).Error
-	return orig, err
+// joinKey joins the parts of a composite key with JoinKey, a single key is returned as it is
+func (a *grest[T, D]) joinKey(parts []string) string {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return JoinKey(parts...)
 }
 
-// create inserts a new T built from a template T and D mutation + key field
-func (a *grest[T, D]) create(edit D) (T, error) {
-	// Create the new empty object with a key set
-	key := reflect.ValueOf(edit).FieldByIndex(a.dMap.dtoKey)
-	keyString := ""
+// keyToString formats a key field value as a string
+func keyToString(key reflect.Value) string {
 	switch {
 	case key.CanInt():
-		keyString = strconv.Itoa(int(key.Int()))
+		return strconv.Itoa(int(key.Int()))
 	case key.CanUint():
-		keyString = strconv.Itoa(int(key.Uint()))
+		return strconv.Itoa(int(key.Uint()))
 	default:
-		keyString = key.String()
-	}
-	if keyString == "" {
-		return a.emptyT, errors.New("missing key value")
-	}
-	ret, err := a.emptyWithKey(keyString)
-	if err != nil {
-		return ret, err
+		return key.String()
 	}
-	// Copy the data and save
-	return a.mutate(ret, edit)
 }
 
 // copyToDto does the heavy lifting of "cloning" T into its Dto D.
@@ -266,10 +1349,10 @@ func (a *grest[T, D]) copyFromDto(out T, in D) T {
 	valObj := reflect.Indirect(reflect.ValueOf(&out))
 	valIn := reflect.ValueOf(in)
 
-	// Copy key field
-	oKey := valObj.FieldByIndex(a.dMap.objKey)
-	dKey := valIn.FieldByIndex(a.dMap.dtoKey)
-	oKey.Set(dKey)
+	// Copy key fields
+	for i, index := range a.dMap.objKeys {
+		valObj.FieldByIndex(index).Set(valIn.FieldByIndex(a.dMap.dtoKeys[i]))
+	}
 
 	// For each Dto field copy its value
 	for _, pair := range a.dMap.links {
@@ -288,26 +1371,442 @@ func (a *grest[T, D]) copyFromDto(out T, in D) T {
 }
 
 // delete simply using GORM to delete the specified item.
-// If gorm.Model is used then the object is not deleted, it is just marked as inactive in the database.
-func (a *grest[T, D]) delete(item T) (T, error) {
-	err := a.db.Delete(&item).Error
-	return item, err
+// If gorm.Model is used then the object is not deleted, it is just marked as inactive in the database,
+// and the item returned has DeletedAt set, so DeleteResponseDto sends it if the Dto exposes it.
+func (a *grest[T, D]) delete(ctx context.Context, item T) (T, error) {
+	err := a.db.WithContext(ctx).Delete(&item).Error
+	return item, wrapGormError(err)
+}
+
+// deleteBatch is the number of items deleteAll deletes with each DELETE, keeping the keys within the bind variable limits of the databases
+const deleteBatch = 500
+
+// deleteAll deletes the items by their primary keys in one transaction, none are deleted if any fails, returning the number deleted.
+// Only the rows of the items are deleted, not others matching the filter they were found with.
+func (a *grest[T, D]) deleteAll(ctx context.Context, items []T) (int64, error) {
+	var deleted int64
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(items); start += deleteBatch {
+			end := start + deleteBatch
+			if end > len(items) {
+				end = len(items)
+			}
+			batch := items[start:end]
+			res := tx.Delete(&batch)
+			if res.Error != nil {
+				return wrapGormError(res.Error)
+			}
+			deleted += res.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
 }
 
 // children supplies a function implementation to source and return a specific child field
-// identified as `rest:"child"`.  If the field is not a slice or array a panic will be triggered.
-func (a *grest[T, D]) children(c int) func(item T) []any {
-	return func(item T) []any {
-		// Create return array
-		var res []any
-		// Get our child field
-		children := reflect.ValueOf(item).Field(c)
-		// Copy child values into the array - this will panic if children is not an Array or Slice
-		for i := 0; i < children.Len(); i++ {
-			res = append(res, children.Index(i).Interface())
+// identified as `rest:"child"`, either a slice or array of children or a single child.
+func (a *grest[T, D]) children(c int) func(ctx context.Context, item T) []any {
+	return func(ctx context.Context, item T) []any {
+		field, err := a.childField(ctx, item, c)
+		if err != nil {
+			orPackageLogger(a.Logger).Errorf("Error loading %s: %v\n", a.dMap.tT.Field(c).Name, err)
+		}
+		return childValues(field)
+	}
+}
+
+// childField returns the child field c of item, loading it through its association if it isn't preloaded
+func (a *grest[T, D]) childField(ctx context.Context, item T, c int) (reflect.Value, error) {
+	field := reflect.ValueOf(item).Field(c)
+	name := a.dMap.tT.Field(c).Name
+	if a.preloaded(name) {
+		return field, nil
+	}
+	children := reflect.New(field.Type())
+	tx := a.db.WithContext(ctx).Model(&item)
+	if order, ok := a.orders[c]; ok {
+		tx = tx.Order(order)
+	}
+	for _, p := range a.nestedPreloads(name) {
+		tx = tx.Preload(p)
+	}
+	if err := tx.Association(name).Find(children.Interface()); err != nil {
+		return field, wrapGormError(err)
+	}
+	return children.Elem(), nil
+}
+
+// childPage supplies a function to query a page of a specific child field identified as `rest:"child"`.
+// Only the page of children is loaded, in the order of their tag or by their primary key.
+func (a *grest[T, D]) childPage(c int) func(ctx context.Context, item T, limit, offset int) ([]any, error) {
+	field := a.dMap.tT.Field(c)
+	order, ok := a.orders[c]
+	if !ok {
+		order = clause.OrderByColumn{Column: clause.PrimaryColumn}
+	}
+	page := associationPage(a.db, field, a.nestedPreloads(field.Name), order)
+	return func(ctx context.Context, item T, limit, offset int) ([]any, error) {
+		return page(ctx, &item, limit, offset)
+	}
+}
+
+// associationPage supplies a function to query a page of the association field of a model in order,
+// preloading the associations of the children in preloads.  A limit of 0 loads every child.
+func associationPage(db *gorm.DB, field reflect.StructField, preloads []string, order clause.OrderByColumn) func(ctx context.Context, model any, limit, offset int) ([]any, error) {
+	return func(ctx context.Context, model any, limit, offset int) ([]any, error) {
+		children := reflect.New(field.Type)
+		tx := db.WithContext(ctx).Model(model).Order(order)
+		for _, name := range preloads {
+			tx = tx.Preload(name)
+		}
+		if limit > 0 {
+			tx = tx.Limit(limit)
+		}
+		if offset > 0 {
+			tx = tx.Offset(offset)
+		}
+		if err := tx.Association(field.Name).Find(children.Interface()); err != nil {
+			return nil, wrapGormError(err)
+		}
+		return childValues(children.Elem()), nil
+	}
+}
+
+// childAdd supplies a function to create a child from the request body and append it to a specific child field
+// identified as `rest:"child"`, setting its foreign key.
+func (a *grest[T, D]) childAdd(c int) func(ctx context.Context, item T, decode func(child any) error) (any, error) {
+	field := a.dMap.tT.Field(c)
+	return func(ctx context.Context, item T, decode func(child any) error) (any, error) {
+		child := reflect.New(childElem(field.Type))
+		if err := decode(child.Interface()); err != nil {
+			return nil, err
+		}
+		if err := a.db.WithContext(ctx).Model(&item).Association(field.Name).Append(child.Interface()); err != nil {
+			return nil, wrapGormError(err)
+		}
+		return child.Elem().Interface(), nil
+	}
+}
+
+// childGet supplies a function to query the child with the given primary key of a specific child field identified as `rest:"child"`.
+// Only that child is loaded, with its nested preloads.
+func (a *grest[T, D]) childGet(c int) func(ctx context.Context, item T, key string) (any, bool, error) {
+	field := a.dMap.tT.Field(c)
+	preloads := a.nestedPreloads(field.Name)
+	return func(ctx context.Context, item T, key string) (any, bool, error) {
+		children := reflect.New(field.Type)
+		tx := a.db.WithContext(ctx).Model(&item).Where(clause.Eq{Column: clause.PrimaryColumn, Value: key})
+		for _, name := range preloads {
+			tx = tx.Preload(name)
+		}
+		if err := tx.Association(field.Name).Find(children.Interface()); err != nil {
+			return nil, false, wrapGormError(err)
+		}
+		found := childValues(children.Elem())
+		if len(found) == 0 {
+			return nil, false, nil
+		}
+		return found[0], true, nil
+	}
+}
+
+// childRemove supplies a function to remove the child with the given primary key from a specific child field
+// identified as `rest:"child"`.  The association is deleted, for a has many child this clears its foreign key.
+func (a *grest[T, D]) childRemove(c int) func(ctx context.Context, item T, key string) error {
+	field := a.dMap.tT.Field(c)
+	return func(ctx context.Context, item T, key string) error {
+		children := reflect.New(field.Type)
+		err := a.db.WithContext(ctx).Model(&item).Where(clause.Eq{Column: clause.PrimaryColumn, Value: key}).
+			Association(field.Name).Find(children.Interface())
+		if err != nil {
+			return wrapGormError(err)
+		}
+		found := childValues(children.Elem())
+		if len(found) == 0 {
+			return ErrNotFound
+		}
+		return wrapGormError(a.db.WithContext(ctx).Model(&item).Association(field.Name).Delete(pointerTo(found[0])))
+	}
+}
+
+// nestedChildren returns the SubEntities for the fields of children of type t identified as `rest:"child"`,
+// and recursively for their own children.  The children are loaded through their association when requested.
+// seen holds the types being expanded so that cyclic types stop.  Errors loading children are logged with logger, or the package Logger if nil.
+func nestedChildren(db *gorm.DB, t reflect.Type, seen map[reflect.Type]bool, logger Logger) []SubEntity[any, any] {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	var subs []SubEntity[any, any]
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || !restTagHas(field.Tag.Get("rest"), "child") {
+			continue
+		}
+		order, err := childOrder(db, field, restTagValue(field.Tag.Get("rest"), "order"))
+		if err != nil {
+			orPackageLogger(logger).Errorf("Error ordering %s, ordered by primary key: %v\n", field.Name, err)
+		}
+		page := associationPage(db, field, nil, order)
+		subs = append(subs, SubEntity[any, any]{
+			SubPath: childPath(field),
+			GetCtx: func(ctx context.Context, parent any) []any {
+				children, err := page(ctx, pointerTo(parent), 0, 0)
+				if err != nil {
+					orPackageLogger(logger).Errorf("Error loading %s: %v\n", field.Name, err)
+				}
+				return children
+			},
+			GetPage: func(ctx context.Context, parent any, limit, offset int) ([]any, error) {
+				return page(ctx, pointerTo(parent), limit, offset)
+			},
+			Dto:         childDto,
+			Key:         childKey(db, childElem(field.Type)),
+			SubEntities: nestedChildren(db, childElem(field.Type), seen, logger),
+		})
+	}
+	return subs
+}
+
+// childDtos builds the Dto transformations of the ChildDtos by the index of their child field.
+// It is an error if a name isn't a `rest:"child"` field or the fields of its Dto don't match those of the child.
+func (a *grest[T, D]) childDtos() (map[int]func(child any) any, error) {
+	dtos := map[int]func(child any) any{}
+	for name, dto := range a.ChildDtos {
+		field, ok := a.dMap.tT.FieldByName(name)
+		if !ok || len(field.Index) != 1 || !a.isChild(field.Index[0]) {
+			return nil, fmt.Errorf("child dto %s is not a child of %s", name, a.dMap.tT.Name())
+		}
+		cT := childElem(field.Type)
+		for cT.Kind() == reflect.Pointer {
+			cT = cT.Elem()
+		}
+		dT := reflect.TypeOf(dto)
+		for dT != nil && dT.Kind() == reflect.Pointer {
+			dT = dT.Elem()
+		}
+		if dT == nil || dT.Kind() != reflect.Struct || cT.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("child dto %s of %s must be a struct", name, a.dMap.tT.Name())
+		}
+		links, err := linkFields(cT, dT)
+		if err != nil {
+			return nil, fmt.Errorf("child dto %s: %v", name, err)
+		}
+		dtos[field.Index[0]] = func(child any) any {
+			in := reflect.Indirect(reflect.ValueOf(child))
+			out := reflect.New(dT).Elem()
+			for _, link := range links {
+				out.FieldByIndex(link.dField).Set(in.FieldByIndex(link.tField))
+			}
+			return out.Interface()
+		}
+	}
+	return dtos, nil
+}
+
+// isChild reports if the field c of T is tagged `rest:"child"`
+func (a *grest[T, D]) isChild(c int) bool {
+	for _, child := range a.dMap.children {
+		if child == c {
+			return true
+		}
+	}
+	return false
+}
+
+// childDto returns the Dto transformation of the children of field c, from ChildDtos or else those registered
+func (a *grest[T, D]) childDto(c int) func(child any) any {
+	if dto, ok := a.dtos[c]; ok {
+		return dto
+	}
+	return childDto
+}
+
+// childOrder returns the order of the children in field given by spec, the value of the tag `rest:"child,order=<field> [asc|desc]"`.
+// An empty spec orders by primary key, as does an invalid one, which is also an error.
+func childOrder(db *gorm.DB, field reflect.StructField, spec string) (clause.OrderByColumn, error) {
+	order := clause.OrderByColumn{Column: clause.PrimaryColumn}
+	if spec == "" {
+		return order, nil
+	}
+	parts := strings.Fields(spec)
+	if len(parts) == 0 || len(parts) > 2 || len(parts) == 2 && !strings.EqualFold(parts[1], "asc") && !strings.EqualFold(parts[1], "desc") {
+		return order, fmt.Errorf("invalid order %q of %s", spec, field.Name)
+	}
+	t := childElem(field.Type)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(reflect.New(t).Interface()); err != nil {
+		return order, err
+	}
+	column := stmt.Schema.LookUpField(parts[0])
+	if column == nil || column.DBName == "" {
+		return order, fmt.Errorf("order field %s of %s is not a column of %s", parts[0], field.Name, t.Name())
+	}
+	return clause.OrderByColumn{Column: clause.Column{Name: column.DBName}, Desc: len(parts) == 2 && strings.EqualFold(parts[1], "desc")}, nil
+}
+
+// orderBy supplies a preload condition ordering the preloaded children by order
+func orderBy(order clause.OrderByColumn) func(tx *gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Order(order)
+	}
+}
+
+// restTagValue returns the value of the option name=value in the rest tag tags, or "" if there is none
+func restTagValue(tags string, name string) string {
+	for _, option := range strings.Split(tags, ",") {
+		if option = strings.TrimSpace(option); strings.HasPrefix(option, name+"=") {
+			return option[len(name)+1:]
+		}
+	}
+	return ""
+}
+
+// restTagHas reports if the rest tag tags has the option flag, e.g. key or child, as a whole option rather than part of a value
+func restTagHas(tags string, flag string) bool {
+	for _, option := range strings.Split(tags, ",") {
+		if strings.TrimSpace(option) == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// childPath is the sub-path of the children of field, the option of the tag `rest:"child,path=<path>"` or else the lower case field name
+func childPath(field reflect.StructField) string {
+	if path := restTagValue(field.Tag.Get("rest"), "path"); path != "" {
+		return path
+	}
+	return strings.ToLower(field.Name)
+}
+
+// childElem is the type of a child held in a field of type t, either a slice or array of children or a single child
+func childElem(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		return t.Elem()
+	}
+	return t
+}
+
+// childValues returns the children held in v, either a slice or array of children or a single child.
+// A zero single child is not returned.
+func childValues(v reflect.Value) []any {
+	var res []any
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			res = append(res, v.Index(i).Interface())
+		}
+	default:
+		if !v.IsZero() {
+			res = append(res, v.Interface())
 		}
-		return res
 	}
+	return res
+}
+
+// pointerTo returns a pointer to a copy of v, or v itself if it is already a pointer, for use as a GORM model
+func pointerTo(v any) any {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		return v
+	}
+	p := reflect.New(rv.Type())
+	p.Elem().Set(rv)
+	return p.Interface()
+}
+
+// childKey returns a function giving the primary key of children of type t as a string,
+// or nil if t has no single primary key
+func childKey(db *gorm.DB, t reflect.Type) func(child any) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(reflect.New(t).Interface()); err != nil || stmt.Schema.PrioritizedPrimaryField == nil {
+		return nil
+	}
+	field := stmt.Schema.PrioritizedPrimaryField
+	return func(child any) string {
+		v, _ := field.ValueOf(context.Background(), reflect.ValueOf(child))
+		return fmt.Sprint(v)
+	}
+}
+
+// dtoRegistry holds the Dto transformation of the types registered with RegisterApi or RegisterDto.
+// It is used to transform children exposed as child paths.
+var dtoRegistry = struct {
+	sync.RWMutex
+	dtos map[reflect.Type]func(child any) any
+}{dtos: map[reflect.Type]func(child any) any{}}
+
+// RegisterDto sets the Dto transformation of children of type C when they are exposed as a child path.
+// Types with their own API registered by RegisterApi use its Dto unless one is set here.
+func RegisterDto[C any, CD any](dto func(child C) CD) {
+	var c C
+	registerDto(reflect.TypeOf(c), func(child any) any { return dto(child.(C)) }, true)
+}
+
+// registerDto adds dto to the registry for t, only replacing an existing transformation if replace is set
+func registerDto(t reflect.Type, dto func(child any) any, replace bool) {
+	dtoRegistry.Lock()
+	defer dtoRegistry.Unlock()
+	if _, ok := dtoRegistry.dtos[t]; ok && !replace {
+		return
+	}
+	dtoRegistry.dtos[t] = dto
+}
+
+// childDto transforms a child with the Dto registered for its type, if there is one
+func childDto(child any) any {
+	dtoRegistry.RLock()
+	dto, ok := dtoRegistry.dtos[reflect.TypeOf(child)]
+	dtoRegistry.RUnlock()
+	if !ok {
+		return child
+	}
+	return dto(child)
+}
+
+// wrapGormError wraps GORM errors with the matching easyrest error so the handler can respond with a meaningful status
+func wrapGormError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case isDuplicateKeyError(err):
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case errors.Is(err, gorm.ErrPrimaryKeyRequired), errors.Is(err, gorm.ErrInvalidData),
+		errors.Is(err, gorm.ErrInvalidField), errors.Is(err, gorm.ErrInvalidValue):
+		return fmt.Errorf("%w: %w", ErrValidation, err)
+	}
+	return err
+}
+
+// isDuplicateKeyError detects unique constraint violations.
+// The drivers are not imported so their errors are recognised by shape:
+// postgres errors carry SQLSTATE 23505 and sqlite errors a "UNIQUE constraint failed" message.
+func isDuplicateKeyError(err error) bool {
+	var sqlState interface{ SQLState() string }
+	switch {
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return true
+	case errors.As(err, &sqlState):
+		return sqlState.SQLState() == "23505"
+	}
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
 }
 
 type fieldLink struct {
@@ -316,12 +1815,14 @@ type fieldLink struct {
 }
 
 type dtoMap struct {
-	links    []fieldLink // 0 = dto, 1 = obj
-	objKey   []int
-	dtoKey   []int
-	children []int
-	dT       reflect.Type
-	tT       reflect.Type
+	links       []fieldLink // 0 = dto, 1 = obj
+	objKeys     [][]int     // The key fields, more than one for a composite key
+	dtoKeys     [][]int
+	children    []int
+	childOrders map[int]string // The order option of the children tagged `rest:"child,order=<field> [asc|desc]"`, by field
+	childPaths  map[int]string // The sub-path of each child, see childPath, by field
+	dT          reflect.Type
+	tT          reflect.Type
 }
 
 // Builds a mapping between the source and dto types.
@@ -329,72 +1830,95 @@ type dtoMap struct {
 // set to be ignored in the JSON (i.e. json="-").   This allows the same
 // type to be used for both the source and the DTO without missing JSON types
 // inadvertently overwriting source fields in the copy back.
-func buildDtoMap[T any, D any](emptyT T, emptyD D) (dMap dtoMap) {
+func buildDtoMap[T any, D any](emptyT T, emptyD D) (dMap dtoMap, err error) {
 	tT := reflect.TypeOf(emptyT)
 	dT := reflect.TypeOf(emptyD)
-	modelT := reflect.TypeOf(gorm.Model{}) // We ignore the gorm.Model fields explicitly
-
-	// One link for each field
-	// find the matching field in the base struct for each field in the dto struct
-	for i := 0; i < dT.NumField(); i++ {
-		dF := dT.Field(i)
-		jsonTags := dF.Tag.Get("json") // Ignore fields not in JSON
-		if dF.IsExported() && jsonTags != "-" && dF.Type != modelT {
-			tF, ok := tT.FieldByName(dF.Name)
-			if !ok {
-				panic(fmt.Sprintf("Missing dto field %s on base type %s", dF.Name, tT.Name()))
-			}
-			if tF.Type != dF.Type {
-				panic(fmt.Sprintf("Mismatched types on %s.%s and %s.%s", dT.Name(), dF.Name, tT.Name(), tF.Name))
-			}
-			tIndex := tF.Index
-			dIndex := dF.Index
-			if tF.Name == dF.Name {
-				dMap.links = append(dMap.links, fieldLink{dField: dIndex, tField: tIndex})
-			}
-		}
+	if dMap.links, err = linkFields(tT, dT); err != nil {
+		return dMap, err
 	}
 
-	keyFound := false
 	// Inspect all the base struct fields for tags
 	for i := 0; i < tT.NumField(); i++ {
 		tF := tT.Field(i)
 		if tF.IsExported() {
 			tags := tF.Tag.Get("rest")
-			// Identify the key field
-			if strings.Contains(tags, "key") {
-				dMap.objKey = tF.Index
-				keyFound = true
+			// Identify the key fields, in declaration order for a composite key
+			if restTagHas(tags, "key") {
+				dMap.objKeys = append(dMap.objKeys, tF.Index)
 				keyField, ok := dT.FieldByName(tF.Name)
 				if ok {
-					dMap.dtoKey = keyField.Index
+					dMap.dtoKeys = append(dMap.dtoKeys, keyField.Index)
 				} else {
-					panic("Key field " + tF.Name + " missing on Dto type " + dT.Name())
+					return dMap, fmt.Errorf("key field %s missing on Dto type %s", tF.Name, dT.Name())
 				}
 			}
 			// Children to expose
-			if strings.Contains(tags, "child") {
+			if restTagHas(tags, "child") {
 				dMap.children = append(dMap.children, i)
+				path := childPath(tF)
+				for _, other := range dMap.childPaths {
+					if other == path {
+						return dMap, fmt.Errorf("duplicate child path %s on %s", path, tT.Name())
+					}
+				}
+				if dMap.childPaths == nil {
+					dMap.childPaths = map[int]string{}
+				}
+				dMap.childPaths[i] = path
+				if order := restTagValue(tags, "order"); order != "" {
+					if dMap.childOrders == nil {
+						dMap.childOrders = map[int]string{}
+					}
+					dMap.childOrders[i] = order
+				}
 			}
 		}
 	}
 
-	if !keyFound {
+	if len(dMap.objKeys) == 0 {
 		// If no explicit key is set, try for an ID field like gorm
 		idTF, ok := tT.FieldByName("ID")
 		if !ok {
-			panic("No key field found and no ID field for " + tT.Name())
+			return dMap, fmt.Errorf("no key field found and no ID field for %s", tT.Name())
 		}
 		idDF, ok := dT.FieldByName("ID")
 		if !ok {
-			panic("No key field ID found on " + dT.Name())
+			return dMap, fmt.Errorf("no key field ID found on %s", dT.Name())
 		}
-		dMap.objKey = idTF.Index
-		dMap.dtoKey = idDF.Index
+		dMap.objKeys = [][]int{idTF.Index}
+		dMap.dtoKeys = [][]int{idDF.Index}
 	}
 
 	dMap.dT = dT
 	dMap.tT = tT
 
-	return dMap
+	return dMap, nil
+}
+
+// linkFields links each exported field of the dto type dT in the JSON to the identically named field of the base type tT.
+// The fields of gorm.Model are ignored.  It is an error if a field is missing from tT or has a different type.
+func linkFields(tT reflect.Type, dT reflect.Type) (links []fieldLink, err error) {
+	modelT := reflect.TypeOf(gorm.Model{}) // We ignore the gorm.Model fields explicitly
+
+	// One link for each field
+	// find the matching field in the base struct for each field in the dto struct
+	for i := 0; i < dT.NumField(); i++ {
+		dF := dT.Field(i)
+		jsonTags := dF.Tag.Get("json") // Ignore fields not in JSON
+		if dF.IsExported() && jsonTags != "-" && dF.Type != modelT {
+			tF, ok := tT.FieldByName(dF.Name)
+			if !ok {
+				return nil, fmt.Errorf("missing dto field %s on base type %s", dF.Name, tT.Name())
+			}
+			if tF.Type != dF.Type {
+				return nil, fmt.Errorf("mismatched types on %s.%s and %s.%s", dT.Name(), dF.Name, tT.Name(), tF.Name)
+			}
+			tIndex := tF.Index
+			dIndex := dF.Index
+			if tF.Name == dF.Name {
+				links = append(links, fieldLink{dField: dIndex, tField: tIndex})
+			}
+		}
+	}
+	return links, nil
 }
@@ -0,0 +1,114 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MIMEApplicationHAL is the JSON Hypertext Application Language, JSON with _links and _embedded resources
+const MIMEApplicationHAL = "application/hal+json"
+
+// halLink is a HAL link object
+type halLink struct {
+	Href string `json:"href"`
+}
+
+// wantsHAL is true if the request prefers HAL to the other codecs
+func wantsHAL(c *fiber.Ctx) bool {
+	return negotiate(c).mime == MIMEApplicationHAL
+}
+
+// halLinks returns the HAL links of the item at self, its collection at base and its SubEntities
+func (api Api[T, D]) halLinks(base string, self string) map[string]halLink {
+	links := map[string]halLink{"self": {self}, "collection": {base}}
+	for _, sub := range api.SubEntities {
+		links[sub.SubPath] = halLink{self + "/" + sub.SubPath}
+	}
+	return links
+}
+
+// halOne adds _links and the SubEntities as _embedded to the Jdo of a single item
+func (api Api[T, D]) halOne(c *fiber.Ctx, v any, item T) (any, error) {
+	all, err := asDecoded(v)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := all.(map[string]any)
+	if !ok {
+		return all, nil
+	}
+	base := api.basePath(c)
+	self := strings.TrimSuffix(c.Path(), "/")
+	if api.Key != nil {
+		self = base + "/" + api.keyPath(api.Key(item))
+	}
+	m["_links"] = api.halLinks(base, self)
+	if len(api.SubEntities) > 0 {
+		embedded := map[string]any{}
+		for _, sub := range api.SubEntities {
+			children, err := pageChildren(c.UserContext(), sub, item, 0, 0)
+			if err != nil {
+				return nil, err
+			}
+			if children == nil {
+				children = []any{}
+			}
+			embedded[sub.SubPath] = children
+		}
+		m["_embedded"] = embedded
+	}
+	return m, nil
+}
+
+// halList wraps the Jdos of a list as a HAL resource, embedded by the path of the api.
+// Each item is linked if the Api has a Key function, count is the number of items.
+func (api Api[T, D]) halList(c *fiber.Ctx, v any, items []T, count int) (any, error) {
+	all, err := asDecoded(v)
+	if err != nil {
+		return nil, err
+	}
+	list, _ := all.([]any)
+	if list == nil {
+		list = []any{}
+	}
+	base := api.basePath(c)
+	if api.Key != nil {
+		for i, item := range list {
+			if m, ok := item.(map[string]any); ok && i < len(items) {
+				m["_links"] = api.halLinks(base, base+"/"+api.keyPath(api.Key(items[i])))
+			}
+		}
+	}
+	self := strings.TrimSuffix(c.Path(), "/")
+	if query := string(c.Request().URI().QueryString()); query != "" {
+		self += "?" + query
+	}
+	return map[string]any{
+		"_links":    map[string]halLink{"self": {self}},
+		"_embedded": map[string]any{api.Path: list},
+		"count":     count,
+	}, nil
+}
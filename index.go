@@ -0,0 +1,129 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// IndexEntry describes a registered api in the index served by RegisterIndex
+type IndexEntry struct {
+	Path        string       `json:"path"`        // The full path of the api
+	Actions     []string     `json:"actions"`     // The names of the enabled actions, as Registration.Actions
+	Methods     []string     `json:"methods"`     // The methods served on the collection
+	ItemMethods []string     `json:"itemMethods"` // The methods served on an item
+	SubEntities []string     `json:"subEntities"` // The sub paths of the SubEntities of an item
+	Fields      []IndexField `json:"fields"`      // The fields of the Jdo
+}
+
+// IndexField is a field of the Jdo of an api, by its JSON name
+type IndexField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// indexed holds the index entries of the apis registered on each fiber App
+var indexed = struct {
+	sync.Mutex
+	apps map[uintptr][]IndexEntry
+}{apps: map[uintptr][]IndexEntry{}}
+
+// appKey identifies the fiber App that router registers its routes on, 0 if it is not known.
+// A Group doesn't expose its App, so it is read by reflection.
+func appKey(router fiber.Router) uintptr {
+	switch r := router.(type) {
+	case *fiber.App:
+		return reflect.ValueOf(r).Pointer()
+	case *fiber.Group:
+		if app := reflect.ValueOf(r).Elem().FieldByName("app"); app.IsValid() && app.Kind() == reflect.Pointer {
+			return app.Pointer()
+		}
+	case *routeRecorder:
+		return appKey(r.Router)
+	}
+	return 0
+}
+
+// index records the registered api for the index of the App of router
+func (api Api[T, D]) index(router fiber.Router, caps capabilities) {
+	entry := IndexEntry{
+		Path:        api.prefix,
+		Methods:     caps.collectionMethods(),
+		ItemMethods: caps.itemMethods(),
+		SubEntities: []string{},
+		Fields:      jdoFields(reflect.TypeOf((*D)(nil)).Elem()),
+	}
+	for _, action := range api.actions(caps) {
+		entry.Actions = append(entry.Actions, action.String())
+	}
+	for _, sub := range api.SubEntities {
+		entry.SubEntities = append(entry.SubEntities, sub.SubPath)
+	}
+	indexed.Lock()
+	defer indexed.Unlock()
+	key := appKey(router)
+	indexed.apps[key] = append(indexed.apps[key], entry)
+}
+
+// jdoFields returns the fields of Jdo type t as they appear in its JSON, empty if t is not a struct
+func jdoFields(t reflect.Type) []IndexField {
+	fields := []IndexField{}
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case name == "-" || !f.IsExported():
+			continue
+		case f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct:
+			// Embedded fields are promoted
+			fields = append(fields, jdoFields(f.Type)...)
+			continue
+		case name == "":
+			name = f.Name
+		}
+		fields = append(fields, IndexField{Name: name, Type: f.Type.String()})
+	}
+	return fields
+}
+
+// RegisterIndex serves GET path on router with a JSON list of the apis registered on the same fiber App, sorted by path.
+// Each is described by an IndexEntry.
+func RegisterIndex(router fiber.Router, path string) {
+	router.Get(path, func(c *fiber.Ctx) error {
+		indexed.Lock()
+		entries := append([]IndexEntry{}, indexed.apps[reflect.ValueOf(c.App()).Pointer()]...)
+		indexed.Unlock()
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Path < entries[j].Path
+		})
+		return c.JSON(entries)
+	})
+}
@@ -0,0 +1,86 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestRecord describes one request handled by an api, for structured request logging
+type RequestRecord struct {
+	Path    string        // The path of the api, as in Api.Path
+	Action  Action        // The action of the route, e.g. ActionCreate for POST /
+	Key     string        // The key of the item in the request path, empty for collection routes
+	Status  int           // The response status
+	Latency time.Duration // The time taken by the handler
+	Err     error         // The error returned by the handler, errors sent to the client as a response are not included
+}
+
+// Metrics receives the outcome of every request handled by an api, e.g. to count requests and record latencies.
+// See the promrest package for a Prometheus implementation.
+type Metrics interface {
+	// ObserveRequest is called once for each request, with the path of the api and the action of the route
+	ObserveRequest(path string, action Action, status int, dur time.Duration)
+}
+
+// instrumented wraps the handler of a route so that a panic is recovered with a 500, the request uses the FieldNaming of the api,
+// is checked by the RateLimiter, and LogRequest and Metrics are told of each request once it is handled, if they are set.
+// Every exit from the handler is reported, including denied requests, bodies that can't be parsed and panics.
+// action is the action of the route, whether or not the request is permitted.
+func (api Api[T, D]) instrumented(action Action, handler fiber.Handler) fiber.Handler {
+	handler = api.recovered(api.handlingErrors(api.named(api.coded(api.limited(action, handler)))))
+	if api.LogRequest == nil && api.Metrics == nil {
+		return handler
+	}
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := handler(c)
+		status := c.Response().StatusCode()
+		if err != nil {
+			// The status of an error is set later by the app's ErrorHandler, this is the default status it would use
+			status = fiber.StatusInternalServerError
+			var fe *fiber.Error
+			if errors.As(err, &fe) {
+				status = fe.Code
+			}
+		}
+		latency := time.Since(start)
+		if api.Metrics != nil {
+			api.Metrics.ObserveRequest(api.Path, action, status, latency)
+		}
+		if api.LogRequest != nil {
+			api.LogRequest(RequestRecord{
+				Path:    api.Path,
+				Action:  action,
+				Key:     api.itemKey(c),
+				Status:  status,
+				Latency: latency,
+				Err:     err,
+			})
+		}
+		return err
+	}
+}
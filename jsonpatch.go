@@ -0,0 +1,251 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MIMEApplicationJSONPatch is a JSON Patch (RFC 6902) body for PATCH
+const MIMEApplicationJSONPatch = "application/json-patch+json"
+
+// patchOp is one operation of a JSON Patch document.
+// Only add, remove, replace and test are supported.
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// patchOpError is a JSON Patch operation that can't be applied, sent as 422 with the index of the operation
+type patchOpError struct {
+	index int
+	op    patchOp
+	err   error
+}
+
+func (e patchOpError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %v", e.index, e.op.Op, e.op.Path, e.err)
+}
+
+// StatusCode is 422 Unprocessable Entity
+func (e patchOpError) StatusCode() int {
+	return fiber.StatusUnprocessableEntity
+}
+
+// sendPatchOpError responds with 422, the error and the index of the failed operation
+func sendPatchOpError(c *fiber.Ctx, err patchOpError) error {
+	if handler := errorHandler(c); handler != nil {
+		return handler(c, err.StatusCode(), err)
+	}
+	return c.Status(err.StatusCode()).JSON(fiber.Map{"error": err.Error(), "op": err.index})
+}
+
+// jsonPatchFields applies a JSON Patch to the serialised dto.
+// Every path must be within a field of the Jdo, and each field changed must still decode into its type.
+// It returns the fields changed, by Jdo field name, for the normal PATCH path; a removed field is set to its zero value.
+func jsonPatchFields[D any](dto D, ops []patchOp) (map[string]any, error) {
+	all, err := decoded(dto)
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := all.(map[string]any)
+	if !ok {
+		return nil, errors.New("json patch needs a struct Jdo")
+	}
+	names := jsonToFieldNames(reflect.TypeOf(dto))
+	fields := map[string]any{}
+	for i, op := range ops {
+		switch op.Op {
+		case "add", "remove", "replace", "test":
+		default:
+			return nil, patchOpError{i, op, errors.New("unsupported operation")}
+		}
+		tokens, err := pointerTokens(op.Path)
+		if err != nil {
+			return nil, patchOpError{i, op, err}
+		}
+		name, ok := names[tokens[0]]
+		if !ok {
+			return nil, patchOpError{i, op, fmt.Errorf("unknown field '%s'", tokens[0])}
+		}
+		var value any
+		if op.Op != "remove" {
+			if value, err = decodeValue(op.Value); err != nil {
+				return nil, patchOpError{i, op, err}
+			}
+		}
+		result, err := applyPatchOp(doc, tokens, op.Op, value)
+		if err != nil {
+			return nil, patchOpError{i, op, err}
+		}
+		doc = result.(map[string]any)
+		if op.Op == "test" {
+			continue
+		}
+		f, _ := reflect.TypeOf(dto).FieldByName(name)
+		if err := assignJSON(reflect.New(f.Type).Elem(), doc[tokens[0]]); err != nil {
+			return nil, patchOpError{i, op, fmt.Errorf("invalid value for field '%s': %v", name, err)}
+		}
+		fields[name] = doc[tokens[0]]
+	}
+	return fields, nil
+}
+
+// jsonToFieldNames maps the json names of the fields of struct type t to their Go field names, including promoted fields
+func jsonToFieldNames(t reflect.Type) map[string]string {
+	names := map[string]string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case name == "-":
+			continue
+		case f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct:
+			for n, field := range jsonToFieldNames(f.Type) {
+				names[n] = field
+			}
+			continue
+		case !f.IsExported():
+			continue
+		case name == "":
+			name = f.Name
+		}
+		names[name] = f.Name
+	}
+	return names
+}
+
+// pointerTokens splits a JSON Pointer (RFC 6901) into its unescaped reference tokens, requiring at least one
+func pointerTokens(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, errors.New("path must name a field")
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// decodeValue decodes the value of an operation as decoded does, so numbers compare equal
+func decodeValue(raw json.RawMessage) (any, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("missing value")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// applyPatchOp applies op, one of add, remove, replace or test, at the location of tokens within node, returning the updated node
+func applyPatchOp(node any, tokens []string, op string, value any) (any, error) {
+	token := tokens[0]
+	if len(tokens) > 1 {
+		child, err := childOf(node, token)
+		if err != nil {
+			return nil, err
+		}
+		if child, err = applyPatchOp(child, tokens[1:], op, value); err != nil {
+			return nil, err
+		}
+		return setChild(node, token, child), nil
+	}
+
+	switch n := node.(type) {
+	case map[string]any:
+		current, exists := n[token]
+		switch {
+		case op == "add":
+			n[token] = value
+		case !exists:
+			return nil, fmt.Errorf("no value at '%s'", token)
+		case op == "replace":
+			n[token] = value
+		case op == "remove":
+			delete(n, token)
+		case !reflect.DeepEqual(current, value): // test
+			return nil, errors.New("test failed")
+		}
+		return n, nil
+	case []any:
+		if op == "add" && token == "-" {
+			return append(n, value), nil
+		}
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i > len(n) || (i == len(n) && op != "add") {
+			return nil, fmt.Errorf("invalid index '%s'", token)
+		}
+		switch op {
+		case "add":
+			n = append(n[:i], append([]any{value}, n[i:]...)...)
+		case "replace":
+			n[i] = value
+		case "remove":
+			n = append(n[:i], n[i+1:]...)
+		default: // test
+			if !reflect.DeepEqual(n[i], value) {
+				return nil, errors.New("test failed")
+			}
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("no container at '%s'", token)
+}
+
+// childOf returns the value at token of an object or array
+func childOf(node any, token string) (any, error) {
+	switch n := node.(type) {
+	case map[string]any:
+		if child, ok := n[token]; ok {
+			return child, nil
+		}
+	case []any:
+		if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(n) {
+			return n[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no value at '%s'", token)
+}
+
+// setChild replaces the value at token, which childOf has found, of an object or array
+func setChild(node any, token string, child any) any {
+	switch n := node.(type) {
+	case map[string]any:
+		n[token] = child
+	case []any:
+		i, _ := strconv.Atoi(token)
+		n[i] = child
+	}
+	return node
+}
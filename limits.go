@@ -0,0 +1,58 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+// HeaderResultsTruncated is set to "true" on a list response that was cut short by MaxResults
+const HeaderResultsTruncated = "X-Results-Truncated"
+
+// capList truncates a whole list to MaxResults items, reporting if it was truncated
+func capList[T any, D any](api Api[T, D], items []T) ([]T, bool) {
+	if api.MaxResults > 0 && len(items) > api.MaxResults {
+		return items[:api.MaxResults], true
+	}
+	return items, false
+}
+
+// capPage limits the page of a list found in the store to the first MaxResults items, plus one to tell if the list is truncated.
+// ok is false if the page starts after the cap, so there is nothing to find.
+func (api Api[T, D]) capPage(limit, offset int) (capped int, ok bool) {
+	if api.MaxResults <= 0 {
+		return limit, true
+	}
+	room := api.MaxResults + 1 - offset
+	if room <= 0 {
+		return 0, false
+	}
+	if limit == 0 || limit > room {
+		limit = room
+	}
+	return limit, true
+}
+
+// capFound truncates a page found in the store with the limit from capPage, reporting if the list was truncated
+func capFound[T any, D any](api Api[T, D], items []T, offset int) ([]T, bool) {
+	if api.MaxResults > 0 && offset+len(items) > api.MaxResults {
+		return items[:api.MaxResults-offset], true
+	}
+	return items, false
+}
@@ -0,0 +1,94 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// linkList adds _links to each Jdo of a list response, linking it to the key of the matching item.
+// Items can only be linked if the Api has a Key function.
+func (api Api[T, D]) linkList(c *fiber.Ctx, v any, items []T) (any, error) {
+	if api.Key == nil {
+		return v, nil
+	}
+	all, err := asDecoded(v)
+	if err != nil {
+		return nil, err
+	}
+	list, _ := all.([]any)
+	base := api.basePath(c)
+	for i, item := range list {
+		if m, ok := item.(map[string]any); ok && i < len(items) {
+			m["_links"] = api.itemLinks(base + "/" + api.keyPath(api.Key(items[i])))
+		}
+	}
+	return all, nil
+}
+
+// linkOne adds _links to the Jdo of a single item response
+func (api Api[T, D]) linkOne(c *fiber.Ctx, v any, item T) (any, error) {
+	all, err := asDecoded(v)
+	if err != nil {
+		return nil, err
+	}
+	self := strings.TrimSuffix(c.Path(), "/")
+	if api.Key != nil {
+		self = api.basePath(c) + "/" + api.keyPath(api.Key(item))
+	}
+	if m, ok := all.(map[string]any); ok {
+		m["_links"] = api.itemLinks(self)
+	}
+	return all, nil
+}
+
+// itemLinks returns the links of the item at self and its SubEntities
+func (api Api[T, D]) itemLinks(self string) map[string]string {
+	links := map[string]string{"self": self}
+	for _, sub := range api.SubEntities {
+		links[sub.SubPath] = self + "/" + sub.SubPath
+	}
+	return links
+}
+
+// basePath returns the path of the Api for this request, including the path of any parent routers.
+// It is taken from the request path so parameters in the parent paths are filled in.
+func (api Api[T, D]) basePath(c *fiber.Ctx) string {
+	depth := len(strings.Split(strings.Trim(api.prefix, "/"), "/"))
+	segments := strings.Split(strings.TrimPrefix(c.Path(), "/"), "/")
+	if len(segments) < depth {
+		return api.prefix
+	}
+	return "/" + strings.Join(segments[:depth], "/")
+}
+
+// asDecoded returns v if it is already decoded JSON, otherwise it is serialised and decoded
+func asDecoded(v any) (any, error) {
+	switch v.(type) {
+	case []any, map[string]any:
+		return v, nil
+	}
+	return decoded(v)
+}
@@ -0,0 +1,107 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// keyLockShards is the number of shards of a keyLocks, so locking different keys rarely contends on the map
+const keyLockShards = 32
+
+// keyLocks are mutexes for the keys of an api, created when a key is locked and removed when it is unlocked uncontended
+type keyLocks struct {
+	shards [keyLockShards]keyLockShard
+}
+
+type keyLockShard struct {
+	sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock is the mutex of a key and the number of requests holding or waiting for it
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyLocks() *keyLocks {
+	l := &keyLocks{}
+	for i := range l.shards {
+		l.shards[i].locks = map[string]*keyLock{}
+	}
+	return l
+}
+
+// lock locks key, returning the function to unlock it
+func (l *keyLocks) lock(key string) func() {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	shard := &l.shards[h.Sum32()%keyLockShards]
+
+	shard.Lock()
+	kl := shard.locks[key]
+	if kl == nil {
+		kl = &keyLock{}
+		shard.locks[key] = kl
+	}
+	kl.refs++
+	shard.Unlock()
+
+	kl.Lock()
+	return func() {
+		kl.Unlock()
+		shard.Lock()
+		kl.refs--
+		if kl.refs == 0 {
+			delete(shard.locks, key)
+		}
+		shard.Unlock()
+	}
+}
+
+// size is the number of keys locked or waited for
+func (l *keyLocks) size() int {
+	n := 0
+	for i := range l.shards {
+		l.shards[i].Lock()
+		n += len(l.shards[i].locks)
+		l.shards[i].Unlock()
+	}
+	return n
+}
+
+// serialized wraps handler so requests for the same item run one at a time, if SerializeMutations is set
+func (api Api[T, D]) serialized(handler fiber.Handler) fiber.Handler {
+	if api.locks == nil {
+		return handler
+	}
+	return func(c *fiber.Ctx) error {
+		unlock := api.locks.lock(api.itemKey(c))
+		defer unlock()
+		return handler(c)
+	}
+}
@@ -0,0 +1,77 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// Logger receives the messages logged by the apis.
+// Client errors, such as a body that can't be parsed, are warnings and failures of the Api functions are errors.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// stdLogger logs every level with the standard library log.Printf
+type stdLogger struct{}
+
+func (stdLogger) Debugf(format string, args ...any) { log.Printf(format, args...) }
+func (stdLogger) Infof(format string, args ...any)  { log.Printf(format, args...) }
+func (stdLogger) Warnf(format string, args ...any)  { log.Printf(format, args...) }
+func (stdLogger) Errorf(format string, args ...any) { log.Printf(format, args...) }
+
+// loggerHolder lets any Logger be stored in an atomic.Value
+type loggerHolder struct {
+	Logger
+}
+
+var packageLogger atomic.Value
+
+func init() {
+	packageLogger.Store(loggerHolder{stdLogger{}})
+}
+
+// SetLogger sets the Logger used by apis without their own, nil restores the default of log.Printf
+func SetLogger(l Logger) {
+	if l == nil {
+		l = stdLogger{}
+	}
+	packageLogger.Store(loggerHolder{l})
+}
+
+// orPackageLogger is l, or the package Logger if l is nil
+func orPackageLogger(l Logger) Logger {
+	if l != nil {
+		return l
+	}
+	return packageLogger.Load().(loggerHolder).Logger
+}
+
+// logger is the Logger of the api, or the package Logger if it has none
+func (api Api[T, D]) logger() Logger {
+	return orPackageLogger(api.Logger)
+}
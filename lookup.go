@@ -0,0 +1,58 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Lookup finds an item by a secondary unique field, e.g. an email address, served as GET /by/<Field>/:value.
+// The item found is sent as for GET /:id, with the same access check, Jdo, fields, links and ETag.
+// No item matching is 404 and more than one is 409 Conflict.
+type Lookup[T any] struct {
+	Field string                                               // The path segment after by/, e.g. email
+	Find  func(ctx context.Context, value string) ([]T, error) // The items with the (percent-decoded) value, there should be at most one
+}
+
+// lookupRoute is the route of a Lookup relative to the api
+func (lookup Lookup[T]) lookupRoute() string {
+	return "/by/" + lookup.Field + "/:value"
+}
+
+// find returns the one item matching the request value
+func (lookup Lookup[T]) find(c *fiber.Ctx) (item T, ok bool, err error) {
+	value := pathKey(c, "value")
+	items, err := lookup.Find(c.UserContext(), value)
+	switch {
+	case err != nil:
+		return item, false, err
+	case len(items) == 0:
+		return item, false, nil
+	case len(items) > 1:
+		return item, false, fmt.Errorf("%w: %d items have %s %s", ErrConflict, len(items), lookup.Field, value)
+	}
+	return items[0], true, nil
+}
@@ -0,0 +1,118 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// capabilities are the optional operations enabled on an Api, from its resolved data functions
+type capabilities struct {
+	create bool
+	mutate bool
+	patch  bool
+	delete bool
+	search bool
+
+	deleteWhere bool // POST /deleteWhere, with AllowBulkDelete
+	updateWhere bool // POST /updateWhere, with AllowBulkUpdate
+	clone       bool // POST /:id/clone, with Clone
+}
+
+// capabilities returns the optional operations enabled, it must be called after the data functions are resolved
+func (api Api[T, D]) capabilities() capabilities {
+	return capabilities{
+		create: api.ops.create != nil,
+		mutate: api.ops.mutate != nil,
+		patch:  api.ops.patch != nil,
+		delete: api.ops.delete != nil,
+		search: api.ops.search != nil,
+
+		deleteWhere: api.AllowBulkDelete && api.ops.delete != nil && api.ops.search != nil,
+		updateWhere: api.AllowBulkUpdate && api.ops.mutate != nil && api.ops.search != nil,
+		clone:       api.Clone && api.ops.create != nil,
+	}
+}
+
+// collectionMethods are the methods served on the collection route /
+func (caps capabilities) collectionMethods() []string {
+	methods := []string{fiber.MethodGet, fiber.MethodHead}
+	if caps.create {
+		methods = append(methods, fiber.MethodPost)
+	}
+	return append(methods, fiber.MethodOptions)
+}
+
+// itemMethods are the methods served on the item route /:id
+func (caps capabilities) itemMethods() []string {
+	methods := []string{fiber.MethodGet, fiber.MethodHead}
+	if caps.mutate {
+		methods = append(methods, fiber.MethodPut)
+	}
+	if caps.patch {
+		methods = append(methods, fiber.MethodPatch)
+	}
+	if caps.delete {
+		methods = append(methods, fiber.MethodDelete)
+	}
+	return append(methods, fiber.MethodOptions)
+}
+
+// options responds to OPTIONS with 204 and an Allow header listing methods
+func options(methods []string) fiber.Handler {
+	allow := strings.Join(methods, ", ")
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderAllow, allow)
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// methodNotAllowed responds to a disabled method with 405, an Allow header listing methods and a JSON error
+func methodNotAllowed(methods []string) fiber.Handler {
+	allow := strings.Join(methods, ", ")
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderAllow, allow)
+		return sendError(c, fiber.StatusMethodNotAllowed, fmt.Errorf("%s is disabled for this resource", c.Method()))
+	}
+}
+
+// HeaderMethodOverride is the header of a POST to an item naming the method it is sent as, see Api.MethodOverride
+const HeaderMethodOverride = "X-HTTP-Method-Override"
+
+// methodOverride handles a POST to an item with the handler of the method in its X-HTTP-Method-Override header.
+// Only the methods in handlers can be overridden, others are a 405 with the Allow header of the item.
+func methodOverride(handlers map[string]fiber.Handler, methods []string) fiber.Handler {
+	notAllowed := methodNotAllowed(methods)
+	return func(c *fiber.Ctx) error {
+		method := strings.ToUpper(strings.TrimSpace(c.Get(HeaderMethodOverride)))
+		handler, ok := handlers[method]
+		if !ok {
+			return notAllowed(c)
+		}
+		c.Method(method)
+		return handler(c)
+	}
+}
@@ -0,0 +1,284 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// FieldNaming selects the json names of the Jdo fields that don't have a json tag name
+type FieldNaming uint8
+
+const (
+	FieldNamingOriginal  FieldNaming = iota // The Go field name, as encoding/json, e.g. EmployeeNo
+	FieldNamingCamelCase                    // The Go field name starting lower case, e.g. employeeNo, and ID as id
+	FieldNamingSnakeCase                    // The words of the Go field name in lower case joined by _, e.g. employee_no
+)
+
+// fieldNamesKey is the Locals key of the fieldNames of the api handling a request
+type fieldNamesKey struct{}
+
+// fieldNames maps the Go names of the untagged fields of a Jdo, and of the structs within it, to and from their json names
+type fieldNames struct {
+	out map[string]string // Go field name to json name
+	in  map[string]string // json name to Go field name
+}
+
+// newFieldNames returns the fieldNames of D for naming, nil for FieldNamingOriginal
+func newFieldNames[D any](naming FieldNaming) *fieldNames {
+	if naming == FieldNamingOriginal {
+		return nil
+	}
+	var emptyD D
+	names := &fieldNames{out: map[string]string{}, in: map[string]string{}}
+	names.add(reflect.TypeOf(emptyD), naming, map[reflect.Type]bool{})
+	return names
+}
+
+// add adds the untagged fields of t, and of any struct types it contains, renamed for naming
+func (n *fieldNames) add(t reflect.Type, naming FieldNaming, seen map[reflect.Type]bool) {
+	if t == nil {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		n.add(t.Elem(), naming, seen)
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() && !f.Anonymous || name == "-" {
+			continue
+		}
+		if name == "" && !f.Anonymous {
+			renamed := renameField(f.Name, naming)
+			n.out[f.Name] = renamed
+			n.in[renamed] = f.Name
+		}
+		n.add(f.Type, naming, seen)
+	}
+}
+
+// renameField renames a Go field name for naming.
+// The words of the name start at each upper case letter, with runs of upper case letters as one word, e.g. HTTPServer is HTTP and Server.
+func renameField(name string, naming FieldNaming) string {
+	var words []string
+	runes := []rune(name)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if unicode.IsUpper(runes[i]) && (!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	words = append(words, string(runes[start:]))
+	if naming == FieldNamingSnakeCase {
+		return strings.ToLower(strings.Join(words, "_"))
+	}
+	words[0] = strings.ToLower(words[0])
+	return strings.Join(words, "")
+}
+
+// named wraps the handler of a route so the request uses the FieldNaming of the api.
+// The keys of a JSON body, the query parameters and the fields named by sort and fields are renamed to the Go field names before the handler,
+// and responses are renamed by jsonEncoder.  Other body types are left as they are.
+func (api Api[T, D]) named(handler fiber.Handler) fiber.Handler {
+	if api.names == nil {
+		return handler
+	}
+	return func(c *fiber.Ctx) error {
+		api.names.renameRequest(c)
+		c.Locals(fieldNamesKey{}, api.names)
+		return handler(c)
+	}
+}
+
+// renameRequest renames the json names in the request to the Go field names.
+// A body that isn't valid JSON is left for the handler to reject.
+func (n *fieldNames) renameRequest(c *fiber.Ctx) {
+	args := c.Context().QueryArgs()
+	type arg struct{ key, value string }
+	var all []arg
+	args.VisitAll(func(key, value []byte) {
+		all = append(all, arg{string(key), string(value)})
+	})
+	if len(all) > 0 {
+		args.Reset()
+		for _, a := range all {
+			switch a.key {
+			case "sort", "fields":
+				a.value = n.renamePaths(a.value)
+			default:
+				if name, ok := n.in[a.key]; ok {
+					a.key = name
+				} else if field, op, found := cutLast(a.key, "."); found {
+					// A condition, field.op, keeps its operator
+					if name, ok := n.in[field]; ok {
+						a.key = name + "." + op
+					}
+				}
+			}
+			args.Add(a.key, a.value)
+		}
+	}
+
+	switch contentType(c) {
+	case fiber.MIMEApplicationJSON, MIMEApplicationMergePatch:
+		if b, err := renameKeys(c.Body(), n.in); err == nil {
+			c.Request().SetBody(b)
+		}
+	case MIMEApplicationJSONPatch:
+		var ops []patchOp
+		if err := json.Unmarshal(c.Body(), &ops); err != nil {
+			return
+		}
+		for i, op := range ops {
+			tokens := strings.Split(op.Path, "/")
+			for j, token := range tokens {
+				if name, ok := n.in[token]; ok {
+					tokens[j] = name
+				}
+			}
+			ops[i].Path = strings.Join(tokens, "/")
+		}
+		if b, err := json.Marshal(ops); err == nil {
+			c.Request().SetBody(b)
+		}
+	}
+}
+
+// renamePaths renames each name in a comma separated list of dotted field paths, keeping any - or + prefix
+func (n *fieldNames) renamePaths(list string) string {
+	if list == "" {
+		return list
+	}
+	paths := strings.Split(list, ",")
+	for i, path := range paths {
+		sign := ""
+		if path != "" && (path[0] == '-' || path[0] == '+') {
+			sign, path = path[:1], path[1:]
+		}
+		parts := strings.Split(path, ".")
+		for j, part := range parts {
+			if name, ok := n.in[strings.TrimSpace(part)]; ok {
+				parts[j] = name
+			}
+		}
+		paths[i] = sign + strings.Join(parts, ".")
+	}
+	return strings.Join(paths, ",")
+}
+
+// jsonEncoder is the JSONEncoder of the api handling the request, or the app's, renaming the Jdo fields for the FieldNaming of the api
+func jsonEncoder(c *fiber.Ctx) utils.JSONMarshal {
+	encode := c.App().Config().JSONEncoder
+	if json, ok := c.Locals(serializerKey{}).(serializer); ok && json.encode != nil {
+		encode = json.encode
+	}
+	names, ok := c.Locals(fieldNamesKey{}).(*fieldNames)
+	if !ok {
+		return encode
+	}
+	return func(v any) ([]byte, error) {
+		b, err := encode(v)
+		if err != nil {
+			return nil, err
+		}
+		return renameKeys(b, names.out)
+	}
+}
+
+// renameKeys rewrites JSON data with every object key found in names renamed, keeping the order of the keys.
+// Any object key is renamed, including the keys of maps within the Jdo.
+func renameKeys(data []byte, names map[string]string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var out bytes.Buffer
+	// Each open object or array, with the number of keys and values written to it
+	type level struct {
+		object bool
+		count  int
+	}
+	var levels []level
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(levels) == 0 {
+				return out.Bytes(), nil
+			}
+			return nil, err
+		}
+		if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+			levels = levels[:len(levels)-1]
+			out.WriteByte(byte(delim))
+			continue
+		}
+		if len(levels) > 0 {
+			top := &levels[len(levels)-1]
+			if top.count > 0 && (!top.object || top.count%2 == 0) {
+				out.WriteByte(',')
+			}
+			top.count++
+			if top.object && top.count%2 == 1 {
+				key := tok.(string)
+				if name, ok := names[key]; ok {
+					key = name
+				}
+				b, _ := json.Marshal(key)
+				out.Write(b)
+				out.WriteByte(':')
+				continue
+			}
+		}
+		switch t := tok.(type) {
+		case json.Delim:
+			levels = append(levels, level{object: t == '{'})
+			out.WriteByte(byte(t))
+		case json.Number:
+			out.WriteString(t.String())
+		default:
+			b, err := json.Marshal(t)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(b)
+		}
+	}
+}
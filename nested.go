@@ -0,0 +1,148 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// childParam is the name of the path parameter holding the key of a child at depth, counting the SubEntity as 1
+func childParam(depth int) string {
+	if depth == 1 {
+		return "childId"
+	}
+	return "childId" + strconv.Itoa(depth)
+}
+
+// registerNested registers the getters for the nested SubEntities of the child at route.
+// path is the chain of nested SubEntities between sub and the child.
+func registerNested[T any, D any](router fiber.Router, api Api[T, D], sub SubEntity[T, D], path []SubEntity[any, any], route string, nested []SubEntity[any, any]) {
+	for _, n := range nested {
+		subRoute := route + "/" + n.SubPath
+		router.Get(subRoute, api.instrumented(ActionGetOne, getNestedEntity[T, D](api, sub, path, n)))
+		if n.Key != nil {
+			// copy the path so sibling routes don't share its backing array
+			childPath := append(append([]SubEntity[any, any]{}, path...), n)
+			childRoute := subRoute + "/:" + childParam(len(childPath)+1)
+			router.Get(childRoute, api.instrumented(ActionGetOne, getNestedEntityItem[T, D](api, sub, childPath)))
+			registerNested[T, D](router, api, sub, childPath, childRoute, n.SubEntities)
+		}
+	}
+}
+
+// findChild returns the child with the given key
+func findChild(children []any, key func(child any) string, childId string) (any, bool) {
+	for _, child := range children {
+		if key(child) == childId {
+			return child, true
+		}
+	}
+	return nil, false
+}
+
+// walkChildren descends from item through the child of sub and then the children along path,
+// each selected by its :childId path parameter.  Returns false if any of them is missing.
+func walkChildren[T any, D any](c *fiber.Ctx, item T, sub SubEntity[T, D], path []SubEntity[any, any]) (any, bool) {
+	child, ok := findChild(sub.children(c.UserContext(), item), sub.Key, pathKey(c, childParam(1)))
+	for i, n := range path {
+		if !ok {
+			return nil, false
+		}
+		child, ok = findChild(n.children(c.UserContext(), child), n.Key, pathKey(c, childParam(i+2)))
+	}
+	return child, ok
+}
+
+// findParent finds with find and authorizes the request item :id for reading its SubEntities.
+// If the response has been sent, because of an error or the item is missing, done is true.
+func findParent[T any, D any](c *fiber.Ctx, api Api[T, D], find func(ctx context.Context, key string) (T, bool, error)) (item T, done bool, err error) {
+	item, ok, err := find(c.UserContext(), api.itemKey(c))
+	if err != nil {
+		return item, true, api.sendFindError(c, err)
+	}
+	if !ok {
+		// don't leak existence information if unauthorized
+		if err := api.authorize(c, ActionGetOne); err != nil {
+			return item, true, sendDenied(c, err)
+		}
+		return item, true, sendStatus(c, fiber.StatusNotFound)
+	}
+	if err := api.authorize(c, ActionGetOne, item); err != nil {
+		return item, true, sendDenied(c, err)
+	}
+	return item, false, nil
+}
+
+// getNestedEntity fulfils a request for the nested SubEntity target of a child of the request item :id
+// The list is paged with the limit and offset query parameters.
+// 404 if the entity or any child on the path is missing
+// 400 if the paging parameters are invalid
+func getNestedEntity[T any, D any](api Api[T, D], sub SubEntity[T, D], path []SubEntity[any, any], target SubEntity[any, any]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+
+		limit, offset, err := parseLimits(c, target.DefaultPageSize, api.MaxPageSize)
+		if err != nil {
+			api.logger().Warnf("Error parsing paging parameters %v\n", err)
+			return sendStatus(c, fiber.StatusBadRequest)
+		}
+
+		item, done, err := findParent(c, api, api.ops.find)
+		if done {
+			return err
+		}
+		parent, ok := walkChildren(c, item, sub, path)
+		if !ok {
+			return sendStatus(c, fiber.StatusNotFound)
+		}
+
+		children, err := pageChildren(c.UserContext(), target, parent, limit, offset)
+		if err != nil {
+			return api.sendQueryError(c, err)
+		}
+		return render(c, api.list(children, len(children), limit, offset, false, ""))
+	}
+}
+
+// getNestedEntityItem fulfils a request for a single nested child of the request item :id, at the end of path
+// 404 if the entity or any child on the path is missing
+func getNestedEntityItem[T any, D any](api Api[T, D], sub SubEntity[T, D], path []SubEntity[any, any]) fiber.Handler {
+	target := path[len(path)-1]
+	return func(c *fiber.Ctx) error {
+
+		item, done, err := findParent(c, api, api.ops.find)
+		if done {
+			return err
+		}
+		child, ok := walkChildren(c, item, sub, path)
+		if !ok {
+			return sendStatus(c, fiber.StatusNotFound)
+		}
+		if target.Dto != nil {
+			child = target.Dto(child)
+		}
+		return render(c, api.one(child))
+	}
+}
@@ -0,0 +1,194 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// ops are the data functions of an Api resolved at registration into their most general form.
+// The handlers only call these.  Each is built from the richest public variant that is set,
+// e.g. FindCtx is used in preference to Find.  The GORM implementation fills them directly.
+type ops[T any, D any] struct {
+	find           func(ctx context.Context, key string) (T, bool, error)
+	findShallow    func(ctx context.Context, key string) (T, bool, error) // find without loading associations
+	findKey        func(ctx context.Context, key string) (T, bool, error) // find loading only the keys, enough to check it exists and query its children
+	findAll        func(ctx context.Context) ([]T, error)
+	iterate        func(ctx context.Context, yield func(T) bool) error
+	findPage       func(ctx context.Context, limit, offset int) ([]T, error)
+	search         func(ctx context.Context, filter D) ([]T, error)
+	findSorted     func(ctx context.Context, fields []SortField, limit, offset int) ([]T, error)
+	searchSorted   func(ctx context.Context, filter D, fields []SortField) ([]T, error)
+	searchAdvanced func(ctx context.Context, filter D, conditions []Condition) ([]T, error)
+	searchMap      func(ctx context.Context, fields map[string]any) ([]T, error)
+	count          func(ctx context.Context, filter *D) (int64, error)
+	findSince      func(ctx context.Context, since time.Time, filter *D) ([]T, error) // filter is nil for an unfiltered list
+	mutate         func(ctx context.Context, item T, edit D) (T, error)
+	patch          func(ctx context.Context, item T, fields map[string]any) (T, error)
+	create         func(ctx context.Context, edit D) (T, error)
+	clone          func(ctx context.Context, source T, edit D) (T, error) // Create from edit with copies of the children of source
+	delete         func(ctx context.Context, item T) (T, error)
+	deleteAll      func(ctx context.Context, items []T) (int64, error)                      // Delete the items in one transaction, none are deleted if any fails
+	updateAll      func(ctx context.Context, items []T, fields map[string]any) ([]T, error) // Patch every item, returning those updated
+
+	// The searches ordered by the sort fields in the store, these have no public variant so are only set by the GORM implementation.
+	// searchPage is a page of the search, in the default order without sort fields, limit 0 means no limit.
+	searchAdvancedSorted func(ctx context.Context, filter D, conditions []Condition, fields []SortField) ([]T, error)
+	searchMapSorted      func(ctx context.Context, fields map[string]any, sort []SortField) ([]T, error)
+	searchPage           func(ctx context.Context, filter D, fields []SortField, limit, offset int) ([]T, error)
+
+	// Cursor paging, also only set by the GORM implementation.  cursor returns the values of the sort fields and keys of an item,
+	// findAfter a page of the items after those values in the order of the sort fields, matching filter if it isn't nil.
+	// Values that can't be decoded are errInvalidCursor.
+	cursor    func(item T, fields []SortField) []any
+	findAfter func(ctx context.Context, filter *D, fields []SortField, after []json.RawMessage, limit int) ([]T, error)
+
+	// The counts of the count route, set by the GORM implementation to count in the store rather than the length of a search.
+	// countAdvanced is also the count of a filter without conditions, or of everything with a zero filter.
+	countAdvanced func(ctx context.Context, filter D, conditions []Condition) (int64, error)
+	countMap      func(ctx context.Context, fields map[string]any) (int64, error)
+}
+
+// resolveOps fills any ops not already set from the public Api functions
+func (api Api[T, D]) resolveOps() ops[T, D] {
+	o := api.ops
+	if o.find == nil && api.FindCtx != nil {
+		o.find = func(ctx context.Context, key string) (T, bool, error) {
+			item, ok := api.FindCtx(ctx, key)
+			return item, ok, nil
+		}
+	}
+	if o.find == nil && api.FindE != nil {
+		o.find = func(_ context.Context, key string) (T, bool, error) { return api.FindE(key) }
+	}
+	if o.find == nil && api.Find != nil {
+		o.find = func(_ context.Context, key string) (T, bool, error) {
+			item, ok := api.Find(key)
+			return item, ok, nil
+		}
+	}
+	if o.findAll == nil && api.FindAllCtx != nil {
+		o.findAll = func(ctx context.Context) ([]T, error) { return api.FindAllCtx(ctx), nil }
+	}
+	if o.findAll == nil && api.FindAllE != nil {
+		o.findAll = func(_ context.Context) ([]T, error) { return api.FindAllE() }
+	}
+	if o.findAll == nil && api.FindAll != nil {
+		o.findAll = func(_ context.Context) ([]T, error) { return api.FindAll(), nil }
+	}
+	if o.iterate == nil && api.IterateAll != nil {
+		o.iterate = func(_ context.Context, yield func(T) bool) error {
+			api.IterateAll(yield)
+			return nil
+		}
+	}
+	if o.findAll == nil && o.iterate != nil {
+		iterate := o.iterate
+		o.findAll = func(ctx context.Context) ([]T, error) {
+			var all []T
+			err := iterate(ctx, func(item T) bool {
+				all = append(all, item)
+				return true
+			})
+			return all, err
+		}
+	}
+	if o.findPage == nil && api.FindPage != nil {
+		o.findPage = func(_ context.Context, limit, offset int) ([]T, error) { return api.FindPage(limit, offset), nil }
+	}
+	if o.search == nil && api.SearchCtx != nil {
+		o.search = func(ctx context.Context, filter D) ([]T, error) { return api.SearchCtx(ctx, filter), nil }
+	}
+	if o.search == nil && api.SearchE != nil {
+		o.search = func(_ context.Context, filter D) ([]T, error) { return api.SearchE(filter) }
+	}
+	if o.search == nil && api.Search != nil {
+		o.search = func(_ context.Context, filter D) ([]T, error) { return api.Search(filter), nil }
+	}
+	if o.findSorted == nil && api.FindSorted != nil {
+		o.findSorted = func(_ context.Context, fields []SortField, limit, offset int) ([]T, error) {
+			return api.FindSorted(fields, limit, offset), nil
+		}
+	}
+	if o.searchSorted == nil && api.SearchSorted != nil {
+		o.searchSorted = func(_ context.Context, filter D, fields []SortField) ([]T, error) {
+			return api.SearchSorted(filter, fields), nil
+		}
+	}
+	if o.searchMap == nil && api.SearchMap != nil {
+		o.searchMap = func(_ context.Context, fields map[string]any) ([]T, error) { return api.SearchMap(fields), nil }
+	}
+	if o.searchAdvanced == nil {
+		o.searchAdvanced = api.SearchAdvancedCtx
+	}
+	if o.searchAdvanced == nil && api.SearchAdvanced != nil {
+		o.searchAdvanced = func(_ context.Context, filter D, conditions []Condition) ([]T, error) {
+			return api.SearchAdvanced(filter, conditions)
+		}
+	}
+	if o.findSince == nil && api.FindSince != nil {
+		search := o.search
+		o.findSince = func(ctx context.Context, since time.Time, filter *D) ([]T, error) {
+			return api.findSinceFiltered(ctx, since, filter, search)
+		}
+	}
+	if o.count == nil && api.Count != nil {
+		o.count = func(_ context.Context, filter *D) (int64, error) { return api.Count(filter) }
+	}
+	if o.mutate == nil {
+		o.mutate = api.MutateCtx
+	}
+	if o.mutate == nil && api.Mutate != nil {
+		o.mutate = func(_ context.Context, item T, edit D) (T, error) { return api.Mutate(item, edit) }
+	}
+	if o.patch == nil {
+		o.patch = api.PatchCtx
+	}
+	if o.patch == nil && api.Patch != nil {
+		o.patch = func(_ context.Context, item T, fields map[string]any) (T, error) { return api.Patch(item, fields) }
+	}
+	if o.create == nil {
+		o.create = api.CreateCtx
+	}
+	if o.create == nil && api.Create != nil {
+		o.create = func(_ context.Context, edit D) (T, error) { return api.Create(edit) }
+	}
+	if o.delete == nil {
+		o.delete = api.DeleteCtx
+	}
+	if o.delete == nil && api.Delete != nil {
+		o.delete = func(_ context.Context, item T) (T, error) { return api.Delete(item) }
+	}
+	if o.findShallow == nil {
+		o.findShallow = o.find
+	}
+	if o.findKey == nil {
+		o.findKey = o.findShallow
+	}
+	if o.updateAll == nil && o.mutate != nil {
+		o.updateAll = o.updateEach(api.Dto)
+	}
+	return o
+}
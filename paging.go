@@ -0,0 +1,74 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// setPageLinks sets an RFC 5988 Link header on a page of a list with links to the first, previous, next and last pages.
+// The links are the request URL with its offset and limit replaced, so filters and sort are kept.
+// total is the number of items in the whole list, -1 if unknown when there is a next page if this one is full, and no last.
+func (api Api[T, D]) setPageLinks(c *fiber.Ctx, limit int, offset int, n int, total int64) {
+	if limit <= 0 {
+		return
+	}
+	if api.MaxResults > 0 && total > int64(api.MaxResults) {
+		total = int64(api.MaxResults) // There are no pages past the cap
+	}
+	path, query, _ := strings.Cut(c.OriginalURL(), "?")
+	var kept []string
+	for _, param := range strings.Split(query, "&") {
+		name, _, _ := strings.Cut(param, "=")
+		if param != "" && name != "offset" && name != "limit" {
+			kept = append(kept, param)
+		}
+	}
+	link := func(offset int, rel string) string {
+		params := append(kept[:len(kept):len(kept)], "offset="+strconv.Itoa(offset), "limit="+strconv.Itoa(limit))
+		return "<" + path + "?" + strings.Join(params, "&") + `>; rel="` + rel + `"`
+	}
+
+	links := []string{link(0, "first")}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link(prev, "prev"))
+	}
+	if total < 0 && n == limit || total >= 0 && int64(offset+limit) < total {
+		links = append(links, link(offset+limit, "next"))
+	}
+	if total >= 0 {
+		last := 0
+		if total > 0 {
+			last = int((total - 1) / int64(limit) * int64(limit))
+		}
+		links = append(links, link(last, "last"))
+	}
+	c.Set(fiber.HeaderLink, strings.Join(links, ", "))
+}
@@ -0,0 +1,108 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// JoinKey makes the key of an item with a composite key from its parts, see Api.KeyParts.
+// Each part is percent-encoded and they are joined with /, as they appear in the item's path.
+func JoinKey(parts ...string) string {
+	escaped := make([]string, len(parts))
+	for i, part := range parts {
+		escaped[i] = url.PathEscape(part)
+	}
+	return strings.Join(escaped, "/")
+}
+
+// SplitKey returns the parts of a composite key made by JoinKey
+func SplitKey(key string) ([]string, error) {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		var err error
+		if parts[i], err = url.PathUnescape(part); err != nil {
+			return nil, err
+		}
+	}
+	return parts, nil
+}
+
+// keyParam is the name of the path parameter of part i of the item key, id for the first
+func keyParam(i int) string {
+	if i == 0 {
+		return "id"
+	}
+	return "id" + strconv.Itoa(i+1)
+}
+
+// itemRoute is the route of an item relative to the api, with a parameter for each part of the key
+func (api Api[T, D]) itemRoute() string {
+	route := "/:id"
+	for i := 1; i < api.KeyParts; i++ {
+		route += "/:" + keyParam(i)
+	}
+	return route
+}
+
+// itemKey returns the key of the request item, joining the parts of a composite key with JoinKey
+func (api Api[T, D]) itemKey(c *fiber.Ctx) string {
+	if api.KeyParts <= 1 {
+		return pathKey(c, "id")
+	}
+	parts := make([]string, api.KeyParts)
+	for i := range parts {
+		parts[i] = pathKey(c, keyParam(i))
+	}
+	return JoinKey(parts...)
+}
+
+// keyPath returns the path segments of the item with key, relative to the api.
+// A composite key is already its path, as made by JoinKey.
+func (api Api[T, D]) keyPath(key string) string {
+	if api.KeyParts <= 1 {
+		return url.PathEscape(key)
+	}
+	return key
+}
+
+// pathKey returns the path parameter name, the key of an item or child, percent-decoded.
+// Keys are matched as they are decoded, so "1 Wall Street" is requested as 1%20Wall%20Street and a + is a +.
+// A key containing / is requested with it encoded as %2F, as in the Location and links that are sent, so the key is a single path segment.
+// With the app's UnescapePath the path is decoded before routing, so keys containing / can't be requested.
+// A parameter that isn't a valid encoding is used as it is.
+func pathKey(c *fiber.Ctx, name string) string {
+	raw := c.Params(name)
+	if c.App().Config().UnescapePath {
+		return raw
+	}
+	key, err := url.PathUnescape(raw)
+	if err != nil {
+		return raw
+	}
+	return key
+}
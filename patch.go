@@ -0,0 +1,163 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MIMEApplicationMergePatch is a JSON Merge Patch (RFC 7386) body for PATCH
+const MIMEApplicationMergePatch = "application/merge-patch+json"
+
+// patchBody is a parsed PATCH body
+type patchBody struct {
+	fields map[string]any // The fields to set, by their Jdo field names.  A value of null sets the field to its zero value
+	merge  bool           // fields is a merge patch, nested objects are merged with their current values
+	ops    []patchOp      // A JSON Patch to apply to the current Jdo instead of fields
+}
+
+// parsePatch parses a PATCH body.
+// Merge patches and JSON Patches are always accepted and decoded as JSON.
+// Other bodies are checked and parsed as for PUT.
+func (api Api[T, D]) parsePatch(c *fiber.Ctx) (body patchBody, err error) {
+	if err := api.checkBodySize(c); err != nil {
+		return body, err
+	}
+	switch contentType(c) {
+	case MIMEApplicationMergePatch:
+		body.merge = true
+		err = jsonDecoder(c)(c.Body(), &body.fields)
+		return body, err
+	case MIMEApplicationJSONPatch:
+		err = jsonDecoder(c)(c.Body(), &body.ops)
+		return body, err
+	}
+	if err := api.checkContentType(c); err != nil {
+		var unsupported unsupportedTypeError
+		if errors.As(err, &unsupported) {
+			unsupported.accepted = append(append([]string{}, unsupported.accepted...), MIMEApplicationMergePatch, MIMEApplicationJSONPatch)
+			err = unsupported
+		}
+		return body, err
+	}
+	err = bodyParser(c, &body.fields)
+	return body, err
+}
+
+// patchFields returns the fields to set on dto, the current Jdo, for a parsed PATCH body
+func patchFields[D any](dto D, body patchBody) (map[string]any, error) {
+	switch {
+	case body.ops != nil:
+		return jsonPatchFields(dto, body.ops)
+	case body.merge:
+		return mergeFields(dto, body.fields)
+	}
+	return body.fields, nil
+}
+
+// mergeFields merges the object values of a merge patch with the current values of those fields of dto, as RFC 7386.
+// Keys of a nested object that are null are removed, so they are left at their zero value.
+// Other values replace the field, as for any PATCH.
+func mergeFields[D any](dto D, fields map[string]any) (map[string]any, error) {
+	valDto := reflect.ValueOf(dto)
+	merged := make(map[string]any, len(fields))
+	for name, value := range fields {
+		patch, ok := value.(map[string]any)
+		if !ok {
+			merged[name] = value
+			continue
+		}
+		current, err := decoded(valDto.FieldByName(name).Interface())
+		if err != nil {
+			return nil, err
+		}
+		merged[name] = mergePatch(current, patch)
+	}
+	return merged, nil
+}
+
+// mergePatch applies the merge patch to target, RFC 7386 section 2
+func mergePatch(target any, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = map[string]any{}
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+		} else {
+			targetObj[k] = mergePatch(targetObj[k], v)
+		}
+	}
+	return targetObj
+}
+
+// validatePatch checks every key of a PATCH body names an exported, json visible field of D
+// and that its value can be decoded into that field's type.
+func validatePatch[D any](fields map[string]any) error {
+	var emptyD D
+	dT := reflect.TypeOf(emptyD)
+	for name, value := range fields {
+		f, ok := dT.FieldByName(name)
+		if !ok || !f.IsExported() || f.Tag.Get("json") == "-" {
+			return fmt.Errorf("unknown field '%s'", name)
+		}
+		if err := assignJSON(reflect.New(f.Type).Elem(), value); err != nil {
+			return fmt.Errorf("invalid value for field '%s': %v", name, err)
+		}
+	}
+	return nil
+}
+
+// assignJSON sets dest to value, converting it via its json representation.
+// This turns the generic values from a decoded json map back into the field's own type.
+func assignJSON(dest reflect.Value, value any) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	v := reflect.New(dest.Type())
+	if err = json.Unmarshal(b, v.Interface()); err != nil {
+		return err
+	}
+	dest.Set(v.Elem())
+	return nil
+}
+
+// patchDto returns dto with the (already validated) patch fields applied
+func patchDto[D any](dto D, fields map[string]any) D {
+	valDto := reflect.Indirect(reflect.ValueOf(&dto))
+	for name, value := range fields {
+		_ = assignJSON(valDto.FieldByName(name), value)
+	}
+	return dto
+}
@@ -0,0 +1,73 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package promrest reports the requests handled by easyrest apis as Prometheus metrics.
+//
+//	metrics, err := promrest.New(prometheus.DefaultRegisterer)
+//	api.Metrics = metrics
+//
+// One Metrics can be shared by every api, the requests are labelled with the path of the api.
+package promrest
+
+import (
+	"strconv"
+	"time"
+
+	easyrest "github.com/pilotso11/go-easyrest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics is an easyrest.Metrics counting requests by path, action and status,
+// and recording their latency by path and action.
+type Metrics struct {
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+// New creates the metrics and registers them with reg, an error if they are already registered
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "easyrest_requests_total",
+			Help: "Requests handled by easyrest apis, by api path, action and response status.",
+		}, []string{"path", "action", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "easyrest_request_duration_seconds",
+			Help:    "Latency of the requests handled by easyrest apis, by api path and action.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"path", "action"}),
+	}
+	if err := reg.Register(m.requests); err != nil {
+		return nil, err
+	}
+	if err := reg.Register(m.latency); err != nil {
+		reg.Unregister(m.requests)
+		return nil, err
+	}
+	return m, nil
+}
+
+// ObserveRequest counts the request and records its latency
+func (m *Metrics) ObserveRequest(path string, action easyrest.Action, status int, dur time.Duration) {
+	m.requests.WithLabelValues(path, action.String(), strconv.Itoa(status)).Inc()
+	m.latency.WithLabelValues(path, action.String()).Observe(dur.Seconds())
+}
@@ -0,0 +1,71 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package promrest
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	easyrest "github.com/pilotso11/go-easyrest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics, err := New(reg)
+	assert.Nil(t, err)
+
+	app := fiber.New()
+	easyrest.RegisterAPI(app, easyrest.Api[string, string]{
+		Path: "items",
+		Find: func(key string) (string, bool) {
+			return key, key == "one"
+		},
+		FindAll: func() []string {
+			return []string{"one"}
+		},
+		Dto:     func(s string) string { return s },
+		Metrics: metrics,
+	})
+	for _, url := range []string{"/items", "/items/one", "/items/one", "/items/two"} {
+		_, err := app.Test(httptest.NewRequest("GET", url, nil))
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.requests.WithLabelValues("items", "getAll", "200")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.requests.WithLabelValues("items", "getOne", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.requests.WithLabelValues("items", "getOne", "404")))
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.latency))
+
+	// Registering twice is an error
+	_, err = New(reg)
+	assert.NotNil(t, err)
+
+	// Each path and action has its own histogram
+	metrics.ObserveRequest("other", easyrest.ActionCreate, 200, 1500*time.Millisecond)
+	assert.Equal(t, 3, testutil.CollectAndCount(metrics.latency))
+}
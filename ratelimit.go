@@ -0,0 +1,52 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errRateLimited is the error of a request denied by the RateLimiter
+var errRateLimited = errors.New("rate limit exceeded")
+
+// limited wraps the handler of a route so each request is first allowed by the RateLimiter of the api, if it has one.
+// A denied request gets a 429 with a Retry-After header of the whole seconds to wait, rounded up.
+func (api Api[T, D]) limited(action Action, handler fiber.Handler) fiber.Handler {
+	if api.RateLimiter == nil {
+		return handler
+	}
+	return func(c *fiber.Ctx) error {
+		allowed, retryAfter := api.RateLimiter(c, action)
+		if allowed {
+			return handler(c)
+		}
+		if retryAfter > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(int64((retryAfter+time.Second-1)/time.Second), 10))
+		}
+		return sendError(c, fiber.StatusTooManyRequests, errRateLimited)
+	}
+}
@@ -0,0 +1,130 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package ratelimit limits the requests to easyrest apis with a token bucket per client.
+//
+//	writes := ratelimit.New(ratelimit.Config{
+//		Limit:   10,
+//		Per:     time.Minute,
+//		Actions: []easyrest.Action{easyrest.ActionCreate, easyrest.ActionMutate, easyrest.ActionDelete},
+//	})
+//	api.RateLimiter = writes.Allow
+//
+// A Limiter shared by several apis shares its buckets between them.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	easyrest "github.com/pilotso11/go-easyrest"
+)
+
+// Config is the rate of a Limiter and the requests it applies to
+type Config struct {
+	Limit   int                       // Requests allowed in each Per, and the largest burst.  At least 1
+	Per     time.Duration             // The period of Limit, defaults to a second
+	Key     func(c *fiber.Ctx) string // The client of a request, each has its own bucket.  Defaults to c.IP()
+	Actions []easyrest.Action         // The actions limited, every action if empty
+}
+
+// Limiter is a token bucket for each client holding Limit tokens, refilled at Limit every Per.
+// Each limited request takes a token and is denied if there are none.
+type Limiter struct {
+	config   Config
+	interval time.Duration // The time to refill one token
+	actions  map[easyrest.Action]bool
+	now      func() time.Time
+
+	lock    sync.Mutex
+	buckets map[string]time.Time // When the bucket of each client will be full
+	swept   time.Time
+}
+
+// New creates a Limiter for config
+func New(config Config) *Limiter {
+	if config.Limit < 1 {
+		config.Limit = 1
+	}
+	if config.Per <= 0 {
+		config.Per = time.Second
+	}
+	if config.Key == nil {
+		config.Key = func(c *fiber.Ctx) string { return c.IP() }
+	}
+	l := &Limiter{
+		config:   config,
+		interval: config.Per / time.Duration(config.Limit),
+		now:      time.Now,
+		buckets:  make(map[string]time.Time),
+	}
+	if len(config.Actions) > 0 {
+		l.actions = make(map[easyrest.Action]bool)
+		for _, action := range config.Actions {
+			l.actions[action] = true
+		}
+	}
+	return l
+}
+
+// Allow takes a token from the bucket of the client of the request, it is an easyrest Api.RateLimiter.
+// If the bucket is empty the request is denied with the time until a token is available.
+func (l *Limiter) Allow(c *fiber.Ctx, action easyrest.Action) (bool, time.Duration) {
+	if l.actions != nil && !l.actions[action] {
+		return true, 0
+	}
+	key := l.config.Key(c)
+	now := l.now()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.sweep(now)
+	full := l.buckets[key]
+	if full.Before(now) {
+		full = now
+	}
+	// The bucket is empty once it is a whole Per from being full
+	if wait := full.Sub(now) - (l.config.Per - l.interval); wait > 0 {
+		return false, wait
+	}
+	if _, ok := l.buckets[key]; !ok {
+		// The key may be a string from fiber's reused request buffers
+		key = utils.CopyString(key)
+	}
+	l.buckets[key] = full.Add(l.interval)
+	return true, 0
+}
+
+// sweep forgets the full buckets, at most once every Per, so clients that have gone away are not held
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.config.Per {
+		return
+	}
+	l.swept = now
+	for key, full := range l.buckets {
+		if !full.After(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
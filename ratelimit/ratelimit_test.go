@@ -0,0 +1,133 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	easyrest "github.com/pilotso11/go-easyrest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	writes := New(Config{
+		Limit:   3,
+		Per:     time.Minute,
+		Key:     func(c *fiber.Ctx) string { return c.Get("X-User") },
+		Actions: []easyrest.Action{easyrest.ActionCreate, easyrest.ActionMutate, easyrest.ActionDelete},
+	})
+	now := time.Now()
+	writes.now = func() time.Time { return now }
+
+	items := map[string]string{}
+	app := fiber.New()
+	easyrest.RegisterAPI(app, easyrest.Api[string, string]{
+		Path: "items",
+		Find: func(key string) (string, bool) {
+			item, ok := items[key]
+			return item, ok
+		},
+		FindAll: func() []string {
+			var all []string
+			for _, item := range items {
+				all = append(all, item)
+			}
+			return all
+		},
+		Create: func(dto string) (string, error) {
+			items[dto] = dto
+			return dto, nil
+		},
+		Dto:         func(s string) string { return s },
+		Key:         func(s string) string { return s },
+		RateLimiter: writes.Allow,
+	})
+	send := func(method string, url string, user string) (int, string) {
+		req := httptest.NewRequest(method, url, strings.NewReader(`"item"`))
+		req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+		req.Header.Set("X-User", user)
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		return resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter)
+	}
+
+	for i := 0; i < 3; i++ {
+		code, _ := send("POST", "/items", "alice")
+		assert.Equal(t, 200, code)
+	}
+	code, retry := send("POST", "/items", "alice")
+	assert.Equal(t, 429, code)
+	assert.Equal(t, "20", retry)
+
+	// Reads aren't limited, nor are other users
+	for i := 0; i < 5; i++ {
+		code, _ = send("GET", "/items", "alice")
+		assert.Equal(t, 200, code)
+	}
+	code, _ = send("POST", "/items", "bob")
+	assert.Equal(t, 200, code)
+
+	// A token is refilled every 20s
+	now = now.Add(20 * time.Second)
+	code, _ = send("POST", "/items", "alice")
+	assert.Equal(t, 200, code)
+	code, retry = send("POST", "/items", "alice")
+	assert.Equal(t, 429, code)
+	assert.Equal(t, "20", retry)
+	now = now.Add(15 * time.Second)
+	code, retry = send("POST", "/items", "alice")
+	assert.Equal(t, 429, code)
+	assert.Equal(t, "5", retry)
+
+	// Full buckets are forgotten
+	now = now.Add(2 * time.Minute)
+	code, _ = send("POST", "/items", "alice")
+	assert.Equal(t, 200, code)
+	assert.Len(t, writes.buckets, 1)
+}
+
+func TestLimiterDefaults(t *testing.T) {
+	limiter := New(Config{})
+	assert.Equal(t, 1, limiter.config.Limit)
+	assert.Equal(t, time.Second, limiter.config.Per)
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		allowed, retry := limiter.Allow(c, easyrest.ActionGetAll)
+		if !allowed {
+			assert.True(t, retry > 0 && retry <= time.Second)
+			return c.SendStatus(fiber.StatusTooManyRequests)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	resp, err = app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 429, resp.StatusCode)
+}
@@ -0,0 +1,131 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// outgoing returns the Jdo to send for a response to action, after TransformOut and Redact, and without its zero valued fields
+// with OmitZeroFields
+func (api Api[T, D]) outgoing(c *fiber.Ctx, action Action, dto D) (any, error) {
+	if api.TransformOut != nil {
+		dto = api.TransformOut(c, dto)
+	}
+	if api.Redact != nil {
+		dto = api.Redact(c, action, dto)
+	}
+	if !api.OmitZeroFields {
+		return dto, nil
+	}
+	return withoutZeros[D](dto)
+}
+
+// outgoingList applies TransformOut, Redact and OmitZeroFields to each Jdo of a list
+func (api Api[T, D]) outgoingList(c *fiber.Ctx, action Action, all []D) (any, error) {
+	if api.TransformOut != nil || api.Redact != nil {
+		changed := make([]D, 0, len(all))
+		for _, dto := range all {
+			if api.TransformOut != nil {
+				dto = api.TransformOut(c, dto)
+			}
+			if api.Redact != nil {
+				dto = api.Redact(c, action, dto)
+			}
+			changed = append(changed, dto)
+		}
+		all = changed
+	}
+	if !api.OmitZeroFields {
+		return all, nil
+	}
+	return withoutZeros[D](all)
+}
+
+// sendItem sends the Jdo of item as the response to action, after TransformOut and Redact
+func (api Api[T, D]) sendItem(c *fiber.Ctx, action Action, item T) error {
+	out, err := api.outgoing(c, action, api.Dto(item))
+	if err != nil {
+		return sendCallbackError(c, err)
+	}
+	return render(c, api.one(out))
+}
+
+// withoutZeros returns v, a DTO or slice of DTOs, serialised and decoded without the fields that have their zero value
+func withoutZeros[D any](v any) (any, error) {
+	all, err := decoded(v)
+	if err != nil {
+		return nil, err
+	}
+	dropZeros := func(dto reflect.Value, m any) {
+		if m, ok := m.(map[string]any); ok {
+			for _, key := range zeroKeys(dto) {
+				delete(m, key)
+			}
+		}
+	}
+	switch dtos := v.(type) {
+	case []D:
+		list, _ := all.([]any)
+		for i := range list {
+			dropZeros(reflect.ValueOf(dtos[i]), list[i])
+		}
+	case D:
+		dropZeros(reflect.ValueOf(dtos), all)
+	}
+	return all, nil
+}
+
+// zeroKeys returns the json keys of the fields of a struct that have their zero value.
+// The fields of embedded structs are included as they are serialised inline.
+func zeroKeys(v reflect.Value) []string {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var keys []string
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		key, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case key == "-":
+		case f.Anonymous && key == "" && (f.Type.Kind() == reflect.Struct || f.Type.Kind() == reflect.Pointer && f.Type.Elem().Kind() == reflect.Struct):
+			keys = append(keys, zeroKeys(v.Field(i))...)
+		case !f.IsExported():
+		case v.Field(i).IsZero():
+			if key == "" {
+				key = f.Name
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,218 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Errors returned by RegisterAPI and RegisterApi when an api can't be registered
+var (
+	ErrDuplicatePath = errors.New("duplicate api path") // An api is already registered at the path through the same router
+	ErrInvalidApi    = errors.New("invalid api")        // The Api or Options are missing required functions or can't be mapped
+)
+
+// Route is a method and full path registered for an api
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Registration describes a registered api
+type Registration struct {
+	Path    string   // The full path of the api, including the prefix of the router it was registered on
+	Actions []Action // The actions enabled, ActionGetAll and ActionGetOne are always enabled
+	Routes  []Route  // The routes registered, in the order they were registered.  Middleware is not included
+
+	// Reserved are the keys that can't be used for items, they are paths of the collection, e.g. "count", so GET of the key
+	// would not reach the item.  PUT to a reserved key with UpsertOnPut is a 422, backends should reject them on create.
+	// "filter" is only POST so items can use it.
+	Reserved []string
+}
+
+// registered holds the full paths of the apis registered through each router, to find duplicates
+var registered = struct {
+	sync.Mutex
+	paths map[fiber.Router]map[string]bool
+}{paths: map[fiber.Router]map[string]bool{}}
+
+// claimPath records that path is registered through router, ErrDuplicatePath if it already is
+func claimPath(router fiber.Router, path string) error {
+	registered.Lock()
+	defer registered.Unlock()
+	paths := registered.paths[router]
+	if paths == nil {
+		paths = map[string]bool{}
+		registered.paths[router] = paths
+	}
+	if paths[path] {
+		return fmt.Errorf("%w: %s", ErrDuplicatePath, path)
+	}
+	paths[path] = true
+	return nil
+}
+
+// check returns ErrInvalidApi if a function the api needs is missing, it must be called after the data functions are resolved
+func (api Api[T, D]) check() error {
+	switch {
+	case api.Dto == nil:
+		return fmt.Errorf("%w: %s has no Dto", ErrInvalidApi, api.Path)
+	case api.ops.find == nil:
+		return fmt.Errorf("%w: %s has no Find, FindCtx or FindE", ErrInvalidApi, api.Path)
+	case api.ops.findAll == nil:
+		return fmt.Errorf("%w: %s has no FindAll, FindAllCtx, FindAllE or IterateAll", ErrInvalidApi, api.Path)
+	case api.UpsertOnPut && api.SetKey == nil:
+		return fmt.Errorf("%w: %s has UpsertOnPut without SetKey", ErrInvalidApi, api.Path)
+	}
+	var emptyD D
+	for _, name := range api.SearchableFields {
+		if _, ok := reflect.TypeOf(emptyD).FieldByName(name); !ok {
+			return fmt.Errorf("%w: %s has searchable field %s that is not on the Jdo", ErrInvalidApi, api.Path, name)
+		}
+	}
+	for _, name := range api.SortableFields {
+		if !isSortable(reflect.TypeOf(emptyD), name) {
+			return fmt.Errorf("%w: %s has sortable field %s that is not a sortable field of the Jdo", ErrInvalidApi, api.Path, name)
+		}
+	}
+	return nil
+}
+
+// reservedKeys returns the keys that collection routes shadow on the item routes, routes other than POST with one segment
+func (api Api[T, D]) reservedKeys() []string {
+	reserved := []string{"count"}
+	if api.Subscriptions {
+		reserved = append(reserved, "ws")
+	}
+	for _, action := range api.CustomActions {
+		if action.Collection && action.method() != fiber.MethodPost && !strings.Contains(action.SubPath, "/") {
+			reserved = append(reserved, action.SubPath)
+		}
+	}
+	return reserved
+}
+
+// reservedKey returns an ErrValidation error if key is one of the reserved keys
+func (api Api[T, D]) reservedKey(key string) error {
+	for _, r := range api.reserved {
+		if key == r {
+			return fmt.Errorf("%w: key '%s' is reserved", ErrValidation, key)
+		}
+	}
+	return nil
+}
+
+// actions returns the actions enabled by caps
+func (api Api[T, D]) actions(caps capabilities) []Action {
+	actions := []Action{ActionGetAll, ActionGetOne}
+	if caps.mutate || caps.patch {
+		actions = append(actions, ActionMutate)
+	}
+	if caps.create {
+		actions = append(actions, ActionCreate)
+	}
+	if caps.delete {
+		actions = append(actions, ActionDelete)
+	}
+	if caps.search {
+		actions = append(actions, ActionSearch)
+	}
+	if len(api.CustomActions) > 0 {
+		actions = append(actions, ActionCustom)
+	}
+	if api.ValidateRoutes {
+		actions = append(actions, ActionValidate)
+	}
+	return actions
+}
+
+// routeRecorder is a fiber.Router that records the routes registered through it
+type routeRecorder struct {
+	fiber.Router
+	prefix string
+	routes []Route
+}
+
+// slashed registers handler with register at path and at path with a trailing slash, or without one for "/",
+// so the collection routes answer both forms whether or not the app uses StrictRouting
+func (r *routeRecorder) slashed(register func(path string, handlers ...fiber.Handler) fiber.Router, path string, handler fiber.Handler) {
+	register(path, handler)
+	if path == "/" {
+		register("", handler)
+	} else {
+		register(path+"/", handler)
+	}
+}
+
+func (r *routeRecorder) record(method, path string) fiber.Router {
+	r.routes = append(r.routes, Route{Method: method, Path: r.prefix + path})
+	return r
+}
+
+func (r *routeRecorder) Add(method, path string, handlers ...fiber.Handler) fiber.Router {
+	r.Router.Add(method, path, handlers...)
+	return r.record(method, path)
+}
+
+// Get also registers HEAD, as fiber does
+func (r *routeRecorder) Get(path string, handlers ...fiber.Handler) fiber.Router {
+	r.Router.Get(path, handlers...)
+	r.record(fiber.MethodHead, path)
+	return r.record(fiber.MethodGet, path)
+}
+
+func (r *routeRecorder) Head(path string, handlers ...fiber.Handler) fiber.Router {
+	r.Router.Head(path, handlers...)
+	return r.record(fiber.MethodHead, path)
+}
+
+func (r *routeRecorder) Post(path string, handlers ...fiber.Handler) fiber.Router {
+	r.Router.Post(path, handlers...)
+	return r.record(fiber.MethodPost, path)
+}
+
+func (r *routeRecorder) Put(path string, handlers ...fiber.Handler) fiber.Router {
+	r.Router.Put(path, handlers...)
+	return r.record(fiber.MethodPut, path)
+}
+
+func (r *routeRecorder) Patch(path string, handlers ...fiber.Handler) fiber.Router {
+	r.Router.Patch(path, handlers...)
+	return r.record(fiber.MethodPatch, path)
+}
+
+func (r *routeRecorder) Delete(path string, handlers ...fiber.Handler) fiber.Router {
+	r.Router.Delete(path, handlers...)
+	return r.record(fiber.MethodDelete, path)
+}
+
+func (r *routeRecorder) Options(path string, handlers ...fiber.Handler) fiber.Router {
+	r.Router.Options(path, handlers...)
+	return r.record(fiber.MethodOptions, path)
+}
@@ -0,0 +1,282 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// xmlList is the root element of a list sent as XML, each item is an <item>
+type xmlList struct {
+	XMLName xml.Name `xml:"list"`
+	Items   []any    `xml:"item"`
+}
+
+// xmlItems is a list as the data of an envelope sent as XML
+type xmlItems struct {
+	Items []any `xml:"item"`
+}
+
+// countResponse is the response of the count endpoints
+type countResponse struct {
+	XMLName xml.Name `json:"-" xml:"count"`
+	Count   int64    `json:"count" xml:",chardata"`
+}
+
+// MIMEApplicationMsgpack is MessagePack, encoded with the json field names and exclusions of the Jdo
+const MIMEApplicationMsgpack = "application/msgpack"
+
+// codec encodes responses and decodes request bodies of one content type
+type codec struct {
+	mime      string
+	marshal   func(c *fiber.Ctx, v any) ([]byte, error)
+	unmarshal func(data []byte, out any) error // nil if fiber's BodyParser decodes the content type
+	response  bool                             // Only used for responses, it isn't accepted for bodies
+}
+
+// codecs are the supported content types, the first is the default
+var codecs = []codec{
+	{
+		mime:    fiber.MIMEApplicationJSON,
+		marshal: func(c *fiber.Ctx, v any) ([]byte, error) { return jsonEncoder(c)(v) },
+	},
+	{
+		mime:    fiber.MIMEApplicationXML,
+		marshal: func(_ *fiber.Ctx, v any) ([]byte, error) { return xml.Marshal(xmlValue(v)) },
+	},
+	{
+		mime:      MIMEApplicationMsgpack,
+		marshal:   func(_ *fiber.Ctx, v any) ([]byte, error) { return marshalMsgpack(v) },
+		unmarshal: unmarshalMsgpack,
+	},
+	{
+		mime:     MIMEApplicationHAL,
+		marshal:  func(c *fiber.Ctx, v any) ([]byte, error) { return jsonEncoder(c)(v) },
+		response: true,
+	},
+}
+
+// codecMimes are the content types of the codecs in order
+var codecMimes = func() []string {
+	var mimes []string
+	for _, cd := range codecs {
+		mimes = append(mimes, cd.mime)
+	}
+	return mimes
+}()
+
+// bodyMimes are the content types of the codecs that are accepted for bodies
+var bodyMimes = func() []string {
+	var mimes []string
+	for _, cd := range codecs {
+		if !cd.response {
+			mimes = append(mimes, cd.mime)
+		}
+	}
+	return mimes
+}()
+
+// negotiate returns the codec the Accept header of the request prefers, JSON if none is acceptable
+func negotiate(c *fiber.Ctx) codec {
+	accepted := c.Accepts(codecMimes...)
+	for _, cd := range codecs {
+		if cd.mime == accepted {
+			return cd
+		}
+	}
+	return codecs[0]
+}
+
+// bodyCodec returns the codec of the request body if it isn't decoded by fiber's BodyParser
+func bodyCodec(c *fiber.Ctx) (codec, bool) {
+	mime := strings.ToLower(c.Get(fiber.HeaderContentType))
+	for _, cd := range codecs {
+		if cd.unmarshal != nil && strings.HasPrefix(mime, cd.mime) {
+			return cd, true
+		}
+	}
+	return codec{}, false
+}
+
+// bodyParser parses the request body into out with its codec, the JSONDecoder of the api, or fiber's BodyParser
+func bodyParser(c *fiber.Ctx, out any) error {
+	if cd, ok := bodyCodec(c); ok {
+		return cd.unmarshal(c.Body(), out)
+	}
+	if json, ok := c.Locals(serializerKey{}).(serializer); ok && json.decode != nil && contentType(c) == fiber.MIMEApplicationJSON {
+		return json.decode(c.Body(), out)
+	}
+	return c.BodyParser(out)
+}
+
+// serializerKey is the Locals key of the serializer of the api handling a request
+type serializerKey struct{}
+
+// serializer is the Serialize, JSONEncoder and JSONDecoder of an api, each can be nil to use the defaults
+type serializer struct {
+	serialize func(c *fiber.Ctx, v any) ([]byte, string, error)
+	encode    utils.JSONMarshal
+	decode    utils.JSONUnmarshal
+}
+
+// coded wraps the handler of a route so the request is encoded and decoded with the Serialize, JSONEncoder and
+// JSONDecoder of the api
+func (api Api[T, D]) coded(handler fiber.Handler) fiber.Handler {
+	if api.Serialize == nil && api.JSONEncoder == nil && api.JSONDecoder == nil {
+		return handler
+	}
+	codec := serializer{serialize: api.Serialize, encode: api.JSONEncoder, decode: api.JSONDecoder}
+	return func(c *fiber.Ctx) error {
+		c.Locals(serializerKey{}, codec)
+		return handler(c)
+	}
+}
+
+// jsonDecoder is the JSONDecoder of the api handling the request, or the app's
+func jsonDecoder(c *fiber.Ctx) utils.JSONUnmarshal {
+	if json, ok := c.Locals(serializerKey{}).(serializer); ok && json.decode != nil {
+		return json.decode
+	}
+	return c.App().Config().JSONDecoder
+}
+
+// marshal encodes v with the JSONEncoder, or encoding/json, outside of a request
+func (api Api[T, D]) marshal(v any) ([]byte, error) {
+	if api.JSONEncoder != nil {
+		return api.JSONEncoder(v)
+	}
+	return json.Marshal(v)
+}
+
+// unmarshal decodes data with the JSONDecoder, or encoding/json, outside of a request
+func (api Api[T, D]) unmarshal(data []byte, v any) error {
+	if api.JSONDecoder != nil {
+		return api.JSONDecoder(data, v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// encode serialises a response with the Serialize of the api, or as the request accepts, JSON unless another codec is preferred.
+// The content type of the encoding is returned with it.
+func encode(c *fiber.Ctx, v any) ([]byte, string, error) {
+	if s, ok := c.Locals(serializerKey{}).(serializer); ok && s.serialize != nil {
+		return s.serialize(c, v)
+	}
+	c.Vary(fiber.HeaderAccept)
+	cd := negotiate(c)
+	b, err := cd.marshal(c, v)
+	if err != nil && cd.mime != fiber.MIMEApplicationJSON {
+		err = notAcceptableError{mime: cd.mime, err: err}
+	}
+	return b, cd.mime, err
+}
+
+// notAcceptableError is a response that cannot be encoded as the requested content type
+type notAcceptableError struct {
+	mime string
+	err  error
+}
+
+func (e notAcceptableError) Error() string {
+	return fmt.Sprintf("response cannot be sent as %s: %v", e.mime, e.err)
+}
+
+func (e notAcceptableError) StatusCode() int {
+	return fiber.StatusNotAcceptable
+}
+
+// render sends v as the request accepts, JSON unless another codec is preferred.
+// 406 if the response cannot be represented in the codec, e.g. XML with selected fields or links.
+func render(c *fiber.Ctx, v any) error {
+	b, mime, err := encode(c, v)
+	if err != nil {
+		return sendEncodeError(c, err)
+	}
+	c.Set(fiber.HeaderContentType, mime)
+	return c.Send(b)
+}
+
+// sendEncodeError responds to a response that failed to encode
+func sendEncodeError(c *fiber.Ctx, err error) error {
+	var notAcceptable notAcceptableError
+	if errors.As(err, &notAcceptable) {
+		return sendError(c, fiber.StatusNotAcceptable, err)
+	}
+	return err
+}
+
+// marshalMsgpack encodes v as MessagePack using the json tags, so json:"-" fields are excluded
+func marshalMsgpack(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalMsgpack decodes MessagePack data into out using the json tags
+func unmarshalMsgpack(data []byte, out any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(out)
+}
+
+// xmlValue prepares v for encoding/xml, which needs a single root element, so lists are wrapped
+func xmlValue(v any) any {
+	if e, ok := v.(envelope); ok {
+		if items, ok := xmlSlice(e.Data); ok {
+			e.Data = xmlItems{Items: items}
+		}
+		return e
+	}
+	if items, ok := xmlSlice(v); ok {
+		return xmlList{Items: items}
+	}
+	return v
+}
+
+// xmlSlice returns the elements of v if it is a slice
+func xmlSlice(v any) ([]any, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+	items := make([]any, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items, true
+}
@@ -0,0 +1,65 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build go1.21
+
+package easyrest
+
+import (
+	"context"
+	"log/slog"
+)
+
+// The attribute names of the records logged by SlogRequests
+const (
+	RequestAttrPath    = "path"
+	RequestAttrAction  = "action"
+	RequestAttrKey     = "key"
+	RequestAttrStatus  = "status"
+	RequestAttrLatency = "latency"
+	RequestAttrError   = "error"
+)
+
+// SlogRequests returns a LogRequest function logging one "request" record to logger for each request.
+// The level is Info, Warn for a 4xx status and Error for a 5xx status or an error returned by the handler.
+func SlogRequests(logger *slog.Logger) func(RequestRecord) {
+	return func(r RequestRecord) {
+		level := slog.LevelInfo
+		switch {
+		case r.Status >= 500 || r.Err != nil:
+			level = slog.LevelError
+		case r.Status >= 400:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String(RequestAttrPath, r.Path),
+			slog.String(RequestAttrAction, r.Action.String()),
+			slog.String(RequestAttrKey, r.Key),
+			slog.Int(RequestAttrStatus, r.Status),
+			slog.Duration(RequestAttrLatency, r.Latency),
+		}
+		if r.Err != nil {
+			attrs = append(attrs, slog.String(RequestAttrError, r.Err.Error()))
+		}
+		logger.LogAttrs(context.Background(), level, "request", attrs...)
+	}
+}
@@ -0,0 +1,91 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build go1.21
+
+package easyrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/pilotso11/go-easyrest/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogRequests(t *testing.T) {
+	assert.NotPanics(t, func() {
+		app, data := setup()
+		defer cleanup(app)
+		data.permit = true
+		var buf bytes.Buffer
+		logged := newTestApi(data)
+		logged.Path = "testslog"
+		logged.LogRequest = SlogRequests(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+		RegisterAPI(app, logged)
+
+		records := func() []map[string]any {
+			var out []map[string]any
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var r map[string]any
+				assert.Nil(t, dec.Decode(&r))
+				out = append(out, r)
+			}
+			return out
+		}
+
+		// One record for each request, with the stable attribute names
+		code, _, err := util.GetJsonRequestResponse(app, "GET", "/testslog/id1", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, code)
+		logs := records()
+		if assert.Len(t, logs, 1) {
+			r := logs[0]
+			assert.Equal(t, "INFO", r["level"])
+			assert.Equal(t, "request", r["msg"])
+			assert.Equal(t, "testslog", r[RequestAttrPath])
+			assert.Equal(t, "getOne", r[RequestAttrAction])
+			assert.Equal(t, "id1", r[RequestAttrKey])
+			assert.Equal(t, float64(200), r[RequestAttrStatus])
+			assert.Contains(t, r, RequestAttrLatency)
+			assert.NotContains(t, r, RequestAttrError)
+		}
+
+		// Client errors are warnings, failures are errors
+		code, _, _ = util.GetJsonRequestResponse(app, "GET", "/testslog/missing", nil)
+		assert.Equal(t, 404, code)
+		data.fail = true
+		code, _, _ = util.GetJsonRequestResponse(app, "POST", "/testslog", TestItemDto{"id3", "new data"})
+		assert.Equal(t, 500, code)
+		logs = records()
+		if assert.Len(t, logs, 2) {
+			assert.Equal(t, "WARN", logs[0]["level"])
+			assert.Equal(t, float64(404), logs[0][RequestAttrStatus])
+			assert.Equal(t, "ERROR", logs[1]["level"])
+			assert.Equal(t, "create", logs[1][RequestAttrAction])
+			assert.Equal(t, float64(500), logs[1][RequestAttrStatus])
+		}
+	})
+}
@@ -0,0 +1,91 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sinceParams are the query parameters of GET / asking for the items updated after an RFC 3339 time, see Api.FindSince
+var sinceParams = []string{"updated_after", "since"}
+
+// parseSince returns the time of the updated_after, or since, query parameter, nil if there is neither.
+// It is an error if the time is not RFC 3339 or the Api can't find items by update time.
+func (api Api[T, D]) parseSince(c *fiber.Ctx) (*time.Time, error) {
+	for _, name := range sinceParams {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		if api.ops.findSince == nil {
+			return nil, errors.New(name + " is not supported")
+		}
+		since, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, errors.New("invalid " + name + " '" + value + "', expected an RFC 3339 time")
+		}
+		return &since, nil
+	}
+	return nil, nil
+}
+
+// findSinceFiltered returns the items found by FindSince that are also found by search with the filter, if there is one.
+// Items are matched by their Key, or are equal if the Api has no Key.
+func (api Api[T, D]) findSinceFiltered(ctx context.Context, since time.Time, filter *D, search func(ctx context.Context, filter D) ([]T, error)) ([]T, error) {
+	items := api.FindSince(since)
+	if filter == nil {
+		return items, nil
+	}
+	matched, err := search(ctx, *filter)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	if api.Key != nil {
+		for _, item := range matched {
+			keys[api.Key(item)] = true
+		}
+	}
+	var both []T
+	for _, item := range items {
+		switch {
+		case api.Key != nil:
+			if keys[api.Key(item)] {
+				both = append(both, item)
+			}
+		default:
+			for _, m := range matched {
+				if reflect.DeepEqual(item, m) {
+					both = append(both, item)
+					break
+				}
+			}
+		}
+	}
+	return both, nil
+}
@@ -0,0 +1,181 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortField is a single field of a sort specification.
+// Field is the name of the field on the DTO type, Desc reverses the order.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// parseSort parses a sort specification of the form "Field2,-Key" into SortFields.
+// A leading '-' sorts descending, a leading '+' (or nothing) ascending.
+// Each field must be an exported, sortable field of D that is not excluded from JSON.
+func parseSort[D any](spec string) ([]SortField, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var emptyD D
+	dT := reflect.TypeOf(emptyD)
+	var fields []SortField
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		f := SortField{}
+		switch {
+		case strings.HasPrefix(s, "-"):
+			f.Desc = true
+			s = s[1:]
+		case strings.HasPrefix(s, "+"):
+			s = s[1:]
+		}
+		if !isSortable(dT, s) {
+			return nil, fmt.Errorf("unknown sort field '%s'", s)
+		}
+		f.Field = s
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// parseSort parses a sort specification as parseSort[D], restricted to the SortableFields if there are any
+func (api Api[T, D]) parseSort(spec string) ([]SortField, error) {
+	fields, err := parseSort[D](spec)
+	if err != nil || len(api.SortableFields) == 0 {
+		if err != nil && len(api.SortableFields) > 0 {
+			err = fmt.Errorf("%v, sortable fields are %s", err, strings.Join(api.SortableFields, ", "))
+		}
+		return fields, err
+	}
+	for _, f := range fields {
+		allowed := false
+		for _, s := range api.SortableFields {
+			if s == f.Field {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, fmt.Errorf("field '%s' is not sortable, sortable fields are %s", f.Field, strings.Join(api.SortableFields, ", "))
+		}
+	}
+	return fields, nil
+}
+
+// isSortable checks name is an exported json visible field of t with an orderable type
+func isSortable(t reflect.Type, name string) bool {
+	if name == "" || t.Kind() != reflect.Struct {
+		return false
+	}
+	f, ok := t.FieldByName(name)
+	if !ok || !f.IsExported() || f.Tag.Get("json") == "-" {
+		return false
+	}
+	switch f.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String, reflect.Bool:
+		return true
+	}
+	return f.Type == reflect.TypeOf(time.Time{})
+}
+
+// sortDtos sorts a slice of DTOs, and the items they were made from, in place by the named fields using reflection.
+func sortDtos[T any, D any](items []T, dtos []D, fields []SortField) {
+	sort.Stable(dtoSorter[T, D]{items: items, dtos: dtos, fields: fields})
+}
+
+// dtoSorter orders items by the fields of their DTOs, keeping the two slices aligned
+type dtoSorter[T any, D any] struct {
+	items  []T
+	dtos   []D
+	fields []SortField
+}
+
+func (s dtoSorter[T, D]) Len() int { return len(s.dtos) }
+
+func (s dtoSorter[T, D]) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+	s.dtos[i], s.dtos[j] = s.dtos[j], s.dtos[i]
+}
+
+func (s dtoSorter[T, D]) Less(i, j int) bool {
+	a := reflect.ValueOf(s.dtos[i])
+	b := reflect.ValueOf(s.dtos[j])
+	for _, f := range s.fields {
+		c := compareValues(a.FieldByName(f.Field), b.FieldByName(f.Field))
+		if c == 0 {
+			continue
+		}
+		if f.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
+
+// compareValues returns -1, 0 or 1 comparing two values of the same orderable kind
+func compareValues(a reflect.Value, b reflect.Value) int {
+	switch {
+	case a.CanInt():
+		return compareOrdered(a.Int(), b.Int())
+	case a.CanUint():
+		return compareOrdered(a.Uint(), b.Uint())
+	case a.CanFloat():
+		return compareOrdered(a.Float(), b.Float())
+	case a.Kind() == reflect.String:
+		return compareOrdered(a.String(), b.String())
+	case a.Kind() == reflect.Bool:
+		return compareOrdered(boolToInt(a.Bool()), boolToInt(b.Bool()))
+	}
+	if ta, ok := a.Interface().(time.Time); ok {
+		return ta.Compare(b.Interface().(time.Time))
+	}
+	return 0
+}
+
+func compareOrdered[V int64 | uint64 | float64 | string | int](a V, b V) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,197 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"bufio"
+	"context"
+	"reflect"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MIMEApplicationNDJSON is newline delimited JSON, one item per line
+const MIMEApplicationNDJSON = "application/x-ndjson"
+
+// ndjsonFlushEvery is the number of lines written between flushes of an NDJSON response
+const ndjsonFlushEvery = 100
+
+// wantsNDJSON is true if the request asks for NDJSON with ?format=ndjson or its Accept header
+func wantsNDJSON(c *fiber.Ctx) bool {
+	return c.Query("format") == "ndjson" || c.Accepts(fiber.MIMEApplicationJSON, MIMEApplicationNDJSON) == MIMEApplicationNDJSON
+}
+
+// streams is true if the GET / request can be streamed from the iterator rather than buffered.
+// Paged, sorted, filtered, field selected and MaxResults capped requests are buffered, as are responses in codecs other than JSON
+// or of an api with Serialize, TransformOut, Redact or OmitZeroFields.
+func (api Api[T, D]) streams(c *fiber.Ctx, ndjson bool, limit, offset int, sortFields []SortField, filtered bool, fields [][]string) bool {
+	if !ndjson && (api.Serialize != nil || negotiate(c).mime != fiber.MIMEApplicationJSON) {
+		return false
+	}
+	if api.TransformOut != nil || api.Redact != nil || api.OmitZeroFields {
+		return false
+	}
+	return api.ops.iterate != nil && api.MaxResults == 0 && limit == 0 && offset == 0 && len(sortFields) == 0 && !filtered && fields == nil
+}
+
+// streamAll sends every item as a JSON array, or NDJSON lines, written as the items are iterated so the whole list is never held.
+// The response has no ETag.  An error part way through is logged and ends the response early, leaving invalid JSON.
+func streamAll[T any, D any](c *fiber.Ctx, api Api[T, D], ndjson bool) error {
+	// The Ctx is released once the handler returns, so take what the writer needs now
+	ctx := c.UserContext()
+	encode := jsonEncoder(c)
+	base := ""
+	if api.IncludeLinks && api.Key != nil {
+		base = api.basePath(c)
+	}
+	path := c.Path()
+
+	var w listWriter = &arrayWriter{enveloped: api.Envelope != EnvelopeNone}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if ndjson {
+		w = &lineWriter{}
+		c.Set(fiber.HeaderContentType, MIMEApplicationNDJSON)
+	}
+	c.Context().SetBodyStreamWriter(func(bw *bufio.Writer) {
+		if err := writeStream(ctx, bw, w, api, encode, base); err != nil {
+			api.logger().Errorf("Error streaming %s: %v\n", path, err)
+		}
+		_ = bw.Flush()
+	})
+	return nil
+}
+
+// writeStream writes all the items to w with the list format lw.  Items are linked if base is set.
+func writeStream[T any, D any](ctx context.Context, w *bufio.Writer, lw listWriter, api Api[T, D], encode func(v any) ([]byte, error), base string) error {
+	lw.start(w)
+	var failed error
+	err := api.ops.iterate(ctx, func(item T) bool {
+		var out any = api.Dto(item)
+		if base != "" {
+			if out, failed = asDecoded(out); failed != nil {
+				return false
+			}
+			if m, ok := out.(map[string]any); ok {
+				m["_links"] = api.itemLinks(base + "/" + api.keyPath(api.Key(item)))
+			}
+		}
+		b, err := encode(out)
+		if err != nil {
+			failed = err
+			return false
+		}
+		failed = lw.item(w, b)
+		return failed == nil
+	})
+	if err == nil {
+		err = failed
+	}
+	if err != nil {
+		return err
+	}
+	lw.end(w)
+	return nil
+}
+
+// sendNDJSON sends a list that has already been found as NDJSON lines, flushing as they are written
+func sendNDJSON(c *fiber.Ctx, list any, logger Logger) error {
+	items := reflect.ValueOf(list)
+	encode := jsonEncoder(c)
+	path := c.Path()
+	c.Set(fiber.HeaderContentType, MIMEApplicationNDJSON)
+	c.Context().SetBodyStreamWriter(func(bw *bufio.Writer) {
+		lw := &lineWriter{}
+		for i := 0; i < items.Len(); i++ {
+			b, err := encode(items.Index(i).Interface())
+			if err == nil {
+				err = lw.item(bw, b)
+			}
+			if err != nil {
+				logger.Errorf("Error streaming %s: %v\n", path, err)
+				break
+			}
+		}
+		_ = bw.Flush()
+	})
+	return nil
+}
+
+// listWriter writes the encoded items of a list response in its format
+type listWriter interface {
+	start(w *bufio.Writer)
+	item(w *bufio.Writer, b []byte) error
+	end(w *bufio.Writer)
+}
+
+// arrayWriter writes a JSON array, optionally enveloped
+type arrayWriter struct {
+	enveloped bool
+	count     int
+}
+
+func (a *arrayWriter) start(w *bufio.Writer) {
+	if a.enveloped {
+		_, _ = w.WriteString(`{"data":`)
+	}
+	_ = w.WriteByte('[')
+}
+
+func (a *arrayWriter) item(w *bufio.Writer, b []byte) error {
+	if a.count > 0 {
+		_ = w.WriteByte(',')
+	}
+	a.count++
+	_, err := w.Write(b)
+	return err
+}
+
+func (a *arrayWriter) end(w *bufio.Writer) {
+	_ = w.WriteByte(']')
+	if a.enveloped {
+		_, _ = w.WriteString(`,"meta":{"count":` + strconv.Itoa(a.count) + `,"limit":0,"offset":0}}`)
+	}
+}
+
+// lineWriter writes NDJSON, one item per line, flushing every ndjsonFlushEvery lines
+type lineWriter struct {
+	count int
+}
+
+func (l *lineWriter) start(*bufio.Writer) {}
+
+func (l *lineWriter) item(w *bufio.Writer, b []byte) error {
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	if err := w.WriteByte('\n'); err != nil {
+		return err
+	}
+	l.count++
+	if l.count%ndjsonFlushEvery == 0 {
+		return w.Flush()
+	}
+	return nil
+}
+
+func (l *lineWriter) end(*bufio.Writer) {}
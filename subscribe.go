@@ -0,0 +1,259 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// subscriberBuffer is the number of events queued for a subscriber, one that falls further behind is disconnected
+const subscriberBuffer = 64
+
+// changeEvent is a change sent to subscribers
+type changeEvent struct {
+	Action string          `json:"action"`
+	Data   json.RawMessage `json:"data"`
+	fields map[string]any  // The Jdo fields, for matching filters
+	dto    any             // The Jdo before TransformOut and Redact, which are applied for each subscriber
+}
+
+// subscriber is a client following the changes to an api
+type subscriber struct {
+	events chan changeEvent
+}
+
+// subscribers is the registry of the clients following the changes to an api, changes are fanned out to every one
+type subscribers struct {
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{subs: map[*subscriber]struct{}{}}
+}
+
+// add registers a new subscriber
+func (s *subscribers) add() *subscriber {
+	sub := &subscriber{events: make(chan changeEvent, subscriberBuffer)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs[sub] = struct{}{}
+	return sub
+}
+
+// remove unregisters sub, closing its events if it was still registered
+func (s *subscribers) remove(sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[sub]; ok {
+		delete(s.subs, sub)
+		close(sub.events)
+	}
+}
+
+// send queues event for every subscriber without blocking.
+// A subscriber with a full queue is removed, closing its events, so it is never silently missing changes.
+func (s *subscribers) send(event changeEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		select {
+		case sub.events <- event:
+		default:
+			delete(s.subs, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// publish sends a change to the subscribers, if there are any.
+// The data is the Jdo of after, or of before for a delete.  It is encoded once for every subscriber, unless it
+// is changed for each of them by the outgoing hooks.
+func (api Api[T, D]) publish(action Action, before *T, after *T) {
+	if api.subs == nil {
+		return
+	}
+	item := after
+	if item == nil {
+		item = before
+	}
+	event := changeEvent{Action: action.String(), dto: api.Dto(*item)}
+	if !api.outgoingHooks() {
+		var err error
+		if event, err = api.encodeEvent(event, event.dto); err != nil {
+			api.logger().Errorf("Error encoding %s change for subscribers: %v\n", api.Path, err)
+			return
+		}
+	}
+	api.subs.send(event)
+}
+
+// outgoingHooks is true if TransformOut, Redact or OmitZeroFields change the Jdos sent for each request
+func (api Api[T, D]) outgoingHooks() bool {
+	return api.TransformOut != nil || api.Redact != nil || api.OmitZeroFields
+}
+
+// encodeEvent sets the data of event to out, and its fields for matching filters
+func (api Api[T, D]) encodeEvent(event changeEvent, out any) (changeEvent, error) {
+	data, err := api.marshal(out)
+	if err != nil {
+		return event, err
+	}
+	event.Data = data
+	event.fields = nil
+	_ = api.unmarshal(data, &event.fields)
+	return event, nil
+}
+
+// outgoingEvent returns a function applying the outgoing hooks to events as for a GET / by the request of c.
+// The request is copied with its Locals and user context, as c is not valid once the connection is upgraded,
+// and release returns the copy when the subscriber is done.
+func (api Api[T, D]) outgoingEvent(c *fiber.Ctx) (outgoing func(changeEvent) (changeEvent, error), release func()) {
+	if !api.outgoingHooks() {
+		return nil, func() {}
+	}
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Init(c.Request(), c.Context().RemoteAddr(), nil)
+	c.Context().VisitUserValues(func(key []byte, value any) {
+		fctx.SetUserValueBytes(key, value)
+	})
+	detached := c.App().AcquireCtx(fctx)
+	detached.SetUserContext(c.UserContext())
+	outgoing = func(event changeEvent) (changeEvent, error) {
+		out, err := api.outgoing(detached, ActionGetAll, event.dto.(D))
+		if err != nil {
+			return event, err
+		}
+		return api.encodeEvent(event, out)
+	}
+	return outgoing, func() { c.App().ReleaseCtx(detached) }
+}
+
+// matches is true if every field of filter has the same value in the event
+func (e changeEvent) matches(filter map[string]any) bool {
+	for name, value := range filter {
+		if !reflect.DeepEqual(e.fields[name], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// subscribe upgrades GET /ws to a websocket sending the changes to the api.
+// The access check is made with ActionGetAll before the upgrade, 426 if the request is not a websocket upgrade.
+func subscribe[T any, D any](api Api[T, D]) fiber.Handler {
+	upgrader := websocket.FastHTTPUpgrader{}
+	return func(c *fiber.Ctx) error {
+		// Perms check
+		if err := api.authorize(c, ActionGetAll); err != nil {
+			return sendDenied(c, err)
+		}
+		if !websocket.FastHTTPIsWebSocketUpgrade(c.Context()) {
+			return sendError(c, fiber.StatusUpgradeRequired, errors.New("websocket upgrade required"))
+		}
+
+		// Register before the upgrade completes so no change after the handshake is missed
+		sub := api.subs.add()
+		outgoing, release := api.outgoingEvent(c)
+		err := upgrader.Upgrade(c.Context(), func(conn *websocket.Conn) {
+			defer release()
+			defer api.subs.remove(sub)
+			sendChanges(conn, sub, outgoing, api.logger())
+		})
+		if err != nil {
+			api.subs.remove(sub)
+			release()
+		}
+		return err
+	}
+}
+
+// sendChanges writes the events of sub to conn until either the client or the subscription is closed.
+// Events are prepared for the subscriber by outgoing, if it is set, before they are matched with its filter.
+func sendChanges(conn *websocket.Conn, sub *subscriber, outgoing func(changeEvent) (changeEvent, error), logger Logger) {
+	filters := make(chan map[string]any, 1)
+	go readFilter(conn, filters)
+
+	var filter map[string]any
+	for {
+		select {
+		case f, ok := <-filters:
+			if !ok {
+				return
+			}
+			filter = f
+		case event, ok := <-sub.events:
+			if !ok {
+				closeWith(conn, websocket.CloseTryAgainLater, "too far behind")
+				return
+			}
+			if outgoing != nil {
+				var err error
+				if event, err = outgoing(event); err != nil {
+					logger.Errorf("Error encoding change for a subscriber: %v\n", err)
+					continue
+				}
+			}
+			if !event.matches(filter) {
+				continue
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readFilter reads the filter from the first message of the client, and then waits for it to close.
+// filters is closed when the connection is closed, or the filter is not a JSON object.
+func readFilter(conn *websocket.Conn, filters chan<- map[string]any) {
+	defer close(filters)
+	for first := true; ; first = false {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if !first {
+			continue
+		}
+		var filter map[string]any
+		if err := json.Unmarshal(msg, &filter); err != nil {
+			closeWith(conn, websocket.CloseUnsupportedData, "filter must be a JSON object")
+			return
+		}
+		filters <- filter
+	}
+}
+
+// closeWith sends a close message with code and reason
+func closeWith(conn *websocket.Conn, code int, reason string) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
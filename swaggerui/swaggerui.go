@@ -0,0 +1,105 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package swaggerui serves an embedded Swagger UI for exploring an OpenAPI spec of easyrest apis.
+//
+//	swaggerui.ServeSwaggerUI(app, "/docs", "/openapi.json")
+//
+// The Swagger UI assets are only linked into binaries that import this package.
+package swaggerui
+
+import (
+	"bytes"
+	"html/template"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// index is the Swagger UI page, the assets are loaded relative to it
+var index = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="UTF-8">
+    <title>Swagger UI</title>
+    <link rel="stylesheet" type="text/css" href="./swagger-ui.css" />
+    <link rel="stylesheet" type="text/css" href="./index.css" />
+    <link rel="icon" type="image/png" href="./favicon-32x32.png" sizes="32x32" />
+    <link rel="icon" type="image/png" href="./favicon-16x16.png" sizes="16x16" />
+  </head>
+  <body>
+    <div id="swagger-ui"></div>
+    <script src="./swagger-ui-bundle.js" charset="UTF-8"></script>
+    <script src="./swagger-ui-standalone-preset.js" charset="UTF-8"></script>
+    <script>
+      window.onload = function() {
+        window.ui = SwaggerUIBundle({
+          url: {{.}},
+          dom_id: "#swagger-ui",
+          deepLinking: true,
+          presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+          plugins: [SwaggerUIBundle.plugins.DownloadUrl],
+          layout: "StandaloneLayout"
+        });
+      };
+    </script>
+  </body>
+</html>
+`))
+
+// ServeSwaggerUI serves Swagger UI at path on router, showing the OpenAPI spec at specURL.
+// GET path redirects to path/ so the assets resolve beneath it.
+func ServeSwaggerUI(router fiber.Router, path string, specURL string) {
+	var page bytes.Buffer
+	if err := index.Execute(&page, specURL); err != nil {
+		panic(err)
+	}
+	html := page.Bytes()
+	path = strings.TrimSuffix(path, "/")
+
+	router.Get(path, func(c *fiber.Ctx) error {
+		if strings.HasSuffix(c.Path(), "/") {
+			return sendIndex(c, html)
+		}
+		return c.Redirect(c.Path()+"/", fiber.StatusMovedPermanently)
+	})
+	router.Get(path+"/index.html", func(c *fiber.Ctx) error {
+		return sendIndex(c, html)
+	})
+	router.Get(path+"/:file", func(c *fiber.Ctx) error {
+		name := c.Params("file")
+		b, err := fs.ReadFile(swaggerFiles.FS, name)
+		if err != nil {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		c.Type(strings.TrimPrefix(filepath.Ext(name), "."))
+		return c.Send(b)
+	})
+}
+
+func sendIndex(c *fiber.Ctx, html []byte) error {
+	c.Type("html", "utf-8")
+	return c.Send(html)
+}
@@ -0,0 +1,68 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package swaggerui
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeSwaggerUI(t *testing.T) {
+	app := fiber.New()
+	ServeSwaggerUI(app, "/docs", "/api/openapi.json")
+
+	get := func(url string) (int, string, string) {
+		resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+		assert.Nil(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get(fiber.HeaderContentType), string(body)
+	}
+
+	// The page points at the spec
+	code, mime, body := get("/docs/")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "text/html; charset=utf-8", mime)
+	assert.Contains(t, body, `url: "/api/openapi.json"`)
+	assert.Contains(t, body, `<script src="./swagger-ui-bundle.js"`)
+	code, _, _ = get("/docs/index.html")
+	assert.Equal(t, 200, code)
+
+	// The assets resolve beneath the page
+	resp, err := app.Test(httptest.NewRequest("GET", "/docs", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 301, resp.StatusCode)
+	assert.Equal(t, "/docs/", resp.Header.Get(fiber.HeaderLocation))
+	code, mime, body = get("/docs/swagger-ui-bundle.js")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "text/javascript", mime)
+	assert.NotEmpty(t, body)
+	code, mime, _ = get("/docs/swagger-ui.css")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "text/css", mime)
+	code, _, _ = get("/docs/missing.js")
+	assert.Equal(t, 404, code)
+}
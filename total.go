@@ -0,0 +1,64 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeaderTotalCount is the default TotalHeader, set to the number of items in a whole list or search
+const HeaderTotalCount = "X-Total-Count"
+
+// setTotal sets the TotalHeader of a list response with the total matching filter, nil for an unfiltered list.
+// The total is counted with Count if the Api has one and counts is set, otherwise it is loaded, the length of the whole list as found.
+// loaded is -1 if the list was found a page at a time, and then without a Count there is no header.
+// A Content-Range TotalHeader describes the page, from offset with n items, as "items first-last/total".
+// It returns the total, -1 if there is none.
+func (api Api[T, D]) setTotal(c *fiber.Ctx, filter *D, counts bool, loaded int, offset int, n int) (int64, error) {
+	total := int64(loaded)
+	if counts && api.ops.count != nil {
+		var err error
+		if total, err = api.ops.count(c.UserContext(), filter); err != nil {
+			return 0, err
+		}
+	}
+	if total < 0 {
+		return total, nil
+	}
+	header := api.TotalHeader
+	if header == "" {
+		header = HeaderTotalCount
+	}
+	value := strconv.FormatInt(total, 10)
+	if header == fiber.HeaderContentRange {
+		first := "*"
+		if n > 0 {
+			first = strconv.Itoa(offset) + "-" + strconv.Itoa(offset+n-1)
+		}
+		value = "items " + first + "/" + value
+	}
+	c.Set(header, value)
+	return total, nil
+}
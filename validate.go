@@ -0,0 +1,260 @@
+// MIT License
+//
+// Copyright (c) 2023 Seth Osher
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package easyrest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// FieldError describes a field of a Jdo that failed validation
+type FieldError struct {
+	Field   string `json:"field"`   // The json name of the field, with a '.' between nested fields
+	Rule    string `json:"rule"`    // The rule that failed, e.g. "required" or "max=64"
+	Message string `json:"message"` // A description of the failure
+}
+
+// FieldErrors is the error returned by ValidateDto functions to report each invalid field.
+// It is sent as a JSON array with a 422 response.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	var msgs []string
+	for _, f := range e {
+		msgs = append(msgs, f.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// StatusCode makes FieldErrors returned by Create or Mutate a 422
+func (e FieldErrors) StatusCode() int {
+	return fiber.StatusUnprocessableEntity
+}
+
+// validate runs ValidateDto, if set, on an incoming Jdo
+func (api Api[T, D]) validate(dto D) error {
+	if api.ValidateDto == nil {
+		return nil
+	}
+	return api.ValidateDto(dto)
+}
+
+// transformIn runs TransformIn, if set, on an incoming Jdo or filter
+func (api Api[T, D]) transformIn(c *fiber.Ctx, dto D) (D, error) {
+	if api.TransformIn == nil {
+		return dto, nil
+	}
+	return api.TransformIn(c, dto)
+}
+
+// transformAndValidate replaces an incoming Jdo with the result of TransformIn then checks it with ValidateDto
+func (api Api[T, D]) transformAndValidate(c *fiber.Ctx, dto *D) error {
+	transformed, err := api.transformIn(c, *dto)
+	if err != nil {
+		return err
+	}
+	*dto = transformed
+	return api.validate(transformed)
+}
+
+// sendValidationError responds with 422 and a JSON array of the field errors.
+// An error that is not FieldErrors is sent as a single entry without a field.
+func sendValidationError(c *fiber.Ctx, err error) error {
+	if handler := errorHandler(c); handler != nil {
+		return handler(c, fiber.StatusUnprocessableEntity, err)
+	}
+	var fields FieldErrors
+	if !errors.As(err, &fields) {
+		fields = FieldErrors{{Message: err.Error()}}
+	}
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(fields)
+}
+
+// validateNew checks the Jdo in the body as a create would, without creating it.
+// 200 with the parsed Jdo, or 422 with the field errors
+func validateNew[T any, D any](api Api[T, D]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var incoming D
+		if err := api.parseBody(c, &incoming); err != nil {
+			return api.sendBodyError(c, err)
+		}
+		if err := api.authorizeIncoming(c, ActionValidate, &incoming); err != nil {
+			return sendDenied(c, err)
+		}
+		if err := api.transformAndValidate(c, &incoming); err != nil {
+			return sendValidationError(c, err)
+		}
+		return render(c, api.one(incoming))
+	}
+}
+
+// validateItem checks the Jdo in the body as a PUT to the item would, without changing it.
+// The key in the path replaces any in the body if SetKey is set.
+// 200 with the parsed Jdo, 404 if the item is not found, or 422 with the field errors
+func validateItem[T any, D any](api Api[T, D]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var incoming D
+		if err := api.parseBody(c, &incoming); err != nil {
+			return api.sendBodyError(c, err)
+		}
+
+		id := api.itemKey(c)
+		item, ok, err := api.ops.find(c.UserContext(), id)
+		if err != nil {
+			return api.sendFindError(c, err)
+		}
+		if !ok {
+			// don't leak existence information if unauthorized
+			if err := api.authorizeIncoming(c, ActionValidate, &incoming); err != nil {
+				return sendDenied(c, err)
+			}
+			return sendStatus(c, fiber.StatusNotFound)
+		}
+		if api.SetKey != nil {
+			if err := api.SetKey(&incoming, id); err != nil {
+				return sendError(c, fiber.StatusBadRequest, err)
+			}
+		}
+
+		if err := api.authorizeIncoming(c, ActionValidate, &incoming, item); err != nil {
+			return sendDenied(c, err)
+		}
+		if err := api.transformAndValidate(c, &incoming); err != nil {
+			return sendValidationError(c, err)
+		}
+		return render(c, api.one(incoming))
+	}
+}
+
+// ValidateTags validates a Jdo using `validate` struct tags on its fields, for use as ValidateDto.
+// The rules are a comma separated list of:
+//
+//	required  the field must not be the zero value
+//	min=N     strings, slices and maps must have at least N elements (runes for strings), numbers must be at least N
+//	max=N     strings, slices and maps must have at most N elements (runes for strings), numbers must be at most N
+//
+// Nested structs are validated too.  All the failures are returned as FieldErrors.
+func ValidateTags[D any](dto D) error {
+	errs := validateStruct(reflect.ValueOf(dto), "")
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateStruct checks the validate tags on the fields of v, prefix is the path of v in the Jdo
+func validateStruct(v reflect.Value, prefix string) FieldErrors {
+	var errs FieldErrors
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if f.Anonymous && f.Tag.Get("json") == "" {
+			name = "" // embedded fields are promoted
+		}
+		field := prefix + name
+		if tags := f.Tag.Get("validate"); tags != "" {
+			for _, rule := range strings.Split(tags, ",") {
+				rule = strings.TrimSpace(rule)
+				if msg := checkRule(v.Field(i), rule); msg != "" {
+					errs = append(errs, FieldError{Field: field, Rule: rule, Message: field + " " + msg})
+				}
+			}
+		}
+		nested := field + "."
+		if field == "" {
+			nested = prefix
+		}
+		errs = append(errs, validateStruct(v.Field(i), nested)...)
+	}
+	return errs
+}
+
+// checkRule returns a description of the failure if v breaks rule, or "" if it is valid
+func checkRule(v reflect.Value, rule string) string {
+	name, param, _ := strings.Cut(rule, "=")
+	switch name {
+	case "required":
+		if v.IsZero() {
+			return "is required"
+		}
+		return ""
+	case "min", "max":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return fmt.Sprintf("has an invalid rule '%s'", rule)
+		}
+		size, isLen := measure(v)
+		switch {
+		case name == "min" && size < limit && isLen:
+			return fmt.Sprintf("must have at least %s elements", param)
+		case name == "min" && size < limit:
+			return fmt.Sprintf("must be at least %s", param)
+		case name == "max" && size > limit && isLen:
+			return fmt.Sprintf("must have at most %s elements", param)
+		case name == "max" && size > limit:
+			return fmt.Sprintf("must be at most %s", param)
+		}
+		return ""
+	}
+	return fmt.Sprintf("has an unknown rule '%s'", rule)
+}
+
+// measure returns the length of strings, slices, arrays and maps, or the value of a number.
+// isLen is true if the result is a length.
+func measure(v reflect.Value) (size float64, isLen bool) {
+	switch {
+	case v.Kind() == reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case v.Kind() == reflect.Slice, v.Kind() == reflect.Array, v.Kind() == reflect.Map:
+		return float64(v.Len()), true
+	case v.CanInt():
+		return float64(v.Int()), false
+	case v.CanUint():
+		return float64(v.Uint()), false
+	case v.CanFloat():
+		return v.Float(), false
+	}
+	return 0, false
+}